@@ -0,0 +1,75 @@
+package breakers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// 熔断管理接口 prefix 如 /admin/breakers 名称由 query 参数 name 传递
+// grpc 熔断名称包含 dns:/// 等 / 放在路径中会被 ServeMux 重定向
+//
+//	GET  prefix                    列出全部
+//	GET  prefix?name={name}        查看
+//	POST prefix/open?name={name}   强制打开
+//	POST prefix/close?name={name}  强制关闭
+//	POST prefix/reset?name={name}  重置统计 取消强制状态
+//
+// 可以强制打开熔断 只应挂载在内网端口
+func AdminHandler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	actions := map[string]func(name string) bool{
+		"open":  ForceOpen,
+		"close": ForceClose,
+		"reset": Reset,
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+			return
+		}
+		action := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		name := r.URL.Query().Get("name")
+		switch r.Method {
+		case http.MethodGet:
+			if len(action) > 0 {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+				return
+			}
+			if len(name) == 0 {
+				writeJSON(w, http.StatusOK, map[string]interface{}{"breakers": List()})
+				return
+			}
+			info, ok := Inspect(name)
+			if !ok {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "breaker not found"})
+				return
+			}
+			writeJSON(w, http.StatusOK, info)
+		case http.MethodPost:
+			fn, ok := actions[action]
+			if !ok {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "action not found"})
+				return
+			}
+			if len(name) == 0 {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name is required"})
+				return
+			}
+			if !fn(name) {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "breaker not found"})
+				return
+			}
+			info, _ := Inspect(name)
+			writeJSON(w, http.StatusOK, info)
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,134 @@
+package breakers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jeevic/lego/components/breakers/breaker"
+	"github.com/jeevic/lego/components/breakers/define"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func adminRequest(t *testing.T, h http.Handler, method string, path string, v interface{}) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatal(err, w.Body.String())
+		}
+	}
+	return w.Code
+}
+
+func TestAdminHandler(t *testing.T) {
+	//grpc 熔断名称包含 dns:///
+	name := "dns:///admin-test:9000/pkg.Service/Method"
+	query := "?name=" + url.QueryEscape(name)
+	bk := NewBreaker().WithBreakerType(define.StateBreaker).GetOrBuild(name)
+	for i := 0; i < 3; i++ {
+		_ = bk.Do(func() error { return nil })
+	}
+	//与 bootstrap 相同 挂载在 ServeMux
+	mux := http.NewServeMux()
+	mux.Handle("/admin/breakers", AdminHandler("/admin/breakers/"))
+	mux.Handle("/admin/breakers/", AdminHandler("/admin/breakers/"))
+	h := http.Handler(mux)
+
+	var list struct {
+		Breakers []Info `json:"breakers"`
+	}
+	if code := adminRequest(t, h, http.MethodGet, "/admin/breakers", &list); code != http.StatusOK {
+		t.Fatal("list breakers", code)
+	}
+	found := false
+	for _, info := range list.Breakers {
+		if info.Name == name {
+			found = info.Type == "state" && info.State == "closed" && info.Total == 3 && info.Accepts == 3
+		}
+	}
+	if !found {
+		t.Fatal("breaker should be listed", list.Breakers)
+	}
+
+	var info Info
+	if code := adminRequest(t, h, http.MethodPost, "/admin/breakers/open"+query, &info); code != http.StatusOK {
+		t.Fatal("force open", code)
+	}
+	if info.State != "open" || !info.Forced || info.DropRatio != 1 {
+		t.Fatal("breaker should be forced open", info)
+	}
+	fallback := errors.New("fallback")
+	if err := bk.WithFallback(func(err error) error { return fallback }).Do(func() error { return nil }); err != fallback {
+		t.Fatal("forced open breaker should call fallback", err)
+	}
+
+	adminRequest(t, h, http.MethodPost, "/admin/breakers/close"+query, &info)
+	if info.State != "closed" || !info.Forced {
+		t.Fatal("breaker should be forced closed", info)
+	}
+	if err := bk.Do(func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	adminRequest(t, h, http.MethodPost, "/admin/breakers/reset"+query, &info)
+	if info.Forced || info.Total != 0 || info.Drops != 0 {
+		t.Fatal("breaker should be reset", info)
+	}
+	if code := adminRequest(t, h, http.MethodGet, "/admin/breakers"+query, &info); code != http.StatusOK || info.Name != name {
+		t.Fatal("inspect breaker", code, info)
+	}
+
+	if code := adminRequest(t, h, http.MethodGet, "/admin/breakers?name=not-exist", nil); code != http.StatusNotFound {
+		t.Fatal("unknown breaker", code)
+	}
+	if code := adminRequest(t, h, http.MethodPost, "/admin/breakers/unknown"+query, nil); code != http.StatusNotFound {
+		t.Fatal("unknown action", code)
+	}
+	if code := adminRequest(t, h, http.MethodPost, "/admin/breakers/open", nil); code != http.StatusBadRequest {
+		t.Fatal("name is required", code)
+	}
+	if code := adminRequest(t, h, http.MethodDelete, "/admin/breakers"+query, nil); code != http.StatusMethodNotAllowed {
+		t.Fatal("method not allowed", code)
+	}
+}
+
+func TestResetKeepsK(t *testing.T) {
+	bk := breaker.NewBreaker(breaker.WithName("reset-k"))
+	bk.SetK(100)
+	for i := 0; i < 10; i++ {
+		_ = bk.Do(func() error { return errors.New("fail") })
+	}
+	bk.Reset()
+	if st := bk.Stat(); st.Total != 0 {
+		t.Fatal("reset should clear statistics", st)
+	}
+	//默认 k=2 时熔断概率为 0.5
+	_ = bk.Do(func() error { return nil })
+	for i := 0; i < 8; i++ {
+		_ = bk.Do(func() error { return errors.New("fail") })
+	}
+	if st := bk.Stat(); st.DropRatio != 0 {
+		t.Fatal("reset should keep k", st)
+	}
+}
+
+func TestBreakerDoCtx(t *testing.T) {
+	fallback := errors.New("fallback")
+	bk := NewBreaker().WithTimeout(10 * time.Millisecond).WithFallback(func(err error) error {
+		return fallback
+	}).GetOrBuild("do-ctx")
+	if err := bk.DoCtx(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}); err != context.DeadlineExceeded {
+		t.Fatal("DoCtx should enforce timeout", err)
+	}
+	ForceOpen("do-ctx")
+	if err := bk.DoCtx(context.Background(), nil); err != fallback {
+		t.Fatal("DoCtx should use fallback", err)
+	}
+}
@@ -1,9 +1,15 @@
 package breaker
 
 import (
+	"context"
+	"errors"
 	"github.com/jeevic/lego/components/breakers/define"
+	"github.com/jeevic/lego/components/log"
+	"math"
 	"math/rand"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,6 +21,13 @@ const (
 	letterIdxMax   = 63 / letterIdxBits   // # of letter indices fitting in 63 bits
 )
 
+//强制状态
+const (
+	forceNone  = 0
+	forceOpen  = 1
+	forceClose = 2
+)
+
 type (
 	EffectiveBreaker interface {
 		// Name returns the name of the EffectiveBreaker.
@@ -46,11 +59,48 @@ type (
 		// and causes the same panic again.
 		// acceptable checks if it's a successful call, even if the err is not nil.
 		DoWithFallbackAcceptable(req ReqFunc, fallback FallbackFunc, acceptable Acceptable) error
+		// DoCtx runs the given request with a context derived from ctx and the timeout of the EffectiveBreaker.
+		// DoCtx returns ctx.Err() as soon as the derived context is done, the request keeps running and its
+		// late error or panic is only logged. req must return once the ctx is done, otherwise the abandoned
+		// goroutines pile up while the dependency is slow. A timeout is counted as a failure, a cancellation
+		// of ctx is counted in Stat.Cancels only.
+		DoCtx(ctx context.Context, req ReqCtxFunc) error
+		// DoCtxWithFallbackAcceptable is DoCtx with a fallback called when the EffectiveBreaker rejects the request.
+		// nil fallback and acceptable are ignored.
+		DoCtxWithFallbackAcceptable(ctx context.Context, req ReqCtxFunc, fallback FallbackCtxFunc, acceptable Acceptable) error
+		// SetTimeout changes the timeout of the EffectiveBreaker at runtime.
+		SetTimeout(timeout time.Duration)
+		// SetK changes the k param of the EffectiveBreaker at runtime, k <= 0 is ignored.
+		SetK(k float64)
+		// Stat returns the accepts and total requests in the rolling window, and the drops since created.
+		Stat() Stat
+		// Type returns the type of the EffectiveBreaker.
+		Type() define.BreakerType
+		// ForceOpen rejects all requests until ForceClose or Reset is called.
+		ForceOpen()
+		// ForceClose accepts all requests without statistics until ForceOpen or Reset is called.
+		ForceClose()
+		// Reset clears the statistics and the forced state.
+		Reset()
 	}
 
-	ReqFunc      func() error
-	FallbackFunc func(err error) error
-	Acceptable   func(err error) bool
+	// Stat 熔断统计 窗口内通过次数 总次数 以及累计被熔断拒绝的次数 DoCtx 被调用方取消的次数
+	// DropRatio 为下一个请求被拒绝的概率 State 为状态机熔断的状态 其他类型只在强制打开时为 open
+	Stat struct {
+		Accepts   int64
+		Total     int64
+		Drops     uint64
+		Cancels   uint64
+		DropRatio float64
+		State     State
+		Forced    bool
+	}
+
+	ReqFunc         func() error
+	FallbackFunc    func(err error) error
+	ReqCtxFunc      func(ctx context.Context) error
+	FallbackCtxFunc func(ctx context.Context, err error) error
+	Acceptable      func(err error) bool
 
 	// Option defines the method to customize a EffectiveBreaker.
 	Option func(breaker *circuitBreaker)
@@ -58,18 +108,43 @@ type (
 	internalPromise interface {
 		Accept()
 		Reject()
+		// Cancel 请求被取消 不计入统计
+		Cancel()
 	}
 
 	circuitBreaker struct {
 		name        string
 		breakerType define.BreakerType
-		timeout     time.Duration
+		//StateBreaker 参数
+		stateSettings StateSettings
+		//统计窗口 仅创建时生效
+		window     time.Duration
+		buckets    int
+		protection int64
+		//超时时间 原子读写 支持热更新
+		timeout int64
+		//SetK 设置的 k 值 float64 bits 重置后保留
+		k uint64
+		//强制状态 及强制打开期间的拒绝次数
+		forced      int32
+		forcedDrops uint64
+		cancels     uint64
+		//internHolder 重置时整体替换
+		intern atomic.Value
+	}
+
+	internHolder struct {
 		internBreaker
 	}
 
+	//强制关闭时的 promise 不统计
+	noopPromise struct{}
+
 	internBreaker interface {
 		allow() (internalPromise, error)
 		doReq(req ReqFunc, fallback FallbackFunc, acceptable Acceptable, timeout time.Duration) error
+		setK(k float64)
+		snapshot() Stat
 	}
 
 	lockedSource struct {
@@ -78,9 +153,17 @@ type (
 	}
 )
 
-var typeInitMap = map[define.BreakerType]internBreaker{
-	define.DefaultBreaker: NewGoogleBreaker(),
-	define.GoogleBreaker:  NewGoogleBreaker(),
+//每个 breaker 独立统计 这里存放构造函数
+var typeInitMap = map[define.BreakerType]func(cb *circuitBreaker) internBreaker{
+	define.DefaultBreaker: newGoogleIntern,
+	define.GoogleBreaker:  newGoogleIntern,
+	define.StateBreaker: func(cb *circuitBreaker) internBreaker {
+		return newStateBreaker(cb.name, cb.stateSettings, cb.window, cb.buckets)
+	},
+}
+
+func newGoogleIntern(cb *circuitBreaker) internBreaker {
+	return newGoogleBreaker(cb.window, cb.buckets, math.Float64frombits(atomic.LoadUint64(&cb.k)), cb.protection)
 }
 
 func (ls *lockedSource) Int63() int64 {
@@ -102,35 +185,224 @@ func (cb *circuitBreaker) Name() string {
 }
 
 func (cb *circuitBreaker) Allow() (internalPromise, error) {
-	return cb.internBreaker.allow()
+	switch atomic.LoadInt32(&cb.forced) {
+	case forceOpen:
+		atomic.AddUint64(&cb.forcedDrops, 1)
+		return nil, ErrServiceUnavailable
+	case forceClose:
+		return noopPromise{}, nil
+	}
+	return cb.getIntern().allow()
 }
 
 func (cb *circuitBreaker) Do(req ReqFunc) error {
-	return cb.internBreaker.doReq(req, nil, defaultAcceptable, cb.timeout)
+	return cb.doReq(req, nil, defaultAcceptable)
 }
 
 func (cb *circuitBreaker) DoWithAcceptable(req ReqFunc, acceptable Acceptable) error {
-	return cb.internBreaker.doReq(req, nil, acceptable, cb.timeout)
+	return cb.doReq(req, nil, acceptable)
 }
 
 func (cb *circuitBreaker) DoWithFallback(req ReqFunc, fallback FallbackFunc) error {
-	return cb.internBreaker.doReq(req, fallback, defaultAcceptable, cb.timeout)
+	return cb.doReq(req, fallback, defaultAcceptable)
 }
 
 func (cb *circuitBreaker) DoWithFallbackAcceptable(req ReqFunc, fallback FallbackFunc,
 	acceptable Acceptable) error {
-	return cb.internBreaker.doReq(req, fallback, acceptable, cb.timeout)
+	return cb.doReq(req, fallback, acceptable)
+}
+
+func (cb *circuitBreaker) doReq(req ReqFunc, fallback FallbackFunc, acceptable Acceptable) error {
+	switch atomic.LoadInt32(&cb.forced) {
+	case forceOpen:
+		atomic.AddUint64(&cb.forcedDrops, 1)
+		if fallback != nil {
+			return fallback(ErrServiceUnavailable)
+		}
+		return ErrServiceUnavailable
+	case forceClose:
+		if req == nil {
+			return errors.New("request func can not equals nil")
+		}
+		return req()
+	}
+	return cb.getIntern().doReq(req, fallback, acceptable, cb.getTimeout())
+}
+
+func (cb *circuitBreaker) DoCtx(ctx context.Context, req ReqCtxFunc) error {
+	return cb.DoCtxWithFallbackAcceptable(ctx, req, nil, nil)
+}
+
+//请求结果
+type ctxResult struct {
+	err      error
+	panicked bool
+	panic    interface{}
+	stack    []byte
+}
+
+//DoCtx 请求状态 超时返回与请求结束谁先发生
+const (
+	reqRunning   = 0
+	reqFinished  = 1
+	reqAbandoned = 2
+)
+
+func (cb *circuitBreaker) DoCtxWithFallbackAcceptable(ctx context.Context, req ReqCtxFunc, fallback FallbackCtxFunc,
+	acceptable Acceptable) error {
+	promise, err := cb.Allow()
+	if err != nil {
+		if fallback != nil {
+			return fallback(ctx, err)
+		}
+		return err
+	}
+	if req == nil {
+		promise.Cancel()
+		return errors.New("request func can not equals nil")
+	}
+	if acceptable == nil {
+		acceptable = defaultAcceptable
+	}
+
+	reqCtx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout := cb.getTimeout(); timeout > 0 {
+		reqCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+	//超时返回后 req 结束时写入 不阻塞
+	done := make(chan ctxResult, 1)
+	var state int32
+	go func() {
+		var res ctxResult
+		defer func() {
+			if e := recover(); e != nil {
+				res.panicked, res.panic, res.stack = true, e, debug.Stack()
+			}
+			if !atomic.CompareAndSwapInt32(&state, reqRunning, reqFinished) {
+				cb.logLate(ctx, res)
+				return
+			}
+			done <- res
+		}()
+		res.err = req(reqCtx)
+	}()
+
+	select {
+	case res := <-done:
+		if res.panicked {
+			promise.Reject()
+			panic(res.panic)
+		}
+		switch {
+		case res.err != nil && ctx.Err() != nil:
+			cb.cancel(promise)
+		case reqCtx.Err() == context.DeadlineExceeded:
+			promise.Reject()
+		case acceptable(res.err):
+			promise.Accept()
+		default:
+			promise.Reject()
+		}
+		return res.err
+	case <-reqCtx.Done():
+		//调用方取消不计为失败
+		if ctx.Err() != nil {
+			cb.cancel(promise)
+		} else {
+			promise.Reject()
+		}
+		//req 恰好同时结束 结果已写入 done
+		if !atomic.CompareAndSwapInt32(&state, reqRunning, reqAbandoned) {
+			cb.logLate(ctx, <-done)
+		}
+		return reqCtx.Err()
+	}
+}
+
+//超时返回后 req 才结束 只记录错误和 panic
+func (cb *circuitBreaker) logLate(ctx context.Context, res ctxResult) {
+	if res.panicked {
+		log.FromContext(ctx).Errorf("[breaker] %s request panic after timeout:%v\n%s", cb.name, res.panic, res.stack)
+	} else if res.err != nil {
+		log.FromContext(ctx).Warnf("[breaker] %s request error after timeout:%s", cb.name, res.err.Error())
+	}
+}
+
+func (cb *circuitBreaker) cancel(promise internalPromise) {
+	atomic.AddUint64(&cb.cancels, 1)
+	promise.Cancel()
+}
+
+func (cb *circuitBreaker) SetTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&cb.timeout, int64(timeout))
+}
+
+func (cb *circuitBreaker) SetK(k float64) {
+	if k > 0 {
+		atomic.StoreUint64(&cb.k, math.Float64bits(k))
+		cb.getIntern().setK(k)
+	}
+}
+
+func (cb *circuitBreaker) Stat() Stat {
+	st := cb.getIntern().snapshot()
+	st.Drops += atomic.LoadUint64(&cb.forcedDrops)
+	st.Cancels = atomic.LoadUint64(&cb.cancels)
+	switch atomic.LoadInt32(&cb.forced) {
+	case forceOpen:
+		st.State, st.DropRatio, st.Forced = StateOpen, 1, true
+	case forceClose:
+		st.State, st.DropRatio, st.Forced = StateClosed, 0, true
+	}
+	return st
+}
+
+func (cb *circuitBreaker) Type() define.BreakerType {
+	return cb.breakerType
+}
+
+func (cb *circuitBreaker) ForceOpen() {
+	atomic.StoreInt32(&cb.forced, forceOpen)
+}
+
+func (cb *circuitBreaker) ForceClose() {
+	atomic.StoreInt32(&cb.forced, forceClose)
+}
+
+//重新创建统计 保留 timeout k 参数
+func (cb *circuitBreaker) Reset() {
+	cb.intern.Store(internHolder{cb.newIntern()})
+	atomic.StoreUint64(&cb.forcedDrops, 0)
+	atomic.StoreUint64(&cb.cancels, 0)
+	atomic.StoreInt32(&cb.forced, forceNone)
+}
+
+func (cb *circuitBreaker) getIntern() internBreaker {
+	return cb.intern.Load().(internHolder).internBreaker
+}
+
+func (cb *circuitBreaker) newIntern() internBreaker {
+	newIntern, ok := typeInitMap[cb.breakerType]
+	if !ok {
+		newIntern = typeInitMap[define.DefaultBreaker]
+	}
+	return newIntern(cb)
+}
+
+func (cb *circuitBreaker) getTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&cb.timeout))
 }
 
 func NewBreaker(opts ...Option) EffectiveBreaker {
-	var b circuitBreaker
+	b := circuitBreaker{protection: -1}
 	for _, opt := range opts {
 		opt(&b)
 	}
 	if len(b.name) == 0 {
 		b.name = getRandName()
 	}
-	b.internBreaker = typeInitMap[b.breakerType]
+	b.intern.Store(internHolder{b.newIntern()})
 
 	return &b
 }
@@ -149,13 +421,59 @@ func WithBreakerType(breakerType define.BreakerType) Option {
 	}
 }
 
+// WithStateSettings returns a function to set the settings of a StateBreaker.
+func WithStateSettings(settings StateSettings) Option {
+	return func(b *circuitBreaker) {
+		b.stateSettings = settings
+	}
+}
+
+// WithWindow returns a function to set the rolling window duration of a EffectiveBreaker, default 10s.
+func WithWindow(window time.Duration) Option {
+	return func(b *circuitBreaker) {
+		b.window = window
+	}
+}
+
+// WithBuckets returns a function to set the bucket count of the rolling window, default 40.
+func WithBuckets(buckets int) Option {
+	return func(b *circuitBreaker) {
+		b.buckets = buckets
+	}
+}
+
+// WithK returns a function to set the k param of a GoogleBreaker, default 2, k <= 0 is ignored.
+func WithK(k float64) Option {
+	return func(b *circuitBreaker) {
+		if k > 0 {
+			b.k = math.Float64bits(k)
+		}
+	}
+}
+
+// WithProtection returns a function to set the protection param of a GoogleBreaker, default 2.
+func WithProtection(protection int64) Option {
+	return func(b *circuitBreaker) {
+		b.protection = protection
+	}
+}
+
 // WithTimeout returns a function to set the timeout param of a EffectiveBreaker.
 func WithTimeout(timeout time.Duration) Option {
 	return func(b *circuitBreaker) {
-		b.timeout = timeout
+		b.timeout = int64(timeout)
 	}
 }
 
+func (p noopPromise) Accept() {
+}
+
+func (p noopPromise) Reject() {
+}
+
+func (p noopPromise) Cancel() {
+}
+
 func defaultAcceptable(err error) bool {
 	return err == nil
 }
@@ -0,0 +1,34 @@
+package breaker
+
+import (
+	"github.com/jeevic/lego/components/breakers/define"
+	"testing"
+	"time"
+)
+
+func TestBreakerOptions(t *testing.T) {
+	lenient := NewBreaker(WithName("lenient"))
+	aggressive := NewBreaker(WithName("aggressive"), WithK(1), WithProtection(0))
+	_ = lenient.Do(failReq)
+	_ = aggressive.Do(failReq)
+	if st := lenient.Stat(); st.DropRatio != 0 {
+		t.Fatal("default protection should not drop after one failure", st)
+	}
+	if st := aggressive.Stat(); st.DropRatio != 0.5 {
+		t.Fatal("protection 0 should drop after one failure", st)
+	}
+}
+
+func TestBreakerWindowOptions(t *testing.T) {
+	for _, bt := range []define.BreakerType{define.GoogleBreaker, define.StateBreaker} {
+		b := NewBreaker(WithBreakerType(bt), WithWindow(100*time.Millisecond), WithBuckets(2))
+		_ = b.Do(okReq)
+		if st := b.Stat(); st.Total != 1 {
+			t.Fatal("request should be counted", bt, st)
+		}
+		time.Sleep(150 * time.Millisecond)
+		if st := b.Stat(); st.Total != 0 {
+			t.Fatal("request should expire with window", bt, st)
+		}
+	}
+}
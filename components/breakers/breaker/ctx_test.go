@@ -0,0 +1,116 @@
+package breaker
+
+import (
+	"context"
+	"github.com/jeevic/lego/components/breakers/define"
+	"testing"
+	"time"
+)
+
+func blockReq(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestDoCtxTimeout(t *testing.T) {
+	b := NewBreaker(WithTimeout(20 * time.Millisecond))
+	start := time.Now()
+	err := b.DoCtx(context.Background(), func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	if err != context.DeadlineExceeded || time.Since(start) > 500*time.Millisecond {
+		t.Fatal("DoCtx should return promptly on timeout", err, time.Since(start))
+	}
+	if st := b.Stat(); st.Total != 1 || st.Accepts != 0 || st.Cancels != 0 {
+		t.Fatal("timeout should count as failure", st)
+	}
+}
+
+func TestDoCtxCancel(t *testing.T) {
+	b := NewBreaker(WithTimeout(time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := b.DoCtx(ctx, blockReq); err != context.Canceled {
+		t.Fatal("DoCtx should return cancel error", err)
+	}
+	if st := b.Stat(); st.Total != 0 || st.Cancels != 1 {
+		t.Fatal("cancel should not count as failure", st)
+	}
+}
+
+func TestDoCtxAcceptable(t *testing.T) {
+	b := NewBreaker()
+	_ = b.DoCtx(context.Background(), func(ctx context.Context) error { return nil })
+	_ = b.DoCtxWithFallbackAcceptable(context.Background(), func(ctx context.Context) error {
+		return errStateTest
+	}, nil, func(err error) bool { return true })
+	_ = b.DoCtx(context.Background(), func(ctx context.Context) error { return errStateTest })
+	if st := b.Stat(); st.Total != 3 || st.Accepts != 2 {
+		t.Fatal("unexpected stat", st)
+	}
+}
+
+type ctxKey struct{}
+
+func TestDoCtxFallback(t *testing.T) {
+	b := NewBreaker()
+	b.ForceOpen()
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v")
+	err := b.DoCtxWithFallbackAcceptable(ctx, blockReq, func(ctx context.Context, err error) error {
+		if ctx.Value(ctxKey{}) != "v" || err != ErrServiceUnavailable {
+			t.Fatal("fallback should receive ctx and error", err)
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDoCtxPanic(t *testing.T) {
+	b := NewBreaker()
+	defer func() {
+		if e := recover(); e != "boom" {
+			t.Fatal("panic should be raised in caller", e)
+		}
+		if st := b.Stat(); st.Total != 1 || st.Accepts != 0 {
+			t.Fatal("panic should count as failure", st)
+		}
+	}()
+	_ = b.DoCtx(context.Background(), func(ctx context.Context) error {
+		panic("boom")
+	})
+}
+
+func TestDoCtxCancelReleasesProbe(t *testing.T) {
+	b := NewBreaker(WithBreakerType(define.StateBreaker), WithStateSettings(StateSettings{
+		ConsecutiveFailures: 1,
+		OpenTimeout:         10 * time.Millisecond,
+	}))
+	_ = b.Do(failReq)
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.DoCtx(ctx, blockReq); err != context.Canceled {
+		t.Fatal(err)
+	}
+	if err := b.DoCtx(context.Background(), func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatal("cancelled probe should be released", err)
+	}
+	if st := b.Stat(); st.State != StateClosed {
+		t.Fatal("probe should close breaker", st)
+	}
+}
+
+func TestDoTimeoutClassification(t *testing.T) {
+	b := NewBreaker(WithTimeout(50 * time.Millisecond))
+	_ = b.Do(okReq)
+	_ = b.Do(func() error {
+		time.Sleep(60 * time.Millisecond)
+		return nil
+	})
+	if st := b.Stat(); st.Total != 2 || st.Accepts != 1 {
+		t.Fatal("only slow request should count as failure", st)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"errors"
 	"github.com/jeevic/lego/components/breakers/utils"
 	"math"
+	"sync/atomic"
 	"time"
 )
 
+// 默认值 可通过 WithWindow WithBuckets WithK WithProtection 按 breaker 设置
 const (
 	// 250ms for bucket duration
 	window  = time.Second * 10
@@ -27,40 +29,78 @@ type (
 	// googleBreaker is a netflixBreaker pattern from google.
 	// see Client-Side Throttling section in https://landing.google.com/sre/sre-book/chapters/handling-overload/
 	googleBreaker struct {
-		k     float64
-		stat  RollingWindow
-		proba utils.Proba
+		//k 值 float64 bits 原子读写 支持热更新
+		k          uint64
+		protection int64
+		stat       *RollingWindow
+		proba      utils.Proba
+		//累计拒绝次数
+		drops uint64
 	}
 )
 
 func NewGoogleBreaker() *googleBreaker {
-	bucketDuration := time.Duration(int64(window) / int64(buckets))
-	st := *NewRollingWindow(buckets, bucketDuration)
+	return newGoogleBreaker(window, buckets, k, protection)
+}
+
+//参数小于等于 0 时使用默认值 protection 可以为 0
+func newGoogleBreaker(w time.Duration, n int, kv float64, p int64) *googleBreaker {
+	if kv <= 0 {
+		kv = k
+	}
+	if p < 0 {
+		p = protection
+	}
 	return &googleBreaker{
-		stat:  st,
-		k:     k,
-		proba: *utils.NewProba(),
+		stat:       newRollingWindow(w, n),
+		k:          math.Float64bits(kv),
+		protection: p,
+		proba:      *utils.NewProba(),
 	}
 }
 
-func (b *googleBreaker) accept() error {
-	accepts, total := b.history()
-	weightedAccepts := b.k * float64(accepts)
+//window 时长内 n 个 bucket
+func newRollingWindow(w time.Duration, n int) *RollingWindow {
+	if w <= 0 {
+		w = window
+	}
+	if n <= 0 {
+		n = buckets
+	}
+	return NewRollingWindow(n, time.Duration(int64(w)/int64(n)))
+}
+
+func (b *googleBreaker) dropRatio(accepts, total int64) float64 {
+	weightedAccepts := b.getK() * float64(accepts)
 	// https://landing.google.com/sre/sre-book/chapters/handling-overload/#eq2101
 	// 算法熔断概率： (requests-k*accepts)/(requests + 1)
 	// 改进增加了一个protection，防止熔断器过快的启动并且熔断几率增加过快
-	dropRatio := math.Max(0, (float64(total-protection)-weightedAccepts)/float64(total+1))
+	return math.Max(0, (float64(total-b.protection)-weightedAccepts)/float64(total+1))
+}
+
+func (b *googleBreaker) accept() error {
+	accepts, total := b.history()
+	dropRatio := b.dropRatio(accepts, total)
 	//todo debug: print the probability of fusing
 	//fmt.Printf("====接受次数：%v k*accept = %v，总次数：%v，熔断概率：%.2f====", accepts,b.k * float64(accepts), total, dropRatio)
 	if dropRatio <= 0 {
 		return nil
 	}
 	if b.proba.TrueOnProba(dropRatio) {
+		atomic.AddUint64(&b.drops, 1)
 		return ErrServiceUnavailable
 	}
 	return nil
 }
 
+func (b *googleBreaker) setK(k float64) {
+	atomic.StoreUint64(&b.k, math.Float64bits(k))
+}
+
+func (b *googleBreaker) getK() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&b.k))
+}
+
 func (b *googleBreaker) allow() (internalPromise, error) {
 	if err := b.accept(); err != nil {
 		return nil, err
@@ -92,7 +132,7 @@ func (b *googleBreaker) doReq(req ReqFunc, fallback FallbackFunc, acceptable Acc
 	}
 	err := req()
 	// 没有出现timeout并且错误时可以接受的错误
-	if !(timeout != 0 && time.Since(beforeExec) < timeout) && acceptable(err) {
+	if !(timeout > 0 && time.Since(beforeExec) > timeout) && acceptable(err) {
 		b.markSuccess()
 	} else {
 		b.markFailure()
@@ -108,8 +148,18 @@ func (b *googleBreaker) markFailure() {
 	b.stat.Add(0)
 }
 
+func (b *googleBreaker) snapshot() Stat {
+	accepts, total := b.history()
+	return Stat{Accepts: accepts, Total: total, Drops: atomic.LoadUint64(&b.drops), DropRatio: b.dropRatio(accepts, total)}
+}
+
 func (b *googleBreaker) history() (accepts, total int64) {
-	b.stat.Reduce(func(b *Bucket) {
+	return windowHistory(b.stat)
+}
+
+//窗口内成功次数 总次数
+func windowHistory(rw *RollingWindow) (accepts, total int64) {
+	rw.Reduce(func(b *Bucket) {
 		accepts += int64(b.Sum)
 		total += b.Count
 	})
@@ -128,3 +178,6 @@ func (p googlePromise) Accept() {
 func (p googlePromise) Reject() {
 	p.b.markFailure()
 }
+
+func (p googlePromise) Cancel() {
+}
@@ -0,0 +1,295 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//状态机熔断 closed open half-open 参考 hystrix sony/gobreaker
+//closed: 连续失败次数或窗口内错误率达到阈值时 open
+//open: 拒绝全部请求 OpenTimeout 后进入 half-open
+//half-open: 放行 HalfOpenProbes 个探测请求 全部成功 closed 任一失败 open
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+type (
+	// State 熔断器状态
+	State int32
+
+	// StateSettings 状态机熔断参数 零值使用默认值
+	StateSettings struct {
+		//连续失败次数阈值 小于 0 不启用
+		ConsecutiveFailures int64 `mapstructure:"consecutive_failures" default:"5"`
+		//窗口内错误率阈值 (0,1] 小于 0 不启用
+		ErrorRate float64 `mapstructure:"error_rate" default:"0.5"`
+		//窗口内请求数达到后才计算错误率
+		MinRequests int64 `mapstructure:"min_requests" default:"20"`
+		//open 持续时间
+		OpenTimeout time.Duration `mapstructure:"open_timeout" default:"5s"`
+		//half-open 探测请求数
+		HalfOpenProbes int64 `mapstructure:"half_open_probes" default:"1"`
+		//状态变化回调 不持有锁 不要阻塞
+		OnStateChange func(name string, from, to State) `mapstructure:"-"`
+	}
+
+	stateBreaker struct {
+		name     string
+		settings StateSettings
+		mutex    sync.Mutex
+		state    State
+		//状态切换时递增 丢弃上一状态的请求结果
+		generation  uint64
+		consecutive int64
+		stat        *RollingWindow
+		window      time.Duration
+		buckets     int
+		openUntil   time.Time
+		probes      int64
+		successes   int64
+		drops       uint64
+	}
+
+	statePromise struct {
+		b          *stateBreaker
+		generation uint64
+	}
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+func newStateSettings(s StateSettings) StateSettings {
+	if s.ConsecutiveFailures == 0 {
+		s.ConsecutiveFailures = 5
+	}
+	if s.ErrorRate == 0 {
+		s.ErrorRate = 0.5
+	}
+	if s.MinRequests <= 0 {
+		s.MinRequests = 20
+	}
+	if s.OpenTimeout <= 0 {
+		s.OpenTimeout = 5 * time.Second
+	}
+	if s.HalfOpenProbes <= 0 {
+		s.HalfOpenProbes = 1
+	}
+	return s
+}
+
+func NewStateBreaker(name string, settings StateSettings) *stateBreaker {
+	return newStateBreaker(name, settings, window, buckets)
+}
+
+//错误率统计窗口 window 时长内 n 个 bucket
+func newStateBreaker(name string, settings StateSettings, w time.Duration, n int) *stateBreaker {
+	return &stateBreaker{
+		name:     name,
+		settings: newStateSettings(settings),
+		stat:     newRollingWindow(w, n),
+		window:   w,
+		buckets:  n,
+	}
+}
+
+// State 当前状态 open 超时后返回 half-open
+func (b *stateBreaker) State() State {
+	b.mutex.Lock()
+	state, change := b.currentState(time.Now())
+	b.mutex.Unlock()
+	b.notify(change)
+	return state
+}
+
+//状态变化 from == to 表示未变化
+type stateChange struct {
+	from, to State
+}
+
+func (b *stateBreaker) notify(c stateChange) {
+	if c.from != c.to && b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(b.name, c.from, c.to)
+	}
+}
+
+//需持有锁
+func (b *stateBreaker) currentState(now time.Time) (State, stateChange) {
+	if b.state == StateOpen && !now.Before(b.openUntil) {
+		return StateHalfOpen, b.setState(StateHalfOpen, now)
+	}
+	return b.state, stateChange{b.state, b.state}
+}
+
+//需持有锁
+func (b *stateBreaker) setState(state State, now time.Time) stateChange {
+	c := stateChange{b.state, state}
+	if b.state == state {
+		return c
+	}
+	b.state = state
+	b.generation++
+	b.consecutive, b.probes, b.successes = 0, 0, 0
+	switch state {
+	case StateClosed:
+		b.stat = newRollingWindow(b.window, b.buckets)
+	case StateOpen:
+		b.openUntil = now.Add(b.settings.OpenTimeout)
+	}
+	return c
+}
+
+//返回请求所属的 generation
+func (b *stateBreaker) accept() (uint64, error) {
+	b.mutex.Lock()
+	state, change := b.currentState(time.Now())
+	var err error
+	switch state {
+	case StateOpen:
+		err = ErrServiceUnavailable
+	case StateHalfOpen:
+		if b.probes >= b.settings.HalfOpenProbes {
+			err = ErrServiceUnavailable
+		} else {
+			b.probes++
+		}
+	}
+	generation := b.generation
+	b.mutex.Unlock()
+	b.notify(change)
+	if err != nil {
+		atomic.AddUint64(&b.drops, 1)
+	}
+	return generation, err
+}
+
+func (b *stateBreaker) mark(generation uint64, success bool) {
+	b.mutex.Lock()
+	now := time.Now()
+	state, change := b.currentState(now)
+	if generation == b.generation {
+		switch state {
+		case StateClosed:
+			b.markClosed(success, now, &change)
+		case StateHalfOpen:
+			if !success {
+				change.to = b.setState(StateOpen, now).to
+			} else if b.successes++; b.successes >= b.settings.HalfOpenProbes {
+				change.to = b.setState(StateClosed, now).to
+			}
+		}
+	}
+	b.mutex.Unlock()
+	b.notify(change)
+}
+
+//需持有锁
+func (b *stateBreaker) markClosed(success bool, now time.Time, change *stateChange) {
+	if success {
+		b.stat.Add(1)
+		b.consecutive = 0
+		return
+	}
+	b.stat.Add(0)
+	b.consecutive++
+	if b.settings.ConsecutiveFailures > 0 && b.consecutive >= b.settings.ConsecutiveFailures {
+		change.to = b.setState(StateOpen, now).to
+		return
+	}
+	if b.settings.ErrorRate <= 0 {
+		return
+	}
+	accepts, total := windowHistory(b.stat)
+	if total >= b.settings.MinRequests && float64(total-accepts)/float64(total) >= b.settings.ErrorRate {
+		change.to = b.setState(StateOpen, now).to
+	}
+}
+
+//释放 half-open 探测名额 不计入统计
+func (b *stateBreaker) release(generation uint64) {
+	b.mutex.Lock()
+	if generation == b.generation && b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+	b.mutex.Unlock()
+}
+
+func (b *stateBreaker) allow() (internalPromise, error) {
+	generation, err := b.accept()
+	if err != nil {
+		return nil, err
+	}
+	return statePromise{b: b, generation: generation}, nil
+}
+
+func (b *stateBreaker) doReq(req ReqFunc, fallback FallbackFunc, acceptable Acceptable, timeout time.Duration) error {
+	generation, err := b.accept()
+	if err != nil {
+		if fallback != nil {
+			return fallback(err)
+		}
+		return err
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			b.mark(generation, false)
+			panic(e)
+		}
+	}()
+
+	beforeExec := time.Now()
+	if req == nil {
+		return errors.New("request func can not equals nil")
+	}
+	err = req()
+	//超时计为失败
+	b.mark(generation, !(timeout > 0 && time.Since(beforeExec) > timeout) && acceptable(err))
+	return err
+}
+
+//状态机熔断不使用 k
+func (b *stateBreaker) setK(k float64) {
+}
+
+//open 及探测请求已满的 half-open 拒绝下一个请求
+func (b *stateBreaker) snapshot() Stat {
+	b.mutex.Lock()
+	state, change := b.currentState(time.Now())
+	stat := b.stat
+	dropRatio := 0.0
+	if state == StateOpen || (state == StateHalfOpen && b.probes >= b.settings.HalfOpenProbes) {
+		dropRatio = 1
+	}
+	b.mutex.Unlock()
+	b.notify(change)
+	accepts, total := windowHistory(stat)
+	return Stat{Accepts: accepts, Total: total, Drops: atomic.LoadUint64(&b.drops), DropRatio: dropRatio, State: state}
+}
+
+func (p statePromise) Accept() {
+	p.b.mark(p.generation, true)
+}
+
+func (p statePromise) Reject() {
+	p.b.mark(p.generation, false)
+}
+
+func (p statePromise) Cancel() {
+	p.b.release(p.generation)
+}
@@ -0,0 +1,139 @@
+package breaker
+
+import (
+	"errors"
+	"github.com/jeevic/lego/components/breakers/define"
+	"testing"
+	"time"
+)
+
+var errStateTest = errors.New("state test error")
+
+func failReq() error {
+	return errStateTest
+}
+
+func okReq() error {
+	return nil
+}
+
+func TestStateBreakerConsecutiveFailures(t *testing.T) {
+	var changes []State
+	b := NewStateBreaker("consecutive", StateSettings{
+		ConsecutiveFailures: 3,
+		ErrorRate:           -1,
+		OpenTimeout:         50 * time.Millisecond,
+		HalfOpenProbes:      2,
+		OnStateChange: func(name string, from, to State) {
+			changes = append(changes, to)
+		},
+	})
+	for i := 0; i < 3; i++ {
+		if err := b.doReq(failReq, nil, defaultAcceptable, 0); err != errStateTest {
+			t.Fatal("request should run before open", err)
+		}
+	}
+	if b.State() != StateOpen {
+		t.Fatal("breaker should open after consecutive failures", b.State())
+	}
+	if err := b.doReq(okReq, nil, defaultAcceptable, 0); err != ErrServiceUnavailable {
+		t.Fatal("open breaker should reject", err)
+	}
+	fallback := b.doReq(okReq, func(err error) error { return nil }, defaultAcceptable, 0)
+	if fallback != nil {
+		t.Fatal("fallback should be called", fallback)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if b.State() != StateHalfOpen {
+		t.Fatal("breaker should be half-open after open timeout", b.State())
+	}
+	p1, err := b.allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := b.allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.allow(); err != ErrServiceUnavailable {
+		t.Fatal("half-open breaker should limit probes", err)
+	}
+	p1.Accept()
+	if b.State() != StateHalfOpen {
+		t.Fatal("breaker should wait for all probes", b.State())
+	}
+	p2.Accept()
+	if b.State() != StateClosed {
+		t.Fatal("breaker should close after probes succeed", b.State())
+	}
+	expect := []State{StateOpen, StateHalfOpen, StateClosed}
+	if len(changes) != len(expect) {
+		t.Fatal("unexpected state changes", changes)
+	}
+	for i := range expect {
+		if changes[i] != expect[i] {
+			t.Fatal("unexpected state changes", changes)
+		}
+	}
+	if b.snapshot().Drops != 3 {
+		t.Fatal("unexpected drops", b.snapshot().Drops)
+	}
+}
+
+func TestStateBreakerHalfOpenFailure(t *testing.T) {
+	b := NewStateBreaker("half-open", StateSettings{ConsecutiveFailures: 1, OpenTimeout: 10 * time.Millisecond})
+	_ = b.doReq(failReq, nil, defaultAcceptable, 0)
+	time.Sleep(20 * time.Millisecond)
+	_ = b.doReq(failReq, nil, defaultAcceptable, 0)
+	if b.State() != StateOpen {
+		t.Fatal("failed probe should open breaker", b.State())
+	}
+}
+
+func TestStateBreakerErrorRate(t *testing.T) {
+	b := NewStateBreaker("error-rate", StateSettings{ConsecutiveFailures: -1, ErrorRate: 0.5, MinRequests: 10})
+	for i := 0; i < 8; i++ {
+		_ = b.doReq(okReq, nil, defaultAcceptable, 0)
+		_ = b.doReq(failReq, nil, defaultAcceptable, 0)
+		if i < 4 && b.State() != StateClosed {
+			t.Fatal("breaker should not open below min requests", i)
+		}
+	}
+	if b.State() != StateOpen {
+		t.Fatal("breaker should open when error rate reached", b.State())
+	}
+}
+
+func TestStateBreakerStaleResult(t *testing.T) {
+	b := NewStateBreaker("stale", StateSettings{ConsecutiveFailures: 1, OpenTimeout: time.Hour})
+	p, err := b.allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = b.doReq(failReq, nil, defaultAcceptable, 0)
+	//open 之前发出的请求结果不影响当前状态
+	p.Accept()
+	if b.State() != StateOpen {
+		t.Fatal("stale result should be ignored", b.State())
+	}
+}
+
+func TestStateBreakerTimeout(t *testing.T) {
+	b := NewStateBreaker("timeout", StateSettings{ConsecutiveFailures: 1})
+	_ = b.doReq(func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}, nil, defaultAcceptable, 10*time.Millisecond)
+	if b.State() != StateOpen {
+		t.Fatal("slow request should count as failure", b.State())
+	}
+}
+
+func TestNewBreakerWithStateType(t *testing.T) {
+	b := NewBreaker(WithName("state"), WithBreakerType(define.StateBreaker), WithStateSettings(StateSettings{ConsecutiveFailures: 1}))
+	_ = b.Do(failReq)
+	if err := b.Do(okReq); err != ErrServiceUnavailable {
+		t.Fatal("state breaker should be built by type", err)
+	}
+}
@@ -1,6 +1,7 @@
 package breakers
 
 import (
+	"context"
 	"github.com/jeevic/lego/components/breakers/breaker"
 	"github.com/jeevic/lego/components/breakers/define"
 	"sync"
@@ -16,7 +17,11 @@ type Breaker struct {
 	name          string
 	timeout       time.Duration
 	breakerType   define.BreakerType
+	stateSettings breaker.StateSettings
+	//窗口 k protection 等 仅创建时生效
+	options       []breaker.Option
 	fallback      breaker.FallbackFunc
+	fallbackCtx   breaker.FallbackCtxFunc
 	acceptable    breaker.Acceptable
 	activeBreaker breaker.EffectiveBreaker
 }
@@ -30,6 +35,12 @@ func (ob *Breaker) WithFallback(fallback breaker.FallbackFunc) *Breaker {
 	return ob
 }
 
+// DoCtx 使用的 fallback 未设置时使用 WithFallback 的设置
+func (ob *Breaker) WithFallbackCtx(fallback breaker.FallbackCtxFunc) *Breaker {
+	ob.fallbackCtx = fallback
+	return ob
+}
+
 func (ob *Breaker) WithAcceptable(acceptable breaker.Acceptable) *Breaker {
 	ob.acceptable = acceptable
 	return ob
@@ -45,6 +56,36 @@ func (ob *Breaker) WithBreakerType(bt define.BreakerType) *Breaker {
 	return ob
 }
 
+// 统计窗口时长 默认 10s 仅创建时生效
+func (ob *Breaker) WithWindow(window time.Duration) *Breaker {
+	ob.options = append(ob.options, breaker.WithWindow(window))
+	return ob
+}
+
+// 统计窗口 bucket 数 默认 40 仅创建时生效
+func (ob *Breaker) WithBuckets(buckets int) *Breaker {
+	ob.options = append(ob.options, breaker.WithBuckets(buckets))
+	return ob
+}
+
+// GoogleBreaker 的 k 值 默认 2 越小越激进 仅创建时生效 运行时修改用 SetK
+func (ob *Breaker) WithK(k float64) *Breaker {
+	ob.options = append(ob.options, breaker.WithK(k))
+	return ob
+}
+
+// GoogleBreaker 不参与计算的失败次数 默认 2 越大越宽松 仅创建时生效
+func (ob *Breaker) WithProtection(protection int64) *Breaker {
+	ob.options = append(ob.options, breaker.WithProtection(protection))
+	return ob
+}
+
+// StateBreaker 的参数 仅创建时生效
+func (ob *Breaker) WithStateSettings(settings breaker.StateSettings) *Breaker {
+	ob.stateSettings = settings
+	return ob
+}
+
 func (ob *Breaker) GetOrBuild(name string) *Breaker {
 	lock.RLock()
 	bk, ok := breakers[name]
@@ -59,13 +100,54 @@ func (ob *Breaker) GetOrBuild(name string) *Breaker {
 	defer lock.Unlock()
 	bk, ok = breakers[name]
 	if !ok {
-		bk = breaker.NewBreaker(breaker.WithName(name), breaker.WithTimeout(ob.timeout), breaker.WithBreakerType(ob.breakerType))
+		opts := append([]breaker.Option{breaker.WithName(name), breaker.WithTimeout(ob.timeout), breaker.WithBreakerType(ob.breakerType),
+			breaker.WithStateSettings(ob.stateSettings)}, ob.options...)
+		bk = breaker.NewBreaker(opts...)
 		breakers[name] = bk
 		ob.activeBreaker = bk
 	}
 	return ob
 }
 
+// 获取已创建的 breaker
+func Get(name string) (breaker.EffectiveBreaker, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+	bk, ok := breakers[name]
+	return bk, ok
+}
+
+// 遍历已创建的 breaker
+func Range(f func(name string, bk breaker.EffectiveBreaker)) {
+	lock.RLock()
+	all := make(map[string]breaker.EffectiveBreaker, len(breakers))
+	for name, bk := range breakers {
+		all[name] = bk
+	}
+	lock.RUnlock()
+	for name, bk := range all {
+		f(name, bk)
+	}
+}
+
+// 运行时修改已创建 breaker 的超时时间 用于配置热加载
+func SetTimeout(name string, timeout time.Duration) bool {
+	bk, ok := Get(name)
+	if ok {
+		bk.SetTimeout(timeout)
+	}
+	return ok
+}
+
+// 运行时修改已创建 breaker 的 k 值 用于配置热加载
+func SetK(name string, k float64) bool {
+	bk, ok := Get(name)
+	if ok {
+		bk.SetK(k)
+	}
+	return ok
+}
+
 func (ob *Breaker) Do(req breaker.ReqFunc) error {
 	if ob.activeBreaker == nil {
 		// 未初始化如果直接使用
@@ -80,3 +162,18 @@ func (ob *Breaker) Do(req breaker.ReqFunc) error {
 	}
 	return ob.activeBreaker.Do(req)
 }
+
+// 带 context 执行 超过 timeout 时取消 req 的 context 并立即返回 调用方取消不计为失败
+func (ob *Breaker) DoCtx(ctx context.Context, req breaker.ReqCtxFunc) error {
+	if ob.activeBreaker == nil {
+		// 未初始化如果直接使用
+		ob.activeBreaker = breaker.NewBreaker(breaker.WithTimeout(ob.timeout))
+	}
+	fallback := ob.fallbackCtx
+	if fallback == nil && ob.fallback != nil {
+		fallback = func(ctx context.Context, err error) error {
+			return ob.fallback(err)
+		}
+	}
+	return ob.activeBreaker.DoCtxWithFallbackAcceptable(ctx, req, fallback, ob.acceptable)
+}
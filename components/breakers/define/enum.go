@@ -3,6 +3,21 @@ package define
 const (
 	DefaultBreaker BreakerType = iota
 	GoogleBreaker
+	//closed open half-open 状态机熔断
+	StateBreaker
 )
 
 type BreakerType int
+
+func (t BreakerType) String() string {
+	switch t {
+	case DefaultBreaker:
+		return "default"
+	case GoogleBreaker:
+		return "google"
+	case StateBreaker:
+		return "state"
+	default:
+		return "unknown"
+	}
+}
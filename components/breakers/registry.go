@@ -0,0 +1,82 @@
+package breakers
+
+import (
+	"github.com/jeevic/lego/components/breakers/breaker"
+	"sort"
+)
+
+// 熔断器状态 用于管理接口
+type Info struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	State     string  `json:"state"`
+	Forced    bool    `json:"forced"`
+	Accepts   int64   `json:"accepts"`
+	Total     int64   `json:"total"`
+	Drops     uint64  `json:"drops"`
+	Cancels   uint64  `json:"cancels"`
+	DropRatio float64 `json:"drop_ratio"`
+}
+
+func newInfo(name string, bk breaker.EffectiveBreaker) Info {
+	st := bk.Stat()
+	return Info{
+		Name:      name,
+		Type:      bk.Type().String(),
+		State:     st.State.String(),
+		Forced:    st.Forced,
+		Accepts:   st.Accepts,
+		Total:     st.Total,
+		Drops:     st.Drops,
+		Cancels:   st.Cancels,
+		DropRatio: st.DropRatio,
+	}
+}
+
+// 列出已创建的 breaker 按名称排序
+func List() []Info {
+	infos := make([]Info, 0)
+	Range(func(name string, bk breaker.EffectiveBreaker) {
+		infos = append(infos, newInfo(name, bk))
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// 查看指定 breaker
+func Inspect(name string) (Info, bool) {
+	bk, ok := Get(name)
+	if !ok {
+		return Info{}, false
+	}
+	return newInfo(name, bk), true
+}
+
+// 强制打开 拒绝全部请求 直到 ForceClose 或 Reset
+func ForceOpen(name string) bool {
+	bk, ok := Get(name)
+	if ok {
+		bk.ForceOpen()
+	}
+	return ok
+}
+
+// 强制关闭 放行全部请求且不统计 直到 ForceOpen 或 Reset
+func ForceClose(name string) bool {
+	bk, ok := Get(name)
+	if ok {
+		bk.ForceClose()
+	}
+	return ok
+}
+
+// 清空统计 取消强制状态
+func Reset(name string) bool {
+	bk, ok := Get(name)
+	if ok {
+		bk.Reset()
+	}
+	return ok
+}
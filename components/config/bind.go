@@ -0,0 +1,185 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+
+	"github.com/jeevic/lego/components/validation"
+)
+
+//配置绑定到结构体
+//tag:
+//	mapstructure 配置key 未设置时使用字段名小写 "-" 跳过
+//	default 默认值 配置不存在时使用
+//	valid 校验规则 @see components/validation
+//time.Duration 支持 "30s" "1m" 写法 数字按秒处理
+//usage:
+//	type HttpSetting struct {
+//		Host    string        `mapstructure:"http_host" valid:"Required"`
+//		Port    int           `mapstructure:"http_port" default:"8080" valid:"Range(1,65535)"`
+//		Timeout time.Duration `mapstructure:"timeout" default:"30s"`
+//	}
+//	var s HttpSetting
+//	if err := cf.Bind("httpserver", &s); err != nil {
+//		var be *config.BindError
+//		if errors.As(err, &be) {
+//			fmt.Println(be.Keys())
+//		}
+//	}
+
+const (
+	TagKey     = "mapstructure"
+	TagDefault = "default"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+//校验失败的配置项
+type InvalidKey struct {
+	Key     string
+	Message string
+}
+
+//配置绑定错误 包含全部校验失败的配置项
+type BindError struct {
+	Prefix  string
+	Invalid []InvalidKey
+}
+
+func (e *BindError) Error() string {
+	items := make([]string, 0, len(e.Invalid))
+	for _, ik := range e.Invalid {
+		items = append(items, fmt.Sprintf("%s(%s)", ik.Key, ik.Message))
+	}
+	return fmt.Sprintf("config bind prefix:%s invalid keys:%s", e.Prefix, strings.Join(items, ", "))
+}
+
+//校验失败的 key 列表
+func (e *BindError) Keys() []string {
+	keys := make([]string, 0, len(e.Invalid))
+	for _, ik := range e.Invalid {
+		keys = append(keys, ik.Key)
+	}
+	return keys
+}
+
+//绑定配置 prefix 为配置前缀 如 grpcserver 为空时绑定根配置
+//out 必须为结构体指针
+func (c *Config) Bind(prefix string, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New(fmt.Sprintf("config bind prefix:%s out must be a struct pointer", prefix))
+	}
+	be := &BindError{Prefix: prefix}
+	c.bindStruct(c.Viper(), prefix, v.Elem(), be)
+	if len(be.Invalid) > 0 {
+		return be
+	}
+	return nil
+}
+
+//逐字段解析 校验
+func (c *Config) bindStruct(handler *viper.Viper, prefix string, v reflect.Value, be *BindError) {
+	t := v.Type()
+	//字段名 => 配置key 用于校验错误定位
+	fieldKeys := make(map[string]string, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		//未导出字段
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+		name := fieldKey(f)
+		if name == "-" {
+			continue
+		}
+		key := name
+		if len(prefix) > 0 {
+			key = prefix + "." + name
+		}
+		fieldKeys[f.Name] = key
+
+		fv := v.Field(i)
+		if f.Type.Kind() == reflect.Struct && f.Type != timeType {
+			c.bindStruct(handler, key, fv, be)
+			continue
+		}
+
+		var raw interface{}
+		if handler.IsSet(key) {
+			raw = handler.Get(key)
+		} else if def, ok := f.Tag.Lookup(TagDefault); ok {
+			raw = def
+		} else {
+			continue
+		}
+		if err := decode(raw, fv.Addr().Interface()); err != nil {
+			be.Invalid = append(be.Invalid, InvalidKey{Key: key, Message: err.Error()})
+		}
+	}
+
+	valid := validation.Validation{}
+	if _, err := valid.Valid(v.Addr().Interface()); err != nil {
+		be.Invalid = append(be.Invalid, InvalidKey{Key: prefix, Message: err.Error()})
+		return
+	}
+	for _, e := range valid.Errors {
+		key, ok := fieldKeys[e.Field]
+		if !ok {
+			key = prefix
+		}
+		be.Invalid = append(be.Invalid, InvalidKey{Key: key, Message: e.Message})
+	}
+}
+
+//配置 key 名称
+func fieldKey(f reflect.StructField) string {
+	tag := f.Tag.Get(TagKey)
+	if name := strings.Split(tag, ",")[0]; len(name) > 0 {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
+
+//弱类型解析 支持字符串转数字 bool slice duration
+func decode(raw interface{}, out interface{}) error {
+	d, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			durationHook,
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		WeaklyTypedInput: true,
+		Result:           out,
+	})
+	if err != nil {
+		return err
+	}
+	return d.Decode(raw)
+}
+
+//time.Duration 解析 字符串按 time.ParseDuration 数字按秒
+func durationHook(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if t != durationType {
+		return data, nil
+	}
+	switch d := data.(type) {
+	case string:
+		return time.ParseDuration(strings.TrimSpace(d))
+	case int:
+		return time.Duration(d) * time.Second, nil
+	case int64:
+		return time.Duration(d) * time.Second, nil
+	case float64:
+		return time.Duration(d * float64(time.Second)), nil
+	}
+	return data, nil
+}
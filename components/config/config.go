@@ -3,8 +3,13 @@ package config
 import (
 	"bytes"
 	"errors"
+	"flag"
 	"fmt"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -18,7 +23,12 @@ import (
 //	if err != nil {
 //
 //	}
-//	cf.Handler.Get("log")
+//	cf.Viper().Get("log")
+//
+//	listen config change, fired on file write and Reload():
+//	cf.OnChange("log.level", func(old, new interface{}) {
+//		fmt.Println(old, new)
+//	})
 
 const (
 	//配置类型
@@ -29,8 +39,30 @@ const (
 //图片配置信息
 type Config struct {
 	Setting Setting
-	//句柄
+	//创建时的句柄 zk 配置变更后替换为新的 viper 使用 Viper() 读取当前配置
 	Handler *viper.Viper
+	//当前句柄 *viper.Viper
+	handler atomic.Value
+
+	mutex     sync.Mutex
+	listeners []*listener
+	//环境文件 命令行参数提供的 key
+	envKeys  map[string]bool
+	flagKeys map[string]bool
+	//远程配置源
+	zk *zkSource
+	//文件监听
+	watcher *fsnotify.Watcher
+}
+
+//配置变更回调 old new 为变更前后 key 对应的值 未配置时为nil
+type ChangeFunc func(old, new interface{})
+
+//配置变更监听
+type listener struct {
+	key  string
+	last interface{}
+	f    ChangeFunc
 }
 
 //配置设置
@@ -39,20 +71,23 @@ type Setting struct {
 	Type string
 	//文件类型 json toml yaml, hcl,
 	Format string
-	//文件地址
+	//文件地址 zk 配置为节点路径
 	Filename string
+	//环境名称 develop test perf prod
+	Env string
+	//环境变量前缀
+	EnvPrefix string
+	//命令行参数
+	Flags *flag.FlagSet
 }
 
 //解析配置文件
 // t  JSON, TOML, YAML, HCL, INI 文件类型
 // filename 文件
-func NewConfig(filename string) (*Config, error) {
+// opts 分层加载 环境文件 环境变量 命令行参数
+func NewConfig(filename string, opts ...Option) (*Config, error) {
 	v := viper.New()
 	v.SetConfigFile(filename)
-	err := v.ReadInConfig()
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("new config error! filename:%s error:%s", filename, err.Error()))
-	}
 
 	c := new(Config)
 	setting := Setting{}
@@ -62,8 +97,15 @@ func NewConfig(filename string) (*Config, error) {
 	}
 	setting.Filename = filename
 	setting.Type = TypeFile
+	for _, opt := range opts {
+		opt(&setting)
+	}
 	c.Setting = setting
-	c.Handler = v
+
+	if err := c.read(v); err != nil {
+		return nil, errors.New(fmt.Sprintf("new config error! filename:%s error:%s", filename, err.Error()))
+	}
+	c.init(v)
 	return c, nil
 }
 
@@ -80,17 +122,145 @@ func NewConfigData(format string, data []byte) (*Config, error) {
 	setting.Type = TypeData
 	setting.Format = format
 	c.Setting = setting
-	c.Handler = v
+	c.init(v)
 
 	return c, nil
 }
 
-//监听配置变化从新读取
+//设置句柄 绑定环境变量和命令行参数
+func (c *Config) init(v *viper.Viper) {
+	c.flagKeys = make(map[string]bool)
+	if c.Setting.Flags != nil {
+		c.Setting.Flags.Visit(func(f *flag.Flag) {
+			c.flagKeys[strings.ToLower(f.Name)] = true
+		})
+	}
+	c.bindOverrides(v)
+	c.Handler = v
+	c.handler.Store(v)
+}
+
+//当前配置句柄 zk 配置变更时整体替换 读取时无需加锁
+func (c *Config) Viper() *viper.Viper {
+	return c.handler.Load().(*viper.Viper)
+}
+
+//监听基础文件与环境文件 任一变化时重新读取并通知监听者
+//按目录监听 兼容编辑器替换文件与 k8s configmap 软链切换 Close 停止监听
 func (c *Config) WatchReConfig() {
-	c.Handler.WatchConfig()
-	c.Handler.OnConfigChange(func(in fsnotify.Event) {
-		if in.Op.String() == "CREATE" {
-			_ = c.Handler.ReadInConfig()
+	if c.Setting.Type != TypeFile {
+		return
+	}
+	files := []string{filepath.Clean(c.Setting.Filename)}
+	if len(c.Setting.Env) > 0 {
+		files = append(files, filepath.Clean(EnvFilename(c.Setting.Filename, c.Setting.Env)))
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return
+	}
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		if dir := filepath.Dir(f); !dirs[dir] {
+			dirs[dir] = true
+			if err := watcher.Add(dir); err != nil {
+				_ = watcher.Close()
+				return
+			}
 		}
-	})
+	}
+	c.mutex.Lock()
+	c.watcher = watcher
+	c.mutex.Unlock()
+	go c.watchFiles(watcher, files)
+}
+
+func (c *Config) watchFiles(watcher *fsnotify.Watcher, files []string) {
+	//软链指向的真实文件 变化时视为修改
+	reals := make(map[string]string, len(files))
+	for _, f := range files {
+		reals[f], _ = filepath.EvalSymlinks(f)
+	}
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			changed := false
+			for _, f := range files {
+				real, _ := filepath.EvalSymlinks(f)
+				if filepath.Clean(event.Name) == f && event.Op&(fsnotify.Write|fsnotify.Create) != 0 || real != reals[f] {
+					reals[f] = real
+					changed = true
+				}
+			}
+			if changed {
+				_ = c.Reload()
+			}
+		case _, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+//停止监听 zk 节点与配置文件
+func (c *Config) Close() {
+	c.mutex.Lock()
+	if c.watcher != nil {
+		_ = c.watcher.Close()
+		c.watcher = nil
+	}
+	c.mutex.Unlock()
+	if c.zk != nil {
+		c.zk.once.Do(func() {
+			close(c.zk.stop)
+		})
+	}
+}
+
+//订阅配置变更 key 为配置前缀 如 log.level httpserver.ratelimit
+//key 对应的值发生变化时回调
+func (c *Config) OnChange(key string, f ChangeFunc) {
+	defer c.mutex.Unlock()
+	c.mutex.Lock()
+	c.listeners = append(c.listeners, &listener{key: key, last: c.Viper().Get(key), f: f})
+}
+
+//重新加载配置 并通知监听者 用于 SIGUSR2
+func (c *Config) Reload() error {
+	if c.Setting.Type == TypeZk {
+		return c.reloadZk()
+	}
+	if c.Setting.Type == TypeFile {
+		if err := c.read(c.Viper()); err != nil {
+			return errors.New(fmt.Sprintf("reload config error! filename:%s error:%s", c.Setting.Filename, err.Error()))
+		}
+	}
+	c.notify()
+	return nil
+}
+
+//对比监听的 key 值变化 回调
+func (c *Config) notify() {
+	c.mutex.Lock()
+	changed := make([]func(), 0)
+	v := c.Viper()
+	for _, l := range c.listeners {
+		old, cur := l.last, v.Get(l.key)
+		if reflect.DeepEqual(old, cur) {
+			continue
+		}
+		l.last = cur
+		f := l.f
+		changed = append(changed, func() { f(old, cur) })
+	}
+	c.mutex.Unlock()
+
+	//锁外回调 允许回调中继续订阅
+	for _, f := range changed {
+		f()
+	}
 }
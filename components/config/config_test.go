@@ -1,9 +1,16 @@
 package config
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func initConfiguration(t *testing.T) *Config {
@@ -26,3 +33,203 @@ func Test_GetLog(t *testing.T) {
 	t.Log(fmt.Sprintf("%v", v))
 
 }
+
+func TestConfig_OnChangeReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config.toml")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte("[log]\nlevel = \"info\"\n[app]\nname = \"lego\"\n"), 0644))
+	c, err := NewConfig(filename)
+	assert.Nil(t, err)
+
+	var olds, news []interface{}
+	c.OnChange("log.level", func(old, new interface{}) {
+		olds = append(olds, old)
+		news = append(news, new)
+	})
+	apps := 0
+	c.OnChange("app", func(old, new interface{}) {
+		apps++
+	})
+
+	assert.Nil(t, ioutil.WriteFile(filename, []byte("[log]\nlevel = \"debug\"\n[app]\nname = \"lego\"\n"), 0644))
+	assert.Nil(t, c.Reload())
+	assert.Equal(t, []interface{}{"info"}, olds)
+	assert.Equal(t, []interface{}{"debug"}, news)
+	assert.Equal(t, 0, apps, "unchanged key not notify")
+
+	//未变化 再次加载不通知
+	assert.Nil(t, c.Reload())
+	assert.Equal(t, 1, len(news))
+}
+
+func TestNewConfig_Layered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config.toml")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(`
+[app]
+name = "lego"
+[httpserver]
+http_host = "0.0.0.0"
+http_port = 8080
+enable_https = false
+`), 0644))
+	assert.Nil(t, ioutil.WriteFile(EnvFilename(filename, "prod"), []byte(`
+[httpserver]
+http_host = "10.0.0.1"
+http_port = 8081
+`), 0644))
+
+	_ = os.Setenv("LEGOTEST_HTTPSERVER_HTTP_PORT", "8082")
+	defer os.Unsetenv("LEGOTEST_HTTPSERVER_HTTP_PORT")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("httpserver.enable_https", "", "")
+	fs.String("app.name", "", "")
+	assert.Nil(t, fs.Parse([]string{"-httpserver.enable_https=true"}))
+
+	c, err := NewConfig(filename, WithEnv("prod"), WithEnvPrefix("legotest"), WithFlags(fs))
+	assert.Nil(t, err)
+
+	assert.Equal(t, "lego", c.Handler.GetString("app.name"))
+	assert.Equal(t, "10.0.0.1", c.Handler.GetString("httpserver.http_host"))
+	assert.Equal(t, 8082, c.Handler.GetInt("httpserver.http_port"))
+	assert.True(t, c.Handler.GetBool("httpserver.enable_https"))
+
+	assert.Equal(t, LayerBase, c.Source("app.name"))
+	assert.Equal(t, LayerEnv, c.Source("httpserver.http_host"))
+	assert.Equal(t, LayerEnvVar, c.Source("httpserver.http_port"))
+	assert.Equal(t, LayerFlag, c.Source("httpserver.enable_https"))
+	assert.Equal(t, "", c.Source("not.exists"))
+	assert.Equal(t, LayerEnv, c.Sources()["httpserver.http_host"])
+
+	//环境文件不存在时跳过
+	c, err = NewConfig(filename, WithEnv("test"))
+	assert.Nil(t, err)
+	assert.Equal(t, 8080, c.Handler.GetInt("httpserver.http_port"))
+}
+
+func TestConfig_UnmarshalKeyEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config.toml")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(`
+[httpserver]
+http_host = "0.0.0.0"
+[breakers.user]
+timeout = "100ms"
+`), 0644))
+	envs := map[string]string{
+		"LEGOTEST_HTTPSERVER_HTTP_HOST":        "10.0.0.1",
+		"LEGOTEST_HTTPSERVER_KEEPALIVE_TIME":   "20s",
+		"LEGOTEST_BREAKERS_USER_TIMEOUT":       "200ms",
+		"LEGOTEST_BREAKERS_ORDER_LIST_TIMEOUT": "300ms",
+	}
+	for k, v := range envs {
+		_ = os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	c, err := NewConfig(filename, WithEnvPrefix("legotest"))
+	assert.Nil(t, err)
+
+	//文件中已有的 key 与只在环境变量中出现的 key 都合并
+	var s bindSetting
+	assert.Nil(t, c.UnmarshalKey("httpserver", &s))
+	assert.Equal(t, "10.0.0.1", s.Host)
+	assert.Equal(t, 20*time.Second, s.Keepalive.Time)
+
+	type breaker struct {
+		Timeout time.Duration `mapstructure:"timeout"`
+	}
+	assert.Equal(t, []string{"order_list", "user"}, c.SubKeys("breakers", breaker{}))
+	var b breaker
+	assert.Nil(t, c.UnmarshalKey("breakers.order_list", &b))
+	assert.Equal(t, 300*time.Millisecond, b.Timeout)
+	assert.Nil(t, c.UnmarshalKey("breakers.user", &b))
+	assert.Equal(t, 200*time.Millisecond, b.Timeout)
+
+	assert.True(t, c.IsSet("httpserver.keepalive"))
+	assert.False(t, c.IsSet("grpcserver"))
+}
+
+func TestConfig_WatchEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lego-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config.toml")
+	assert.Nil(t, ioutil.WriteFile(filename, []byte("[log]\nlevel = \"info\"\n"), 0644))
+	c, err := NewConfig(filename, WithEnv("prod"))
+	assert.Nil(t, err)
+	c.WatchReConfig()
+	defer c.Close()
+
+	changed := make(chan interface{}, 10)
+	c.OnChange("log.level", func(old, new interface{}) {
+		changed <- new
+	})
+	//环境文件创建修改都触发重新加载
+	assert.Nil(t, ioutil.WriteFile(EnvFilename(filename, "prod"), []byte("[log]\nlevel = \"debug\"\n"), 0644))
+	select {
+	case v := <-changed:
+		assert.Equal(t, "debug", v)
+	case <-time.After(2 * time.Second):
+		t.Fatal("env file change should reload")
+	}
+}
+
+type bindKeepalive struct {
+	Time    time.Duration `mapstructure:"time" default:"10s"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+type bindSetting struct {
+	Host      string        `mapstructure:"http_host" valid:"Required"`
+	Port      int           `mapstructure:"http_port" default:"8080" valid:"Range(1,65535)"`
+	Hosts     []string      `mapstructure:"hosts"`
+	Keepalive bindKeepalive `mapstructure:"keepalive"`
+}
+
+func TestConfig_Bind(t *testing.T) {
+	c, err := NewConfigData("toml", []byte(`
+[httpserver]
+http_host = "0.0.0.0"
+hosts = "a,b"
+[httpserver.keepalive]
+timeout = 3
+`))
+	assert.Nil(t, err)
+
+	var s bindSetting
+	assert.Nil(t, c.Bind("httpserver", &s))
+	assert.Equal(t, "0.0.0.0", s.Host)
+	assert.Equal(t, 8080, s.Port, "default from tag")
+	assert.Equal(t, []string{"a", "b"}, s.Hosts)
+	assert.Equal(t, 10*time.Second, s.Keepalive.Time)
+	assert.Equal(t, 3*time.Second, s.Keepalive.Timeout, "number as seconds")
+}
+
+func TestConfig_BindInvalid(t *testing.T) {
+	c, err := NewConfigData("toml", []byte(`
+[httpserver]
+http_port = 70000
+[httpserver.keepalive]
+time = "10x"
+`))
+	assert.Nil(t, err)
+
+	var s bindSetting
+	err = c.Bind("httpserver", &s)
+	var be *BindError
+	assert.True(t, errors.As(err, &be))
+	assert.ElementsMatch(t, []string{"httpserver.keepalive.time", "httpserver.http_host", "httpserver.http_port"}, be.Keys())
+
+	assert.NotNil(t, c.Bind("httpserver", s), "need struct pointer")
+}
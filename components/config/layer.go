@@ -0,0 +1,299 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+//分层加载配置 优先级从低到高
+//base 基础文件 config.toml
+//env 环境文件 config.<env>.toml 与基础文件同目录 不存在时跳过
+//envvar 环境变量 <PREFIX>_<KEY> key 中 . 替换为 _ 如 LEGO_HTTPSERVER_HTTP_PORT
+//	viper 只识别文件中已有的 key 整体读取子树时使用 UnmarshalKey SubKeys IsSet 按结构体字段合并环境变量
+//flag 命令行参数 参数名即配置key 如 -httpserver.http_port=8080
+//usage:
+//	fs := flag.NewFlagSet("app", flag.ExitOnError)
+//	fs.String("httpserver.http_port", "", "http port")
+//	_ = fs.Parse(os.Args[1:])
+//	cf, err := NewConfig("./config.toml", WithEnv("prod"), WithEnvPrefix("LEGO"), WithFlags(fs))
+//	cf.Source("httpserver.http_port")
+const (
+	LayerBase   = "base"
+	LayerEnv    = "env"
+	LayerEnvVar = "envvar"
+	LayerFlag   = "flag"
+)
+
+//环境变量key 替换
+var envKeyReplacer = strings.NewReplacer(".", "_")
+
+type Option func(s *Setting)
+
+//环境名称 加载 config.<env>.toml
+func WithEnv(env string) Option {
+	return func(s *Setting) {
+		s.Env = env
+	}
+}
+
+//环境变量前缀 为空时不读取环境变量
+func WithEnvPrefix(prefix string) Option {
+	return func(s *Setting) {
+		s.EnvPrefix = prefix
+	}
+}
+
+//命令行参数 只使用已设置的参数 需在 NewConfig 前 Parse
+func WithFlags(fs *flag.FlagSet) Option {
+	return func(s *Setting) {
+		s.Flags = fs
+	}
+}
+
+//环境配置文件名 config.toml => config.prod.toml
+func EnvFilename(filename string, env string) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "." + env + ext
+}
+
+//读取基础文件 合并环境文件
+func (c *Config) read(v *viper.Viper) error {
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+	return c.mergeEnvFile(v)
+}
+
+//合并环境文件 记录环境文件提供的 key
+func (c *Config) mergeEnvFile(v *viper.Viper) error {
+	keys := make(map[string]bool)
+	defer func() {
+		c.mutex.Lock()
+		c.envKeys = keys
+		c.mutex.Unlock()
+	}()
+
+	if len(c.Setting.Env) == 0 || c.Setting.Type != TypeFile {
+		return nil
+	}
+	filename := EnvFilename(c.Setting.Filename, c.Setting.Env)
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+	ev := viper.New()
+	ev.SetConfigFile(filename)
+	if err := ev.ReadInConfig(); err != nil {
+		return errors.New(fmt.Sprintf("read env config error! filename:%s error:%s", filename, err.Error()))
+	}
+	if err := v.MergeConfigMap(ev.AllSettings()); err != nil {
+		return errors.New(fmt.Sprintf("merge env config error! filename:%s error:%s", filename, err.Error()))
+	}
+	for _, k := range ev.AllKeys() {
+		keys[k] = true
+	}
+	return nil
+}
+
+//绑定环境变量和命令行参数
+func (c *Config) bindOverrides(v *viper.Viper) {
+	if len(c.Setting.EnvPrefix) > 0 {
+		v.SetEnvPrefix(c.Setting.EnvPrefix)
+		v.SetEnvKeyReplacer(envKeyReplacer)
+		v.AutomaticEnv()
+	}
+	if c.Setting.Flags != nil {
+		c.Setting.Flags.Visit(func(f *flag.Flag) {
+			v.Set(strings.ToLower(f.Name), f.Value.String())
+		})
+	}
+}
+
+//环境变量名 LEGO_HTTPSERVER_HTTP_PORT
+func (c *Config) EnvVarName(key string) string {
+	if len(c.Setting.EnvPrefix) == 0 {
+		return ""
+	}
+	return strings.ToUpper(c.Setting.EnvPrefix + "_" + envKeyReplacer.Replace(key))
+}
+
+//key 的值来自哪一层 未配置时返回空
+func (c *Config) Source(key string) string {
+	key = strings.ToLower(key)
+	defer c.mutex.Unlock()
+	c.mutex.Lock()
+
+	if c.flagKeys[key] {
+		return LayerFlag
+	}
+	if name := c.EnvVarName(key); len(name) > 0 {
+		if _, ok := os.LookupEnv(name); ok {
+			return LayerEnvVar
+		}
+	}
+	if c.envKeys[key] {
+		return LayerEnv
+	}
+	if c.Viper().IsSet(key) {
+		return LayerBase
+	}
+	return ""
+}
+
+//全部 key 对应的配置层
+func (c *Config) Sources() map[string]string {
+	sources := make(map[string]string)
+	for _, key := range c.Viper().AllKeys() {
+		sources[key] = c.Source(key)
+	}
+	return sources
+}
+
+//key 是否已配置 包含只在环境变量中出现的子 key
+func (c *Config) IsSet(key string) bool {
+	if c.Viper().IsSet(key) {
+		return true
+	}
+	name := c.EnvVarName(key)
+	if len(name) == 0 {
+		return false
+	}
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, name+"=") || strings.HasPrefix(kv, name+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+//读取 key 下的配置到 out 合并 out 结构体字段对应的环境变量 <PREFIX>_<KEY>_<FIELD>
+//viper UnmarshalKey 读取子树时不合并环境变量 只在文件之外配置的 key 也读取不到
+//slice 字段按 , 分隔 元素为结构体的 slice 与 map 字段不读取环境变量
+func (c *Config) UnmarshalKey(key string, out interface{}) error {
+	raw := c.settingsValue(key)
+	if t := indirectType(reflect.TypeOf(out)); t.Kind() == reflect.Struct {
+		m, ok := raw.(map[string]interface{})
+		if !ok && raw == nil {
+			m = make(map[string]interface{})
+		}
+		if m != nil && len(c.Setting.EnvPrefix) > 0 {
+			for _, k := range schemaKeys(t, "") {
+				if v, ok := os.LookupEnv(c.EnvVarName(key + "." + k)); ok {
+					setPath(m, strings.Split(k, "."), v)
+				}
+			}
+			raw = m
+		}
+	}
+	if raw == nil {
+		return nil
+	}
+	return decode(raw, out)
+}
+
+//key 下的子 key 排序返回 包含只在环境变量中出现的子 key 如 LEGO_BREAKERS_USER_TIMEOUT => user
+//schema 为子 key 对应的结构体 按其字段从环境变量名中识别子 key
+func (c *Config) SubKeys(key string, schema interface{}) []string {
+	set := make(map[string]bool)
+	if m, ok := c.settingsValue(key).(map[string]interface{}); ok {
+		for k := range m {
+			set[k] = true
+		}
+	}
+	if prefix := c.EnvVarName(key); len(prefix) > 0 {
+		suffixes := make([]string, 0)
+		for _, k := range schemaKeys(indirectType(reflect.TypeOf(schema)), "") {
+			suffixes = append(suffixes, "_"+strings.ToUpper(envKeyReplacer.Replace(k)))
+		}
+		for _, kv := range os.Environ() {
+			name := strings.SplitN(kv, "=", 2)[0]
+			if !strings.HasPrefix(name, prefix+"_") {
+				continue
+			}
+			rest := strings.TrimPrefix(name, prefix+"_")
+			for _, suffix := range suffixes {
+				if len(rest) > len(suffix) && strings.HasSuffix(rest, suffix) {
+					set[strings.ToLower(strings.TrimSuffix(rest, suffix))] = true
+				}
+			}
+		}
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//合并各层后的配置值 AllSettings 逐个叶子 key 读取 包含环境变量与命令行参数
+func (c *Config) settingsValue(key string) interface{} {
+	var v interface{} = c.Viper().AllSettings()
+	for _, seg := range strings.Split(strings.ToLower(key), ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[seg]
+	}
+	return v
+}
+
+//结构体可从环境变量读取的叶子 key
+func schemaKeys(t reflect.Type, prefix string) []string {
+	keys := make([]string, 0)
+	if t.Kind() != reflect.Struct {
+		return keys
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+		name := fieldKey(f)
+		if name == "-" {
+			continue
+		}
+		key := name
+		if len(prefix) > 0 {
+			key = prefix + "." + name
+		}
+		ft := indirectType(f.Type)
+		switch {
+		case ft.Kind() == reflect.Struct && ft != timeType:
+			keys = append(keys, schemaKeys(ft, key)...)
+		case ft.Kind() == reflect.Map:
+		case ft.Kind() == reflect.Slice && indirectType(ft.Elem()).Kind() == reflect.Struct:
+		default:
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+//按路径写入 中间层不存在或不是 map 时新建
+func setPath(m map[string]interface{}, path []string, v interface{}) {
+	for _, seg := range path[:len(path)-1] {
+		next, ok := m[seg].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[seg] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = v
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/spf13/viper"
+
+	"github.com/jeevic/lego/components/zookeeper"
+)
+
+//zookeeper 配置源 读取节点数据并监听变更
+//节点数据非法时保留上一次正确配置 LastError 返回解析错误
+//usage:
+//	zb, _ := zookeeper.GetZkBuilder("app")
+//	cf, err := NewZkConfig(zb, "/lego/app/config", "toml")
+//	cf.OnChange("log.level", func(old, new interface{}) {})
+//	defer cf.Close()
+
+const TypeZk = "zk"
+
+//监听失败后重试间隔
+var zkRetryInterval = time.Second
+
+//zk 连接接口 *zk.Conn 实现 便于测试替换
+type ZkConn interface {
+	Get(path string) ([]byte, *zk.Stat, error)
+	GetW(path string) ([]byte, *zk.Stat, <-chan zk.Event, error)
+	ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error)
+}
+
+//zk 配置源
+type zkSource struct {
+	conn    ZkConn
+	path    string
+	stop    chan struct{}
+	once    sync.Once
+	mutex   sync.Mutex
+	lastErr error
+}
+
+//通过 ZkBuilder 创建配置
+func NewZkConfig(zb *zookeeper.ZkBuilder, path string, format string) (*Config, error) {
+	if zb == nil || zb.Conn == nil {
+		return nil, errors.New(fmt.Sprintf("new zk config error! path:%s error:zk conn not init", path))
+	}
+	return NewZkConfigConn(zb.Conn, path, format)
+}
+
+//通过 zk 连接创建配置
+func NewZkConfigConn(conn ZkConn, path string, format string) (*Config, error) {
+	data, _, ch, err := conn.GetW(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("new zk config error! path:%s error:%s", path, err.Error()))
+	}
+	v := viper.New()
+	v.SetConfigType(format)
+	if err := v.ReadConfig(bytes.NewBuffer(data)); err != nil {
+		return nil, errors.New(fmt.Sprintf("new zk config error! path:%s error:%s", path, err.Error()))
+	}
+
+	c := new(Config)
+	c.Setting = Setting{Type: TypeZk, Format: format, Filename: path}
+	c.init(v)
+	c.zk = &zkSource{conn: conn, path: path, stop: make(chan struct{})}
+	go c.watchZk(ch)
+	return c, nil
+}
+
+//最近一次加载远程配置的错误 加载成功后清空
+func (c *Config) LastError() error {
+	if c.zk == nil {
+		return nil
+	}
+	defer c.zk.mutex.Unlock()
+	c.zk.mutex.Lock()
+	return c.zk.lastErr
+}
+
+//监听节点变更 zk watch 只触发一次 每次事件后重新注册
+func (c *Config) watchZk(ch <-chan zk.Event) {
+	for {
+		select {
+		case <-c.zk.stop:
+			return
+		case <-ch:
+		}
+
+		for {
+			data, exists, next, err := c.getZkW()
+			if err == nil {
+				ch = next
+				if exists {
+					c.loadZk(data)
+				}
+				break
+			}
+			c.setZkError(err)
+			select {
+			case <-c.zk.stop:
+				return
+			case <-time.After(zkRetryInterval):
+			}
+		}
+	}
+}
+
+//读取节点数据并注册监听 节点不存在时监听节点创建
+func (c *Config) getZkW() ([]byte, bool, <-chan zk.Event, error) {
+	for {
+		data, _, ch, err := c.zk.conn.GetW(c.zk.path)
+		if err != zk.ErrNoNode {
+			return data, err == nil, ch, err
+		}
+		exists, _, ch, err := c.zk.conn.ExistsW(c.zk.path)
+		if err != nil {
+			return nil, false, nil, err
+		}
+		//两次调用之间节点被创建 重新读取
+		if exists {
+			continue
+		}
+		//保留上一次配置 等待节点创建
+		c.setZkError(zk.ErrNoNode)
+		return nil, false, ch, nil
+	}
+}
+
+//重新读取 zk 节点
+func (c *Config) reloadZk() error {
+	data, _, err := c.zk.conn.Get(c.zk.path)
+	if err != nil {
+		c.setZkError(err)
+		return err
+	}
+	return c.loadZk(data)
+}
+
+//解析到新的 viper 后整体替换 读取方不会看到解析中的状态 非法数据不覆盖当前配置
+func (c *Config) loadZk(data []byte) error {
+	v := viper.New()
+	v.SetConfigType(c.Setting.Format)
+	if err := v.ReadConfig(bytes.NewBuffer(data)); err != nil {
+		err = errors.New(fmt.Sprintf("zk config parse error! path:%s error:%s", c.zk.path, err.Error()))
+		c.setZkError(err)
+		return err
+	}
+	c.bindOverrides(v)
+	c.handler.Store(v)
+	c.setZkError(nil)
+	c.notify()
+	return nil
+}
+
+func (c *Config) setZkError(err error) {
+	defer c.zk.mutex.Unlock()
+	c.zk.mutex.Lock()
+	c.zk.lastErr = err
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+//内存 zk 连接
+type fakeZkConn struct {
+	mutex    sync.Mutex
+	data     map[string][]byte
+	watchers map[string][]chan zk.Event
+}
+
+func newFakeZkConn() *fakeZkConn {
+	return &fakeZkConn{data: make(map[string][]byte), watchers: make(map[string][]chan zk.Event)}
+}
+
+func (f *fakeZkConn) Get(path string) ([]byte, *zk.Stat, error) {
+	defer f.mutex.Unlock()
+	f.mutex.Lock()
+	data, ok := f.data[path]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	return data, &zk.Stat{}, nil
+}
+
+func (f *fakeZkConn) GetW(path string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	defer f.mutex.Unlock()
+	f.mutex.Lock()
+	data, ok := f.data[path]
+	if !ok {
+		return nil, nil, nil, zk.ErrNoNode
+	}
+	return data, &zk.Stat{}, f.watch(path), nil
+}
+
+func (f *fakeZkConn) ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	defer f.mutex.Unlock()
+	f.mutex.Lock()
+	_, ok := f.data[path]
+	return ok, &zk.Stat{}, f.watch(path), nil
+}
+
+func (f *fakeZkConn) watch(path string) chan zk.Event {
+	ch := make(chan zk.Event, 1)
+	f.watchers[path] = append(f.watchers[path], ch)
+	return ch
+}
+
+func (f *fakeZkConn) set(path string, data []byte) {
+	f.fire(path, zk.EventNodeDataChanged, func() { f.data[path] = data })
+}
+
+func (f *fakeZkConn) delete(path string) {
+	f.fire(path, zk.EventNodeDeleted, func() { delete(f.data, path) })
+}
+
+func (f *fakeZkConn) fire(path string, t zk.EventType, change func()) {
+	f.mutex.Lock()
+	change()
+	watchers := f.watchers[path]
+	delete(f.watchers, path)
+	f.mutex.Unlock()
+	for _, ch := range watchers {
+		ch <- zk.Event{Type: t, Path: path}
+	}
+}
+
+func TestNewZkConfig(t *testing.T) {
+	zkRetryInterval = 10 * time.Millisecond
+	conn := newFakeZkConn()
+	path := "/lego/test/config"
+	conn.data[path] = []byte("[log]\nlevel = \"info\"\n")
+
+	c, err := NewZkConfigConn(conn, path, "toml")
+	assert.Nil(t, err)
+	defer c.Close()
+	assert.Equal(t, "info", c.Viper().GetString("log.level"))
+
+	changed := make(chan interface{}, 10)
+	c.OnChange("log.level", func(old, new interface{}) {
+		changed <- new
+	})
+
+	conn.set(path, []byte("[log]\nlevel = \"debug\"\n"))
+	assert.Equal(t, "debug", waitChange(t, changed))
+	assert.Nil(t, c.LastError())
+
+	//非法数据 保留上一次配置
+	conn.set(path, []byte("[log\nlevel = "))
+	assert.Eventually(t, func() bool { return c.LastError() != nil }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "debug", c.Viper().GetString("log.level"))
+
+	//节点删除后重建
+	conn.delete(path)
+	assert.Eventually(t, func() bool { return c.LastError() == zk.ErrNoNode }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "debug", c.Viper().GetString("log.level"))
+	conn.set(path, []byte("[log]\nlevel = \"warn\"\n"))
+	assert.Equal(t, "warn", waitChange(t, changed))
+
+	//Reload 主动读取
+	conn.mutex.Lock()
+	conn.data[path] = []byte("[log]\nlevel = \"error\"\n")
+	conn.mutex.Unlock()
+	assert.Nil(t, c.Reload())
+	assert.Equal(t, "error", waitChange(t, changed))
+}
+
+func TestNewZkConfig_ConcurrentRead(t *testing.T) {
+	conn := newFakeZkConn()
+	path := "/lego/test/race"
+	conn.data[path] = []byte("[log]\nlevel = \"info\"\n")
+
+	c, err := NewZkConfigConn(conn, path, "toml")
+	assert.Nil(t, err)
+	defer c.Close()
+	changed := make(chan interface{}, 100)
+	c.OnChange("log.level", func(old, new interface{}) {
+		changed <- new
+	})
+
+	//节点变更时并发读取 -race 下不报告数据竞争
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				level := c.Viper().GetString("log.level")
+				if level != "info" && level != "debug" && level != "warn" {
+					t.Error("unexpected level", level)
+					return
+				}
+				_ = c.Viper().AllSettings()
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		level := "debug"
+		if i%2 == 1 {
+			level = "warn"
+		}
+		conn.set(path, []byte("[log]\nlevel = \""+level+"\"\n"))
+		assert.Equal(t, level, waitChange(t, changed))
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestNewZkConfig_NoNode(t *testing.T) {
+	_, err := NewZkConfigConn(newFakeZkConn(), "/not/exists", "toml")
+	assert.NotNil(t, err)
+	_, err = NewZkConfig(nil, "/not/exists", "toml")
+	assert.NotNil(t, err)
+}
+
+func waitChange(t *testing.T, ch chan interface{}) interface{} {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("wait config change timeout")
+	}
+	return nil
+}
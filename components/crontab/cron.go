@@ -65,6 +65,11 @@ func (c *Crontab) Len() int {
 	return c.Scheduler.Len()
 }
 
+//修改时区
+func (c *Crontab) ChangeLocation(location *time.Location) {
+	c.Scheduler.ChangeLocation(location)
+}
+
 //停止任务
 func (c *Crontab) Stop() {
 	c.Scheduler.Stop()
@@ -1,6 +1,9 @@
 package crontab
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 var globalCrontab *Crontab
 var once sync.Once
@@ -32,6 +35,11 @@ func Len() int {
 	return globalCrontab.Len()
 }
 
+//修改时区
+func ChangeLocation(location *time.Location) {
+	globalCrontab.ChangeLocation(location)
+}
+
 //停止任务
 func Stop() {
 	globalCrontab.Stop()
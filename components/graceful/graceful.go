@@ -0,0 +1,222 @@
+package graceful
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//平滑重启 监听fd 交接
+//usage:
+//	//启动时通过 Listen 获取监听 子进程会自动继承父进程的fd
+//	l, err := graceful.Listen("httpserver", "tcp", "0.0.0.0:8080")
+//
+//	//收到重启信号时 fork 子进程 子进程就绪后父进程处理完请求退出
+//	pid, err := graceful.Fork()
+//
+//	//子进程启动完成后通知父进程
+//	err := graceful.Ready()
+
+// 子进程继承的监听 格式 name:fd,name:fd
+const EnvListeners = "LEGO_GRACEFUL_LISTENERS"
+
+// 子进程就绪通知管道 fd
+const EnvReadyFd = "LEGO_GRACEFUL_READY_FD"
+
+// ExtraFiles 起始 fd 0 1 2 为标准输入输出
+const firstExtraFd = 3
+
+// 等待子进程就绪的最长时间 超时后结束子进程
+var ReadyTimeout = 30 * time.Second
+
+var ErrChildExited = errors.New("graceful child process exited before ready")
+
+var (
+	mutex sync.Mutex
+	//父进程传递的 fd 未被使用
+	inherited map[string]uintptr
+	//当前进程的监听
+	listeners = make(map[string]net.Listener)
+)
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+// 解析父进程传递的 fd
+func loadInherited() {
+	if inherited != nil {
+		return
+	}
+	inherited = make(map[string]uintptr)
+	for _, pair := range strings.Split(os.Getenv(EnvListeners), ",") {
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		fd, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		inherited[kv[0]] = uintptr(fd)
+	}
+}
+
+// IsChild 是否由平滑重启 fork 启动
+func IsChild() bool {
+	return len(os.Getenv(EnvListeners)) > 0 || len(os.Getenv(EnvReadyFd)) > 0
+}
+
+// Ready 子进程启动完成后通知父进程 非平滑重启启动时忽略
+func Ready() error {
+	v := os.Getenv(EnvReadyFd)
+	if len(v) == 0 {
+		return nil
+	}
+	_ = os.Unsetenv(EnvReadyFd)
+	fd, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return errors.New(fmt.Sprintf("graceful ready fd:%s error:%s", v, err.Error()))
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// IsInherited 指定名称的监听是否由父进程传递
+func IsInherited(name string) bool {
+	defer mutex.Unlock()
+	mutex.Lock()
+	loadInherited()
+	_, ok := inherited[name]
+	return ok
+}
+
+// Listen 获取监听 存在父进程传递的 fd 时直接复用 否则新建监听
+// network 支持 tcp unix
+func Listen(name string, network string, addr string) (net.Listener, error) {
+	defer mutex.Unlock()
+	mutex.Lock()
+	loadInherited()
+
+	if fd, ok := inherited[name]; ok {
+		delete(inherited, name)
+		f := os.NewFile(fd, name)
+		l, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("graceful inherit listener:%s fd:%d error:%s", name, fd, err.Error()))
+		}
+		listeners[name] = l
+		return l, nil
+	}
+
+	if network == "unix" {
+		_ = os.Remove(addr)
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	listeners[name] = l
+	return l, nil
+}
+
+// Fork 启动新的进程 并把当前全部监听 fd 传递给新进程
+// 等待新进程调用 Ready 后返回新进程 pid 调用方负责当前进程的优雅退出
+// 新进程就绪前退出或超时返回错误 当前进程继续服务
+func Fork() (int, error) {
+	defer mutex.Unlock()
+	mutex.Lock()
+
+	files := make([]*os.File, 0, len(listeners)+1)
+	pairs := make([]string, 0, len(listeners))
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	for name, l := range listeners {
+		//父进程关闭监听时 不删除 unix socket 文件
+		if ul, ok := l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+		fl, ok := l.(filer)
+		if !ok {
+			return 0, errors.New(fmt.Sprintf("graceful listener:%s not support file", name))
+		}
+		f, err := fl.File()
+		if err != nil {
+			return 0, errors.New(fmt.Sprintf("graceful listener:%s get file error:%s", name, err.Error()))
+		}
+		pairs = append(pairs, fmt.Sprintf("%s:%d", name, firstExtraFd+len(files)))
+		files = append(files, f)
+	}
+
+	//子进程写入就绪 退出时写端关闭 父进程读到 EOF
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	readyFd := firstExtraFd + len(files)
+	files = append(files, w)
+
+	path, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, EnvListeners+"=") && !strings.HasPrefix(e, EnvReadyFd+"=") {
+			env = append(env, e)
+		}
+	}
+	env = append(env, EnvListeners+"="+strings.Join(pairs, ","), fmt.Sprintf("%s=%d", EnvReadyFd, readyFd))
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return 0, errors.New(fmt.Sprintf("graceful fork process error:%s", err.Error()))
+	}
+	_ = w.Close()
+	//回收子进程
+	go func() {
+		_ = cmd.Wait()
+	}()
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if _, err := r.Read(buf); err != nil {
+			ready <- ErrChildExited
+			return
+		}
+		ready <- nil
+	}()
+
+	timer := time.NewTimer(ReadyTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-ready:
+		if err != nil {
+			return 0, err
+		}
+		return cmd.Process.Pid, nil
+	case <-timer.C:
+		_ = cmd.Process.Kill()
+		return 0, errors.New(fmt.Sprintf("graceful child process not ready in %s", ReadyTimeout))
+	}
+}
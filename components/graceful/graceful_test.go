@@ -0,0 +1,91 @@
+package graceful
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//fork 出的子进程按 GRACEFUL_TEST_CHILD 执行 不运行测试
+func TestMain(m *testing.M) {
+	switch os.Getenv("GRACEFUL_TEST_CHILD") {
+	case "ready":
+		_ = Ready()
+		os.Exit(0)
+	case "exit":
+		os.Exit(1)
+	case "hang":
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestListen_New(t *testing.T) {
+	l, err := Listen("new", "tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	assert.False(t, IsInherited("new"))
+}
+
+func TestListen_Inherited(t *testing.T) {
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer parent.Close()
+
+	f, err := parent.(*net.TCPListener).File()
+	assert.Nil(t, err)
+	defer f.Close()
+
+	_ = os.Setenv(EnvListeners, fmt.Sprintf("httpserver:%d", f.Fd()))
+	defer os.Unsetenv(EnvListeners)
+	inherited = nil
+
+	assert.True(t, IsChild())
+	assert.True(t, IsInherited("httpserver"))
+
+	l, err := Listen("httpserver", "tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	assert.Equal(t, parent.Addr().String(), l.Addr().String(), "need reuse parent listener")
+	assert.False(t, IsInherited("httpserver"), "inherited fd only use once")
+}
+
+func forkChild(t *testing.T, mode string) (int, error) {
+	mutex.Lock()
+	listeners = make(map[string]net.Listener)
+	mutex.Unlock()
+	_ = os.Setenv("GRACEFUL_TEST_CHILD", mode)
+	defer os.Unsetenv("GRACEFUL_TEST_CHILD")
+	return Fork()
+}
+
+func TestFork_Ready(t *testing.T) {
+	pid, err := forkChild(t, "ready")
+	assert.Nil(t, err)
+	assert.True(t, pid > 0)
+}
+
+func TestFork_ChildExited(t *testing.T) {
+	_, err := forkChild(t, "exit")
+	assert.Equal(t, ErrChildExited, err)
+}
+
+func TestFork_ReadyTimeout(t *testing.T) {
+	ReadyTimeout = 200 * time.Millisecond
+	defer func() {
+		ReadyTimeout = 30 * time.Second
+	}()
+	start := time.Now()
+	_, err := forkChild(t, "hang")
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestReady_NotChild(t *testing.T) {
+	assert.Nil(t, Ready())
+}
@@ -0,0 +1,108 @@
+package grpcclient
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/jeevic/lego/components/breakers"
+)
+
+//熔断拦截器 按 target + method 命名 如 "127.0.0.1:9000/pkg.Service/Method" 通过 breakers.Get 查看
+//Unavailable DeadlineExceeded ResourceExhausted 计为失败 其他错误属于业务错误
+//熔断时调用 fallback 未设置时返回 breaker.ErrServiceUnavailable
+//流式请求只统计建立流的结果
+
+//熔断时 unary 调用的降级 可填充 reply
+type UnaryFallback func(ctx context.Context, method string, req, reply interface{}, err error) error
+
+//熔断时 stream 调用的降级
+type StreamFallback func(ctx context.Context, method string, err error) (grpc.ClientStream, error)
+
+//熔断器名称
+func BreakerName(target string, method string) string {
+	return target + method
+}
+
+//是否计为成功
+func BreakerAcceptable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return false
+	default:
+		return true
+	}
+}
+
+func BreakerUnaryClientInterceptor(fallback UnaryFallback) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		bk := breakers.NewBreaker().WithAcceptable(BreakerAcceptable)
+		if fallback != nil {
+			bk = bk.WithFallback(func(err error) error {
+				return fallback(ctx, method, req, reply, err)
+			})
+		}
+		err := bk.GetOrBuild(BreakerName(cc.Target(), method)).DoCtx(ctx, func(ctx context.Context) error {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})
+		return toStatusError(err)
+	}
+}
+
+//建立流的 ctx 在流结束前不能取消 熔断超时只取消未建立完成的流
+func BreakerStreamClientInterceptor(fallback StreamFallback) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		var stream grpc.ClientStream
+		fellBack := false
+		bk := breakers.NewBreaker().WithAcceptable(BreakerAcceptable)
+		if fallback != nil {
+			bk = bk.WithFallback(func(err error) error {
+				var ferr error
+				fellBack = true
+				stream, ferr = fallback(ctx, method, err)
+				return ferr
+			})
+		}
+		streamCtx, cancel := context.WithCancel(ctx)
+		//超时返回后建立的流丢弃 由 cancel 关闭
+		done := make(chan grpc.ClientStream, 1)
+		err := bk.GetOrBuild(BreakerName(cc.Target(), method)).DoCtx(ctx, func(ctx context.Context) error {
+			cs, err := streamer(streamCtx, desc, cc, method, opts...)
+			if err == nil {
+				done <- cs
+			}
+			return err
+		})
+		if err == nil && !fellBack {
+			return &cancelClientStream{ClientStream: <-done, cancel: cancel, serverStreams: desc.ServerStreams}, nil
+		}
+		cancel()
+		return stream, toStatusError(err)
+	}
+}
+
+//熔断超时返回的 ctx 错误转为 grpc status
+func toStatusError(err error) error {
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		return status.FromContextError(err).Err()
+	}
+	return err
+}
+
+//流结束时释放 ctx
+type cancelClientStream struct {
+	grpc.ClientStream
+	cancel        context.CancelFunc
+	serverStreams bool
+}
+
+func (s *cancelClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	//服务端非流式 收到响应即结束
+	if err != nil || !s.serverStreams {
+		s.cancel()
+	}
+	return err
+}
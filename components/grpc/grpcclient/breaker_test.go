@@ -0,0 +1,88 @@
+package grpcclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/jeevic/lego/components/breakers"
+)
+
+func TestBreakerAcceptable(t *testing.T) {
+	assert.True(t, BreakerAcceptable(nil))
+	assert.True(t, BreakerAcceptable(status.Error(codes.NotFound, "not found")))
+	assert.False(t, BreakerAcceptable(status.Error(codes.Unavailable, "unavailable")))
+	assert.False(t, BreakerAcceptable(status.Error(codes.DeadlineExceeded, "deadline")))
+	assert.False(t, BreakerAcceptable(status.Error(codes.ResourceExhausted, "exhausted")))
+}
+
+func TestBreakerUnaryClientInterceptor(t *testing.T) {
+	cc, err := grpc.Dial("breaker-test:9000", grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer cc.Close()
+
+	invoked := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		invoked++
+		return status.Error(codes.Unavailable, "unavailable")
+	}
+	fallbacks := 0
+	interceptor := BreakerUnaryClientInterceptor(func(ctx context.Context, method string, req, reply interface{}, err error) error {
+		fallbacks++
+		return nil
+	})
+	for i := 0; i < 200; i++ {
+		_ = interceptor(context.Background(), "/test.Service/Unary", nil, nil, cc, invoker)
+	}
+	assert.True(t, fallbacks > 0)
+	assert.Equal(t, 200, invoked+fallbacks)
+
+	bk, ok := breakers.Get(BreakerName("breaker-test:9000", "/test.Service/Unary"))
+	assert.True(t, ok)
+	assert.True(t, bk.Stat().Drops > 0)
+}
+
+func TestBreakerUnaryClientInterceptorBusinessError(t *testing.T) {
+	cc, err := grpc.Dial("breaker-test:9000", grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer cc.Close()
+
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.NotFound, "not found")
+	}
+	interceptor := BreakerUnaryClientInterceptor(nil)
+	for i := 0; i < 200; i++ {
+		err := interceptor(context.Background(), "/test.Service/NotFound", nil, nil, cc, invoker)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	bk, ok := breakers.Get(BreakerName("breaker-test:9000", "/test.Service/NotFound"))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0), bk.Stat().Drops)
+}
+
+func TestBreakerUnaryClientInterceptorTimeout(t *testing.T) {
+	cc, err := grpc.Dial("breaker-test:9000", grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer cc.Close()
+
+	interceptor := BreakerUnaryClientInterceptor(nil)
+	name := BreakerName("breaker-test:9000", "/test.Service/Slow")
+	_ = interceptor(context.Background(), "/test.Service/Slow", nil, nil, cc, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	})
+	assert.True(t, breakers.SetTimeout(name, 20*time.Millisecond))
+
+	//超时后立即返回 不等待 invoker
+	start := time.Now()
+	err = interceptor(context.Background(), "/test.Service/Slow", nil, nil, cc, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.True(t, time.Since(start) < 150*time.Millisecond)
+}
@@ -8,11 +8,14 @@ import (
 	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
+
+	"github.com/jeevic/lego/components/tracing"
 )
 
 var (
 	ErrNotFoundClient = errors.New("not found grpc conn")
 	ErrConnShutdown   = errors.New("grpc conn shutdown")
+	ErrNoTarget       = errors.New("grpc pool has no target")
 )
 
 type GrpcClient struct {
@@ -20,7 +23,12 @@ type GrpcClient struct {
 }
 
 func NewClient(target string, options *Options) (*GrpcClient, error) {
-	dopts := make([]grpc.DialOption, 0, 7)
+	return newClient(target, options)
+}
+
+//extra 在其他拦截器之后 最靠近实际调用
+func newClient(target string, options *Options, extra ...grpc.DialOption) (*GrpcClient, error) {
+	dopts := make([]grpc.DialOption, 0, 7+len(extra))
 	ctx := context.Background()
 	var cancel context.CancelFunc
 	if options.DialTimeout > 0 {
@@ -44,6 +52,22 @@ func NewClient(target string, options *Options) (*GrpcClient, error) {
 		}))
 	}
 
+	if options.Tracing {
+		dopts = append(dopts, tracing.DialOptions()...)
+	}
+	//重试在熔断之外 每次尝试都计入熔断 连接池的重试在 Pool.Invoke 不在单个连接上
+	if options.Retry != nil {
+		dopts = append(dopts, grpc.WithChainUnaryInterceptor(RetryUnaryClientInterceptor(*options.Retry)))
+	}
+	//熔断在 tracing 之后 被熔断的请求也记录 span
+	if options.Breaker {
+		dopts = append(dopts,
+			grpc.WithChainUnaryInterceptor(BreakerUnaryClientInterceptor(options.BreakerFallback)),
+			grpc.WithChainStreamInterceptor(BreakerStreamClientInterceptor(options.BreakerStreamFallback)),
+		)
+	}
+	dopts = append(dopts, extra...)
+
 	conn, err := grpc.DialContext(ctx, target, dopts...)
 	if err != nil {
 		return nil, err
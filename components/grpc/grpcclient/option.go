@@ -4,13 +4,19 @@ import (
 	"time"
 
 	"google.golang.org/grpc/credentials"
+
+	"github.com/jeevic/lego/components/retry"
 )
 
 var (
-	defaultClientPoolCap    int64 = 5
-	defaultDialTimeout            = 5 * time.Second
-	defaultKeepAlive              = 30 * time.Second
-	defaultKeepAliveTimeout       = 10 * time.Second
+	defaultClientPoolCap       int64 = 5
+	defaultDialTimeout               = 5 * time.Second
+	defaultKeepAlive                 = 30 * time.Second
+	defaultKeepAliveTimeout          = 10 * time.Second
+	defaultResolveInterval           = 30 * time.Second
+	defaultHealthCheckInterval       = 10 * time.Second
+	defaultHealthCheckTimeout        = time.Second
+	defaultHealthCheckFailures       = 3
 )
 
 // Option used by the Client
@@ -20,6 +26,23 @@ type Options struct {
 	// client pool capacity
 	PoolCap int64
 
+	//连接池 target 列表 与 NewPool 的 target 合并
+	Targets []string
+	//动态解析 target 列表 结果与 Targets 合并 按 ResolveInterval 刷新
+	Resolver        Resolver
+	ResolveInterval time.Duration
+	//连接选择策略 round_robin least_loaded
+	Picker string
+
+	//连接池后台健康检查 间隔为 0 不检查
+	//HealthCheck 为 false 或服务端未注册 grpc.health.v1 时以连接状态为准
+	HealthCheck         bool
+	HealthCheckService  string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	//连续失败次数 达到后重建连接
+	HealthCheckFailures int
+
 	//grpc client dail time out
 	DialTimeout time.Duration
 
@@ -37,6 +60,17 @@ type Options struct {
 	KeepAliveTimeout time.Duration
 	// send pings even without active streams
 	KeepAlivePermitWithoutStream bool
+
+	//传递 traceparent 并记录客户端 span
+	Tracing bool
+
+	//按 target + method 熔断
+	Breaker               bool
+	BreakerFallback       UnaryFallback
+	BreakerStreamFallback StreamFallback
+
+	//unary 调用重试 为空不重试 连接池每次重试重新选择连接
+	Retry *retry.Policy
 }
 
 func NewOptions(options ...Option) *Options {
@@ -94,6 +128,82 @@ func WithKeepAlivePermitWithoutStream(b bool) Option {
 	}
 }
 
+func WithTracing(b bool) Option {
+	return func(o *Options) {
+		o.Tracing = b
+	}
+}
+
+func WithBreaker(b bool) Option {
+	return func(o *Options) {
+		o.Breaker = b
+	}
+}
+
+//设置熔断降级 同时开启熔断
+func WithBreakerFallback(unary UnaryFallback, stream StreamFallback) Option {
+	return func(o *Options) {
+		o.Breaker = true
+		o.BreakerFallback = unary
+		o.BreakerStreamFallback = stream
+	}
+}
+
+func WithRetry(p retry.Policy) Option {
+	return func(o *Options) {
+		o.Retry = &p
+	}
+}
+
+func WithTargets(targets ...string) Option {
+	return func(o *Options) {
+		o.Targets = append(o.Targets, targets...)
+	}
+}
+
+func WithResolver(r Resolver, interval time.Duration) Option {
+	return func(o *Options) {
+		o.Resolver = r
+		o.ResolveInterval = interval
+	}
+}
+
+func WithPicker(picker string) Option {
+	return func(o *Options) {
+		o.Picker = picker
+	}
+}
+
+func WithHealthCheck(b bool) Option {
+	return func(o *Options) {
+		o.HealthCheck = b
+	}
+}
+
+func WithHealthCheckService(service string) Option {
+	return func(o *Options) {
+		o.HealthCheckService = service
+	}
+}
+
+func WithHealthCheckInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.HealthCheckInterval = interval
+	}
+}
+
+func WithHealthCheckTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.HealthCheckTimeout = timeout
+	}
+}
+
+func WithHealthCheckFailures(n int) Option {
+	return func(o *Options) {
+		o.HealthCheckFailures = n
+	}
+}
+
 func NewDefaultOptions() *Options {
 	return &Options{
 		PoolCap:     defaultClientPoolCap,
@@ -104,5 +214,15 @@ func NewDefaultOptions() *Options {
 		KeepAlive:                    defaultKeepAlive,
 		KeepAliveTimeout:             defaultKeepAliveTimeout,
 		KeepAlivePermitWithoutStream: false,
+
+		Tracing: true,
+
+		ResolveInterval: defaultResolveInterval,
+		Picker:          PickerRoundRobin,
+
+		HealthCheck:         true,
+		HealthCheckInterval: defaultHealthCheckInterval,
+		HealthCheckTimeout:  defaultHealthCheckTimeout,
+		HealthCheckFailures: defaultHealthCheckFailures,
 	}
 }
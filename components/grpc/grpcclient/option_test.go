@@ -48,3 +48,21 @@ func TestWithCredentials(t *testing.T) {
 	opts := NewOptions(WithCredentials(no))
 	assert.Equal(t, opts.Credentials, no)
 }
+
+func TestWithTargets(t *testing.T) {
+	opts := NewOptions(WithTargets("a:1"), WithTargets("b:1", "c:1"))
+	assert.Equal(t, opts.Targets, []string{"a:1", "b:1", "c:1"})
+}
+
+func TestWithPicker(t *testing.T) {
+	assert.Equal(t, NewDefaultOptions().Picker, PickerRoundRobin)
+	opts := NewOptions(WithPicker(PickerLeastLoaded))
+	assert.Equal(t, opts.Picker, PickerLeastLoaded)
+}
+
+func TestWithHealthCheck(t *testing.T) {
+	opts := NewOptions(WithHealthCheck(false), WithHealthCheckInterval(time.Second), WithHealthCheckFailures(1))
+	assert.Equal(t, opts.HealthCheck, false)
+	assert.Equal(t, opts.HealthCheckInterval, time.Second)
+	assert.Equal(t, opts.HealthCheckFailures, 1)
+}
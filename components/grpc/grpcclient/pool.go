@@ -1,106 +1,699 @@
 package grpcclient
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/jeevic/lego/components/log"
+	"github.com/jeevic/lego/components/retry"
+)
+
+//连接池 每个 target 建立 PoolCap 个连接 按 Picker 在健康连接中选择
+//后台按 HealthCheckInterval 检查连接 成功权重翻倍 失败权重减半 连接断开权重置 0 不再被选择
+//连续失败 HealthCheckFailures 次的连接异步重建 新连接以低权重开始 检查通过后逐步恢复
+//配置 Resolver 时按 ResolveInterval 刷新 target 列表 新 target 建立连接 下线 target 的连接执行完请求后关闭
+//GetClient 只做选择 不在请求路径上建立连接
+//Pool 实现 grpc.ClientConnInterface 可直接传给生成的 NewXxxClient 每次调用重新选择连接
+//WithRetry 只在 Pool.Invoke 生效 每次重试重新选择连接 GetClient 取得的连接不重试
+//usage:
+//
+//	pool, err := grpcclient.NewPool("", grpcclient.WithTargets("10.0.0.1:9000", "10.0.0.2:9000"),
+//		grpcclient.WithPicker(grpcclient.PickerLeastLoaded), grpcclient.WithRetry(p))
+//	client := pb.NewGreeterClient(pool)
+
+const (
+	maxWeight = 100
+	//重建的连接初始权重
+	redialWeight = 10
+	//下线连接等待执行中请求结束的最长时间
+	drainTimeout = 5 * time.Second
+
+	healthCheckMethod = "/grpc.health.v1.Health/Check"
 )
 
+//连接选择策略
+const (
+	//按健康权重平滑加权轮询
+	PickerRoundRobin = "round_robin"
+	//选择 (inflight+1)/权重 最小的连接
+	PickerLeastLoaded = "least_loaded"
+)
+
+//重建连接的退避策略
+var redialSetting = retry.Setting{
+	MaxAttempts:    -1,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+type poolConn struct {
+	target string
+	client *GrpcClient
+	//健康权重 0 不参与选择
+	weight   int32
+	failures int32
+	inflight int64
+	evicted  int32
+	//平滑加权轮询的当前权重 由 roundRobinPicker 持锁修改
+	current int64
+}
+
+func (c *poolConn) getWeight() int32 {
+	return atomic.LoadInt32(&c.weight)
+}
+
+//健康检查不计入负载
+func (c *poolConn) unaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if method == healthCheckMethod {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	atomic.AddInt64(&c.inflight, 1)
+	defer atomic.AddInt64(&c.inflight, -1)
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+//流结束时 stream context 被取消
+func (c *poolConn) streamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	atomic.AddInt64(&c.inflight, 1)
+	s, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		atomic.AddInt64(&c.inflight, -1)
+		return nil, err
+	}
+	go func() {
+		<-s.Context().Done()
+		atomic.AddInt64(&c.inflight, -1)
+	}()
+	return s, nil
+}
+
+//只关闭底层连接 不置空 已取得 client 的调用返回错误
+func (c *poolConn) close() {
+	if conn := c.client.GetConn(); conn != nil {
+		_ = conn.Close()
+	}
+}
+
+type picker interface {
+	pick(conns []*poolConn) *poolConn
+}
+
+func newPicker(name string) picker {
+	if name == PickerLeastLoaded {
+		return &leastLoadedPicker{}
+	}
+	return &roundRobinPicker{}
+}
+
+type roundRobinPicker struct {
+	mutex sync.Mutex
+}
+
+func (p *roundRobinPicker) pick(conns []*poolConn) *poolConn {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var (
+		best  *poolConn
+		total int64
+	)
+	for _, c := range conns {
+		w := int64(c.getWeight())
+		if w <= 0 {
+			continue
+		}
+		c.current += w
+		total += w
+		if best == nil || c.current > best.current {
+			best = c
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+type leastLoadedPicker struct {
+	next uint64
+}
+
+//起点轮转 负载相同时轮流选择
+func (p *leastLoadedPicker) pick(conns []*poolConn) *poolConn {
+	var (
+		best     *poolConn
+		bestLoad float64
+	)
+	n := len(conns)
+	start := int(atomic.AddUint64(&p.next, 1) % uint64(n))
+	for i := 0; i < n; i++ {
+		c := conns[(start+i)%n]
+		w := c.getWeight()
+		if w <= 0 {
+			continue
+		}
+		load := float64(atomic.LoadInt64(&c.inflight)+1) / float64(w)
+		if best == nil || load < bestLoad {
+			best, bestLoad = c, load
+		}
+	}
+	return best
+}
+
 type Pool struct {
 	option *Options
-	//address
-	target string
-	//容量
+	//建立连接的设置 不含重试
+	dialOption *Options
+	//当前 target 列表
+	targets []string
+	//每个 target 的连接数
 	capacity int64
-	//
-	next int64
-	sync.Mutex
-	clients []*GrpcClient
+	picker   picker
+	//[]*poolConn 写时复制 GetClient 无锁读取
+	conns   atomic.Value
+	redials uint64
+
+	//保护 targets 与 conns 的写入
+	sync.RWMutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
+//target 与 WithTargets 合并 配置 Resolver 时再合并解析结果
 func NewPool(target string, options ...Option) (*Pool, error) {
 	opts := NewOptions(options...)
 
+	dialOpts := *opts
+	dialOpts.Retry = nil
+	ctx, cancel := context.WithCancel(context.Background())
 	p := &Pool{
-		option:   opts,
-		target:   target,
-		capacity: opts.PoolCap,
-		clients:  make([]*GrpcClient, opts.PoolCap),
+		option:     opts,
+		dialOption: &dialOpts,
+		capacity:   opts.PoolCap,
+		picker:     newPicker(opts.Picker),
+		ctx:        ctx,
+		cancel:     cancel,
 	}
+	if len(target) > 0 {
+		p.option.Targets = append([]string{target}, opts.Targets...)
+	}
+	p.conns.Store([]*poolConn{})
 
-	err := p.Init()
+	lctx, lcancel := context.WithTimeout(ctx, opts.DialTimeout)
+	targets, err := p.lookup(lctx)
+	lcancel()
+	if err == nil && len(targets) == 0 {
+		err = ErrNoTarget
+	}
+	if err == nil {
+		p.targets = targets
+		err = p.Init()
+	}
 	if err != nil {
+		cancel()
 		return nil, err
 	}
+
+	if opts.HealthCheckInterval > 0 {
+		p.wg.Add(1)
+		go p.healthLoop()
+	}
+	if opts.Resolver != nil && opts.ResolveInterval > 0 {
+		p.wg.Add(1)
+		go p.resolveLoop()
+	}
 	return p, nil
 }
 
 //init connect
 func (p *Pool) Init() error {
-	for idx, _ := range p.clients {
-		c, err := p.connect()
-		if err != nil {
-			return err
-		}
-		p.clients[idx] = c
+	conns, err := p.dialTargets(p.targets, maxWeight)
+	if err != nil {
+		return err
 	}
+	p.Lock()
+	p.conns.Store(conns)
+	p.Unlock()
 	return nil
 }
 
-func (p *Pool) connect() (*GrpcClient, error) {
-	c, err := NewClient(p.target, p.option)
+//grpc 连接非阻塞 只在配置错误时失败
+func (p *Pool) dial(target string, weight int32) (*poolConn, error) {
+	c := &poolConn{target: target, weight: weight}
+	client, err := newClient(target, p.dialOption,
+		grpc.WithChainUnaryInterceptor(c.unaryInterceptor),
+		grpc.WithChainStreamInterceptor(c.streamInterceptor),
+	)
 	if err != nil {
 		return nil, err
 	}
+	c.client = client
 	return c, nil
 }
 
+func (p *Pool) dialTargets(targets []string, weight int32) ([]*poolConn, error) {
+	conns := make([]*poolConn, 0, int64(len(targets))*p.capacity)
+	for _, target := range targets {
+		for i := int64(0); i < p.capacity; i++ {
+			c, err := p.dial(target, weight)
+			if err != nil {
+				for _, c := range conns {
+					c.close()
+				}
+				return nil, err
+			}
+			conns = append(conns, c)
+		}
+	}
+	return conns, nil
+}
+
+func (p *Pool) getConns() []*poolConn {
+	return p.conns.Load().([]*poolConn)
+}
+
+//按 Picker 选择健康连接 没有连接返回 ErrNotFoundClient 全部不可用返回 ErrConnShutdown
 func (p *Pool) GetClient() (*GrpcClient, error) {
-	var (
-		idx int64
-		nxt int64
-		err error
-	)
+	conns := p.getConns()
+	if len(conns) == 0 {
+		return nil, ErrNotFoundClient
+	}
+	c := p.picker.pick(conns)
+	if c == nil {
+		return nil, ErrConnShutdown
+	}
+	return c.client, nil
+}
 
-	nxt = atomic.AddInt64(&p.next, 1)
-	idx = nxt % p.capacity
+//unary 调用 配置 WithRetry 时按策略重试 每次尝试重新选择连接
+func (p *Pool) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	if p.option.Retry == nil {
+		return p.invoke(ctx, method, args, reply, opts...)
+	}
+	rp := *p.option.Retry
+	if len(rp.Name) == 0 {
+		rp.Name = "grpc pool" + method
+	}
+	if rp.Retryable == nil {
+		rp.Retryable = RetryableError
+	}
+	return retry.Do(ctx, rp, func(ctx context.Context) error {
+		return p.invoke(ctx, method, args, reply, opts...)
+	})
+}
 
-	c := p.clients[idx]
+//没有可用连接返回 Unavailable 可重试等待连接恢复
+func (p *Pool) invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	c, err := p.GetClient()
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return c.GetConn().Invoke(ctx, method, args, reply, opts...)
+}
 
-	if c != nil && c.CheckState() == nil {
-		return c, nil
+//流式调用 选择一次连接 不重试
+func (p *Pool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	c, err := p.GetClient()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
 	}
+	return c.GetConn().NewStream(ctx, desc, method, opts...)
+}
 
-	//connect is close
-	if c != nil {
-		c.Close()
+func (p *Pool) healthLoop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.option.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkAll()
+		}
 	}
+}
 
+//并发检查所有连接
+func (p *Pool) checkAll() {
+	var wg sync.WaitGroup
+	for _, c := range p.getConns() {
+		wg.Add(1)
+		go func(c *poolConn) {
+			defer wg.Done()
+			p.check(c)
+		}(c)
+	}
+	wg.Wait()
+}
+
+func (p *Pool) check(c *poolConn) {
+	if atomic.LoadInt32(&c.evicted) == 1 {
+		return
+	}
+	err := p.probe(c)
+	if err == nil {
+		atomic.StoreInt32(&c.failures, 0)
+		w := c.getWeight() * 2
+		if w < redialWeight {
+			w = redialWeight
+		}
+		if w > maxWeight {
+			w = maxWeight
+		}
+		atomic.StoreInt32(&c.weight, w)
+		return
+	}
+	if p.ctx.Err() != nil {
+		return
+	}
+
+	failures := atomic.AddInt32(&c.failures, 1)
+	if err == ErrConnShutdown {
+		atomic.StoreInt32(&c.weight, 0)
+	} else {
+		atomic.StoreInt32(&c.weight, c.getWeight()/2)
+	}
+	log.FromContext(p.ctx).Warnf("[grpc pool] %s health check failed failures:%d error:%s", c.target, failures, err.Error())
+	conn := c.client.GetConn()
+	if int(failures) >= p.option.HealthCheckFailures || conn == nil || conn.GetState() == connectivity.Shutdown {
+		p.evict(c)
+	}
+}
+
+//连接断开返回 ErrConnShutdown 服务端未注册健康检查时以连接状态为准
+func (p *Pool) probe(c *poolConn) error {
+	conn := c.client.GetConn()
+	if conn == nil {
+		return ErrConnShutdown
+	}
+	switch conn.GetState() {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return ErrConnShutdown
+	}
+	if !p.option.HealthCheck {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(p.ctx, p.option.HealthCheckTimeout)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: p.option.HealthCheckService}, grpc.WaitForReady(true))
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return errors.New(fmt.Sprintf("health status %s", resp.GetStatus()))
+	}
+	return nil
+}
+
+//摘除连接 异步重建
+func (p *Pool) evict(c *poolConn) {
+	if !atomic.CompareAndSwapInt32(&c.evicted, 0, 1) {
+		return
+	}
+	atomic.StoreInt32(&c.weight, 0)
+	atomic.AddUint64(&p.redials, 1)
+	p.wg.Add(1)
+	go p.redial(c)
+}
+
+func (p *Pool) redial(old *poolConn) {
+	defer p.wg.Done()
+
+	var c *poolConn
+	err := retry.Do(p.ctx, retry.Policy{Name: "grpc pool redial " + old.target, Setting: redialSetting}, func(ctx context.Context) error {
+		var err error
+		c, err = p.dial(old.target, 0)
+		return err
+	})
+	if err != nil {
+		//连接池已关闭
+		old.close()
+		return
+	}
+	if !p.replace(old, c) {
+		//target 已下线或连接池已关闭
+		c.close()
+		return
+	}
+	log.FromContext(p.ctx).Infof("[grpc pool] %s redialed", old.target)
+
+	p.activate(c)
+	p.retire(old)
+}
+
+//权重为 0 的新连接 Ready 且检查通过后以低权重加入选择 失败时由健康检查恢复
+func (p *Pool) activate(c *poolConn) {
+	ctx, cancel := context.WithTimeout(p.ctx, p.option.DialTimeout)
+	defer cancel()
+	if waitReady(ctx, c.client.GetConn()) && p.probe(c) == nil {
+		atomic.CompareAndSwapInt32(&c.weight, 0, redialWeight)
+	}
+}
+
+func (p *Pool) replace(old, c *poolConn) bool {
 	p.Lock()
 	defer p.Unlock()
 
-	// double check
-	c = p.clients[idx]
-	if c != nil && c.CheckState() == nil {
-		return c, nil
+	conns := p.getConns()
+	for i, v := range conns {
+		if v != old {
+			continue
+		}
+		next := make([]*poolConn, len(conns))
+		copy(next, conns)
+		next[i] = c
+		p.conns.Store(next)
+		return true
+	}
+	return false
+}
+
+//等待执行中的请求结束后关闭连接 最长等待 drainTimeout
+func (p *Pool) retire(c *poolConn) {
+	defer c.close()
+
+	timer := time.NewTimer(drainTimeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&c.inflight) > 0 {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-timer.C:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//Idle 连接主动建立连接 等待 Ready 或 ctx 结束
+func waitReady(ctx context.Context, conn *grpc.ClientConn) bool {
+	for {
+		s := conn.GetState()
+		switch s {
+		case connectivity.Ready:
+			return true
+		case connectivity.Shutdown:
+			return false
+		case connectivity.Idle:
+			conn.Connect()
+		}
+		if !conn.WaitForStateChange(ctx, s) {
+			return false
+		}
+	}
+}
+
+func (p *Pool) resolveLoop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.option.ResolveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.resolve()
+		}
 	}
+}
 
-	client, err := p.connect()
+//解析失败或结果为空时保留当前 target
+func (p *Pool) resolve() {
+	ctx, cancel := context.WithTimeout(p.ctx, p.option.DialTimeout)
+	targets, err := p.lookup(ctx)
+	cancel()
 	if err != nil {
-		return nil, err
+		log.FromContext(p.ctx).Warnf("[grpc pool] resolve failed error:%s", err.Error())
+		return
+	}
+	if len(targets) == 0 {
+		return
 	}
-	p.clients[idx] = client
-	return client, nil
+	p.update(targets)
 }
 
-// close all
-func (p *Pool) Close() {
+//合并静态 target 与 Resolver 结果 去重排序
+func (p *Pool) lookup(ctx context.Context) ([]string, error) {
+	set := make(map[string]struct{})
+	for _, t := range p.option.Targets {
+		set[t] = struct{}{}
+	}
+	if p.option.Resolver != nil {
+		resolved, err := p.option.Resolver.Resolve(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range resolved {
+			set[t] = struct{}{}
+		}
+	}
+	targets := make([]string, 0, len(set))
+	for t := range set {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+//新 target 建立权重为 0 的连接 检查通过后加入选择 下线 target 的连接摘除后关闭
+func (p *Pool) update(targets []string) {
+	p.RLock()
+	current := make(map[string]bool, len(p.targets))
+	for _, t := range p.targets {
+		current[t] = true
+	}
+	p.RUnlock()
+
+	keep := make(map[string]bool, len(targets))
+	added := make([]string, 0)
+	for _, t := range targets {
+		keep[t] = true
+		if !current[t] {
+			added = append(added, t)
+		}
+	}
+	dialed, err := p.dialTargets(added, 0)
+	if err != nil {
+		log.FromContext(p.ctx).Warnf("[grpc pool] dial %s failed error:%s", strings.Join(added, ","), err.Error())
+		return
+	}
+
 	p.Lock()
-	defer p.Unlock()
+	if p.ctx.Err() != nil {
+		p.Unlock()
+		for _, c := range dialed {
+			c.close()
+		}
+		return
+	}
+	removed := make([]*poolConn, 0)
+	next := make([]*poolConn, 0, len(p.getConns())+len(dialed))
+	for _, c := range p.getConns() {
+		if keep[c.target] {
+			next = append(next, c)
+			continue
+		}
+		//不再重建
+		atomic.StoreInt32(&c.evicted, 1)
+		removed = append(removed, c)
+	}
+	next = append(next, dialed...)
+	p.conns.Store(next)
+	p.targets = targets
+	p.Unlock()
 
-	for _, c := range p.clients {
-		if c == nil || c.GetConn() == nil {
+	if len(added) > 0 || len(removed) > 0 {
+		log.FromContext(p.ctx).Infof("[grpc pool] targets updated:%s", strings.Join(targets, ","))
+	}
+	for _, c := range dialed {
+		p.wg.Add(1)
+		go func(c *poolConn) {
+			defer p.wg.Done()
+			p.activate(c)
+		}(c)
+	}
+	for _, c := range removed {
+		p.wg.Add(1)
+		go func(c *poolConn) {
+			defer p.wg.Done()
+			p.retire(c)
+		}(c)
+	}
+}
+
+//连接池状态
+type PoolStats struct {
+	//多个 target 以逗号连接
+	Target   string
+	Capacity int64
+	//连接状态 => 数量 未建立连接为 nil
+	States map[string]int
+	//权重大于 0 可被选择的连接数
+	Healthy  int
+	Inflight int64
+	//累计重建次数
+	Redials uint64
+}
+
+//连接池状态统计
+func (p *Pool) Stats() PoolStats {
+	p.RLock()
+	targets := p.targets
+	p.RUnlock()
+
+	stats := PoolStats{
+		Target:   strings.Join(targets, ","),
+		Capacity: p.capacity * int64(len(targets)),
+		States:   make(map[string]int),
+		Redials:  atomic.LoadUint64(&p.redials),
+	}
+	for _, c := range p.getConns() {
+		if c.client.GetConn() == nil {
+			stats.States["nil"]++
 			continue
 		}
-		c.Close()
+		stats.States[c.client.GetConn().GetState().String()]++
+		if c.getWeight() > 0 {
+			stats.Healthy++
+		}
+		stats.Inflight += atomic.LoadInt64(&c.inflight)
+	}
+	return stats
+}
+
+// close all
+func (p *Pool) Close() {
+	p.cancel()
+	p.Lock()
+	conns := p.getConns()
+	p.conns.Store([]*poolConn{})
+	p.Unlock()
+
+	p.wg.Wait()
+	for _, c := range conns {
+		c.close()
 	}
 }
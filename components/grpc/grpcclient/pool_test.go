@@ -0,0 +1,190 @@
+package grpcclient
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/jeevic/lego/components/retry"
+)
+
+func startHealthServer(t *testing.T) (string, *health.Server, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := grpc.NewServer()
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(s, hs)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	return lis.Addr().String(), hs, s.Stop
+}
+
+func poolTargets(p *Pool) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		c, err := p.GetClient()
+		if err != nil {
+			continue
+		}
+		counts[c.GetConn().Target()]++
+	}
+	return counts
+}
+
+func TestPoolTargets(t *testing.T) {
+	p, err := NewPool("", WithTargets("127.0.0.1:1", "127.0.0.1:2"), WithPoolCap(2), WithHealthCheckInterval(0))
+	assert.Nil(t, err)
+	defer p.Close()
+
+	counts := poolTargets(p)
+	assert.Equal(t, 50, counts["127.0.0.1:1"])
+	assert.Equal(t, 50, counts["127.0.0.1:2"])
+
+	st := p.Stats()
+	assert.Equal(t, "127.0.0.1:1,127.0.0.1:2", st.Target)
+	assert.Equal(t, int64(4), st.Capacity)
+	assert.Equal(t, 4, st.Healthy)
+
+	_, err = NewPool("", WithHealthCheckInterval(0))
+	assert.Equal(t, ErrNoTarget, err)
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	addr1, _, stop1 := startHealthServer(t)
+	defer stop1()
+	addr2, hs2, stop2 := startHealthServer(t)
+	defer stop2()
+
+	p, err := NewPool(addr1, WithTargets(addr2), WithPoolCap(1), WithHealthCheckInterval(0), WithHealthCheckFailures(2))
+	assert.Nil(t, err)
+	defer p.Close()
+
+	p.checkAll()
+	assert.Equal(t, 2, p.Stats().Healthy)
+
+	//不健康的连接权重降低 多次失败后不再被选择
+	hs2.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	p.checkAll()
+	counts := poolTargets(p)
+	assert.True(t, counts[addr1] > counts[addr2], counts)
+
+	p.checkAll()
+	assert.Equal(t, uint64(1), p.Stats().Redials)
+	assert.Eventually(t, func() bool {
+		return poolTargets(p)[addr2] == 0 && p.Stats().Healthy == 1
+	}, time.Second, 10*time.Millisecond)
+
+	//恢复后重建的连接逐步恢复权重
+	hs2.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	p.checkAll()
+	assert.Equal(t, 2, p.Stats().Healthy)
+	assert.True(t, poolTargets(p)[addr2] > 0)
+}
+
+func TestPoolPickerLeastLoaded(t *testing.T) {
+	p, err := NewPool("", WithTargets("127.0.0.1:1", "127.0.0.1:2"), WithPoolCap(1),
+		WithPicker(PickerLeastLoaded), WithHealthCheckInterval(0))
+	assert.Nil(t, err)
+	defer p.Close()
+
+	conns := p.getConns()
+	atomic.StoreInt64(&conns[0].inflight, 5)
+	for i := 0; i < 10; i++ {
+		c, err := p.GetClient()
+		assert.Nil(t, err)
+		assert.Equal(t, conns[1].client, c)
+	}
+
+	//权重为 0 的连接不被选择
+	atomic.StoreInt64(&conns[0].inflight, 0)
+	atomic.StoreInt32(&conns[1].weight, 0)
+	c, err := p.GetClient()
+	assert.Nil(t, err)
+	assert.Equal(t, conns[0].client, c)
+	atomic.StoreInt32(&conns[0].weight, 0)
+	_, err = p.GetClient()
+	assert.Equal(t, ErrConnShutdown, err)
+}
+
+func TestPoolResolver(t *testing.T) {
+	addr2, _, stop2 := startHealthServer(t)
+	defer stop2()
+	var targets atomic.Value
+	targets.Store([]string{"127.0.0.1:1"})
+	resolver := ResolverFunc(func(ctx context.Context) ([]string, error) {
+		return targets.Load().([]string), nil
+	})
+	p, err := NewPool("", WithResolver(resolver, time.Hour), WithPoolCap(1), WithHealthCheckInterval(0))
+	assert.Nil(t, err)
+	defer p.Close()
+	assert.Equal(t, "127.0.0.1:1", p.Stats().Target)
+
+	//新 target 检查通过前不被选择
+	added := []string{addr2, "127.0.0.1:3"}
+	sort.Strings(added)
+	targets.Store(added)
+	p.resolve()
+	assert.Equal(t, strings.Join(added, ","), p.Stats().Target)
+	assert.Equal(t, 0, p.Stats().Healthy)
+	assert.Eventually(t, func() bool {
+		return p.Stats().Healthy == 1
+	}, time.Second, 10*time.Millisecond)
+	counts := poolTargets(p)
+	assert.Equal(t, 0, counts["127.0.0.1:1"])
+	assert.Equal(t, 0, counts["127.0.0.1:3"])
+	assert.Equal(t, 100, counts[addr2])
+	for _, c := range p.getConns() {
+		if c.target == addr2 {
+			assert.Equal(t, int32(redialWeight), c.getWeight())
+		}
+	}
+
+	//解析为空时保留当前 target
+	targets.Store([]string{})
+	p.resolve()
+	assert.Equal(t, strings.Join(added, ","), p.Stats().Target)
+}
+
+func TestPoolInvokeRetry(t *testing.T) {
+	addr, _, stop := startHealthServer(t)
+	defer stop()
+
+	//失效连接返回 Unavailable 重试时换到其他连接
+	p, err := NewPool("127.0.0.1:1", WithTargets(addr), WithPoolCap(1), WithHealthCheckInterval(0),
+		WithRetry(retry.Policy{Setting: retry.Setting{MaxAttempts: 2, InitialBackoff: time.Millisecond}}))
+	assert.Nil(t, err)
+	defer p.Close()
+
+	client := healthpb.NewHealthClient(p)
+	for i := 0; i < 10; i++ {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		assert.Nil(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+	}
+
+	atomic.StoreInt32(&p.getConns()[1].weight, 0)
+	atomic.StoreInt32(&p.getConns()[0].weight, 0)
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestPoolClose(t *testing.T) {
+	p, err := NewPool("127.0.0.1:1", WithHealthCheckInterval(10*time.Millisecond))
+	assert.Nil(t, err)
+	p.Close()
+	_, err = p.GetClient()
+	assert.Equal(t, ErrNotFoundClient, err)
+	p.Close()
+}
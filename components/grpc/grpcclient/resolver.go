@@ -0,0 +1,36 @@
+package grpcclient
+
+import (
+	"context"
+	"net"
+)
+
+//解析连接池 target 列表
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+type ResolverFunc func(ctx context.Context) ([]string, error)
+
+func (f ResolverFunc) Resolve(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+//按 DNS 解析 host:port 为 ip:port 列表 适用于 k8s headless service
+func NewDNSResolver(target string) (Resolver, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	return ResolverFunc(func(ctx context.Context) ([]string, error) {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		targets := make([]string, 0, len(addrs))
+		for _, addr := range addrs {
+			targets = append(targets, net.JoinHostPort(addr, port))
+		}
+		return targets, nil
+	}), nil
+}
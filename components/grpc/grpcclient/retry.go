@@ -0,0 +1,42 @@
+package grpcclient
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/jeevic/lego/components/retry"
+)
+
+//重试拦截器 只重试 unary 调用 流式调用无法重放
+//在熔断拦截器之外 每次尝试都计入熔断 熔断拒绝时不重试
+
+//默认重试的状态码
+var RetryCodes = map[codes.Code]bool{
+	codes.Unavailable:       true,
+	codes.ResourceExhausted: true,
+	codes.Aborted:           true,
+}
+
+//默认重试判断
+func RetryableError(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && RetryCodes[s.Code()]
+}
+
+func RetryUnaryClientInterceptor(p retry.Policy) grpc.UnaryClientInterceptor {
+	if p.Retryable == nil {
+		p.Retryable = RetryableError
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		mp := p
+		if len(mp.Name) == 0 {
+			mp.Name = cc.Target() + method
+		}
+		return retry.Do(ctx, mp, func(ctx context.Context) error {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})
+	}
+}
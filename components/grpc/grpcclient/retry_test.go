@@ -0,0 +1,50 @@
+package grpcclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/jeevic/lego/components/retry"
+)
+
+func TestRetryableError(t *testing.T) {
+	assert.True(t, RetryableError(status.Error(codes.Unavailable, "unavailable")))
+	assert.True(t, RetryableError(status.Error(codes.ResourceExhausted, "exhausted")))
+	assert.False(t, RetryableError(status.Error(codes.NotFound, "not found")))
+	assert.False(t, RetryableError(status.Error(codes.DeadlineExceeded, "deadline")))
+	assert.False(t, RetryableError(nil))
+}
+
+func TestRetryUnaryClientInterceptor(t *testing.T) {
+	cc, err := grpc.Dial("retry-test:9000", grpc.WithInsecure())
+	assert.Nil(t, err)
+	defer cc.Close()
+
+	p := retry.Policy{Setting: retry.Setting{MaxAttempts: 3, InitialBackoff: time.Millisecond}}
+	interceptor := RetryUnaryClientInterceptor(p)
+
+	invoked := 0
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if invoked++; invoked < 3 {
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+		return nil
+	}
+	assert.Nil(t, interceptor(context.Background(), "/test.Service/Unary", nil, nil, cc, invoker))
+	assert.Equal(t, 3, invoked)
+
+	invoked = 0
+	invoker = func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		invoked++
+		return status.Error(codes.NotFound, "not found")
+	}
+	err = interceptor(context.Background(), "/test.Service/Unary", nil, nil, cc, invoker)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, 1, invoked)
+}
@@ -0,0 +1,35 @@
+package grpc_ratelimiter
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/jeevic/lego/components/ratelimit"
+)
+
+//自适应并发限制 过载返回 ResourceExhausted
+func AdaptiveUnaryServerInterceptor(l *ratelimit.AdaptiveLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		done, ok := l.Acquire()
+		if !ok {
+			return nil, status.Errorf(codes.ResourceExhausted, "%s is rejected by adaptive limiter, server overloaded.", info.FullMethod)
+		}
+		defer done()
+		return handler(ctx, req)
+	}
+}
+
+//流式请求按整个流的持续时间统计
+func AdaptiveStreamServerInterceptor(l *ratelimit.AdaptiveLimiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done, ok := l.Acquire()
+		if !ok {
+			return status.Errorf(codes.ResourceExhausted, "%s is rejected by adaptive limiter, server overloaded.", info.FullMethod)
+		}
+		defer done()
+		return handler(srv, stream)
+	}
+}
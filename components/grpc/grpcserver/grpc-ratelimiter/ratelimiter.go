@@ -2,63 +2,136 @@ package grpc_ratelimiter
 
 import (
 	"context"
-	"sync"
+	"net"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/juju/ratelimit"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+
+	"github.com/jeevic/lego/components/metrics"
+	"github.com/jeevic/lego/components/ratelimit"
 )
 
-//全局限流标志
+//全局限流标志 全局限流与方法限流同时生效
 const LegoWholeAppSign = "_lego_whole_app#lego"
 
-//限流模块
+//限流模块 策略 path 为 FullMethod key_by 支持 route ip metadata:<key>
 var RateLimiter = RateLimit{
-	RB: make(map[string]*ratelimit.Bucket),
+	Engine: ratelimit.NewEngine(),
 }
 
 type RateLimit struct {
-	//存储url对应的bucket
-	RB    map[string]*ratelimit.Bucket
-	mutex sync.Mutex
+	//限流策略
+	*ratelimit.Engine
 }
 
-//添加对应的路径和限速速率
+//添加对应的方法和限速速率 每秒 capacity 次
 func (r *RateLimit) AddRateLimit(path string, capacity int64) {
-	defer r.mutex.Unlock()
-	r.mutex.Lock()
-	r.RB[path] = ratelimit.NewBucketWithQuantum(1*time.Second, capacity, capacity)
+	_ = r.AddPolicy(ratelimit.Policy{Name: path, Path: path, Limit: capacity, Period: time.Second})
 }
 
-//单容器进行限速 设置后 对单App不生效
+//单容器进行限速
 func (r *RateLimit) AddWholeRateLimit(capacity int64) {
-	defer r.mutex.Unlock()
-	r.mutex.Lock()
-	r.RB[LegoWholeAppSign] = ratelimit.NewBucketWithQuantum(1*time.Second, capacity, capacity)
+	_ = r.AddPolicy(ratelimit.Policy{Name: LegoWholeAppSign, Limit: capacity, Period: time.Second})
+}
+
+//删除对应方法的限速 path 为 LegoWholeAppSign 时删除全局限流
+func (r *RateLimit) RemoveRateLimit(path string) {
+	r.RemovePolicy(path)
+}
+
+//整体替换限速配置 whole <= 0 时不设置全局限流 容量 <= 0 的方法忽略
+//容量未变化的 bucket 保留 避免重置令牌
+func (r *RateLimit) ResetRateLimit(whole int64, paths map[string]int64) {
+	_ = r.SetPolicies(PathPolicies(whole, paths))
+}
+
+//按方法容量生成策略
+func PathPolicies(whole int64, paths map[string]int64) []ratelimit.Policy {
+	ps := make([]ratelimit.Policy, 0, len(paths)+1)
+	if whole > 0 {
+		ps = append(ps, ratelimit.Policy{Name: LegoWholeAppSign, Limit: whole, Period: time.Second})
+	}
+	names := make([]string, 0, len(paths))
+	for path := range paths {
+		names = append(names, path)
+	}
+	sort.Strings(names)
+	for _, path := range names {
+		if capacity := paths[path]; capacity > 0 {
+			ps = append(ps, ratelimit.Policy{Name: path, Path: path, Limit: capacity, Period: time.Second})
+		}
+	}
+	return ps
+}
+
+type grpcRequest struct {
+	ctx        context.Context
+	fullMethod string
+}
+
+func (r grpcRequest) Route() string {
+	return r.fullMethod
+}
+
+func (r grpcRequest) Method() string {
+	return ""
+}
+
+func (r grpcRequest) ClientIP() string {
+	p, ok := peer.FromContext(r.ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func (r grpcRequest) Header(key string) string {
+	md, ok := metadata.FromIncomingContext(r.ctx)
+	if !ok {
+		return ""
+	}
+	if v := md.Get(strings.ToLower(key)); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+//限流检查 命中策略时返回 x-ratelimit-* retry-after 响应头
+func allow(ctx context.Context, fullMethod string) (metadata.MD, error) {
+	res, matched := RateLimiter.Allow(ctx, grpcRequest{ctx: ctx, fullMethod: fullMethod})
+	if !matched {
+		return nil, nil
+	}
+	md := metadata.MD{}
+	for k, v := range res.Headers() {
+		md.Set(k, v)
+	}
+	if !res.Allowed {
+		metrics.RateLimitRejected.WithLabelValues("grpc", fullMethod).Inc()
+		return md, status.Errorf(codes.ResourceExhausted, "%s is rejected by grpc_ratelimit middleware, please retry after %ss.", fullMethod, md.Get("retry-after")[0])
+	}
+	return md, nil
 }
 
 // UnaryServerInterceptor returns a new unary server interceptors that performs request rate limiting.
 func RateLimiterUnaryServerInterceptor() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		path := info.FullMethod
-
-		var bucket *ratelimit.Bucket
-		var ok bool
-
-		bucket, ok = RateLimiter.RB[LegoWholeAppSign]
-		// 如果没有全局限流 则获取单个接口限流
-		if !ok {
-			//获取限流
-			bucket, ok = RateLimiter.RB[path]
+		md, err := allow(ctx, info.FullMethod)
+		if len(md) > 0 {
+			_ = grpc.SetHeader(ctx, md)
 		}
-		if ok {
-			take := bucket.TakeAvailable(1)
-			//如果未获取到take中断停止
-			if take == 0 {
-				return nil, status.Errorf(codes.ResourceExhausted, "%s is rejected by grpc_ratelimit middleware, please retry later.", info.FullMethod)
-			}
+		if err != nil {
+			return nil, err
 		}
 		return handler(ctx, req)
 	}
@@ -67,22 +140,12 @@ func RateLimiterUnaryServerInterceptor() grpc.UnaryServerInterceptor {
 // StreamServerInterceptor returns a new stream server interceptor that performs rate limiting on the request.
 func RateLimiterStreamServerInterceptor() grpc.StreamServerInterceptor {
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		path := info.FullMethod
-
-		var bucket *ratelimit.Bucket
-		var ok bool
-		bucket, ok = RateLimiter.RB[LegoWholeAppSign]
-		// 如果没有全局限流 则获取单个接口限流
-		if !ok {
-			//获取限流
-			bucket, ok = RateLimiter.RB[path]
+		md, err := allow(stream.Context(), info.FullMethod)
+		if len(md) > 0 {
+			_ = stream.SetHeader(md)
 		}
-		if ok {
-			take := bucket.TakeAvailable(1)
-			//如果未获取到take中断停止
-			if take == 0 {
-				return status.Errorf(codes.ResourceExhausted, "%s is rejected by grpc_ratelimit middleware, please retry later.", info.FullMethod)
-			}
+		if err != nil {
+			return err
 		}
 		return handler(srv, stream)
 	}
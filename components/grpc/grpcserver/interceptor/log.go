@@ -4,57 +4,49 @@ import (
 	"context"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/peer"
 
 	"github.com/jeevic/lego/components/grpc/grpcserver"
+	"github.com/jeevic/lego/components/log"
 	"github.com/jeevic/lego/pkg/app"
 )
 
 //this is a log unary or stream
+//request_id trace_id 由 requestid 拦截器绑定到 ctx logger 未绑定时从 ctx 读取 request_id
 
 func LogUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	requestId := ""
-	clientIp := ""
-	path := ""
-	errMsg := ""
-
-	requestId = grpcserver.FromContextRequestId(ctx, app.App.GetRequestId())
-	p, ok := peer.FromContext(ctx)
-	if ok {
-		clientIp = p.Addr.String()
-	}
-
-	path = info.FullMethod
 	start := time.Now()
 	m, err := handler(ctx, req)
-	if err != nil {
-		errMsg = err.Error()
-	}
-	latency := time.Now().Sub(start)
-	format := "grpc unary requestId=%s, client-ip=%s, path=%s, latency=%s, error-message=%s \n"
-	app.App.GetLogger().Infof(format, requestId, clientIp, path, latency, errMsg)
+	accessLog(ctx, info.FullMethod, start, err).Info("grpc unary")
 	return m, err
 }
 
 func LogStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-	requestId := ""
+	start := time.Now()
+	err := handler(srv, ss)
+	accessLog(ss.Context(), info.FullMethod, start, err).Info("grpc stream")
+	return err
+}
+
+func accessLog(ctx context.Context, path string, start time.Time, err error) *logrus.Entry {
 	clientIp := ""
-	path := ""
-	errMsg := ""
-	requestId = grpcserver.FromContextRequestId(ss.Context(), app.App.GetRequestId())
-	p, ok := peer.FromContext(ss.Context())
-	if ok {
+	if p, ok := peer.FromContext(ctx); ok {
 		clientIp = p.Addr.String()
 	}
-	path = info.FullMethod
-	start := time.Now()
-	err := handler(srv, ss)
+	errMsg := ""
 	if err != nil {
 		errMsg = err.Error()
 	}
-	latency := time.Now().Sub(start)
-	format := "grpc stream res requestId=%s, client-ip=%s, path=%s, latency=%s, error-message=%s \n"
-	app.App.GetLogger().Infof(format, requestId, clientIp, path, latency, errMsg)
-	return err
+	entry := log.FromContext(ctx)
+	if _, ok := entry.Data["request_id"]; !ok {
+		entry = entry.WithField("request_id", grpcserver.FromContextRequestId(ctx, app.App.GetRequestId()))
+	}
+	return entry.WithFields(logrus.Fields{
+		"path":          path,
+		"client-ip":     clientIp,
+		"latency":       time.Since(start).String(),
+		"error-message": errMsg,
+	})
 }
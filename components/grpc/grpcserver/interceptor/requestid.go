@@ -8,6 +8,8 @@ import (
 	"google.golang.org/grpc/metadata"
 
 	"github.com/jeevic/lego/components/grpc/grpcserver"
+	"github.com/jeevic/lego/components/log"
+	"github.com/jeevic/lego/components/tracing"
 	"github.com/jeevic/lego/pkg/app"
 )
 
@@ -23,6 +25,7 @@ func RequestIdUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.
 		}
 	}
 	ctx = context.WithValue(ctx, requestIdKey, requestId)
+	ctx = withLogger(ctx, requestId, info.FullMethod)
 	_ = grpc.SetHeader(ctx, metadata.MD{requestIdKey: []string{requestId}})
 	m, err := handler(ctx, req)
 	return m, err
@@ -41,12 +44,22 @@ func RequestIdStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grp
 		}
 	}
 	ctx = context.WithValue(ctx, requestIdKey, requestId)
+	ctx = withLogger(ctx, requestId, info.FullMethod)
 	ss = grpcserver.NewWrappedServerStream(ss, ctx)
 	_ = ss.SetHeader(metadata.MD{requestIdKey: []string{requestId}})
 	err := handler(srv, ss)
 	return err
 }
 
+//绑定请求 logger handler 中 log.FromContext(ctx) 获取
+func withLogger(ctx context.Context, requestId string, fullMethod string) context.Context {
+	fields := tracing.LogFields(ctx)
+	fields["request_id"] = requestId
+	fields["method"] = "grpc"
+	fields["path"] = fullMethod
+	return log.WithFields(ctx, fields)
+}
+
 func newRequestId() string {
 	return uuid.New().String()
 }
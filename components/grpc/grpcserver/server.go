@@ -1,19 +1,30 @@
 package grpcserver
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net"
-	"os"
+	"sync/atomic"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
+
+	"github.com/jeevic/lego/components/config"
+	"github.com/jeevic/lego/components/graceful"
 )
 
+//组件名称
+const ComponentName = "grpcserver"
+
 type GrpcServer struct {
 	option *Options
 	//address
 	target string
 	Server *grpc.Server
+	//运行状态 1 运行中
+	running int32
 }
 
 func NewGrpcServer(target string, options ...Option) (*GrpcServer, error) {
@@ -79,42 +90,88 @@ func (s *GrpcServer) RegisterService(f func(s *grpc.Server, srv interface{}), ss
 }
 
 func (s *GrpcServer) Run() error {
+	lis, err := s.listen()
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&s.running, 1)
+	return s.serve(lis)
+}
+
+//平滑重启时 复用父进程传递的监听
+func (s *GrpcServer) listen() (net.Listener, error) {
 	//reflection for query api
 	reflection.Register(s.Server)
 
-	var lis net.Listener
-	var err error
+	network := "tcp"
 	if s.option.UnixSocket {
-		_ = os.Remove(s.target)
-		unixAddr, err := net.ResolveUnixAddr("unix", s.target)
-		if err != nil {
-			return err
-		}
-		lis, err = net.ListenUnix("unix", unixAddr)
-		if err != nil {
-			return err
-		}
+		network = "unix"
+	}
+	return graceful.Listen(ComponentName, network, s.target)
+}
 
-	} else {
-		lis, err = net.Listen("tcp", s.target)
-		if err != nil {
-			return err
+func (s *GrpcServer) serve(lis net.Listener) error {
+	defer atomic.StoreInt32(&s.running, 0)
+	return s.Server.Serve(lis)
+}
+
+func (s *GrpcServer) RunAsync() {
+	go func() {
+		if err := s.Run(); err != nil {
+			log.Printf("grpc server run err:%s", err)
 		}
-	}
+	}()
+}
 
-	err = s.Server.Serve(lis)
+func (s *GrpcServer) GracefulShutdown() {
+	s.Server.GracefulStop()
+}
+
+//组件名称
+func (s *GrpcServer) Name() string {
+	return ComponentName
+}
+
+//组件初始化 server 由 NewGrpcServer 创建 无需处理
+func (s *GrpcServer) Init(cfg *config.Config) error {
+	return nil
+}
+
+//组件启动 监听失败时返回错误 只有 Serve 在协程中运行
+func (s *GrpcServer) Start() error {
+	lis, err := s.listen()
 	if err != nil {
 		return err
 	}
+	atomic.StoreInt32(&s.running, 1)
+	go func() {
+		if err := s.serve(lis); err != nil {
+			log.Printf("grpc server serve err:%s", err)
+		}
+	}()
 	return nil
 }
 
-func (s *GrpcServer) RunAsync() {
+//组件停止 优雅关闭 ctx超时后强制关闭
+func (s *GrpcServer) Stop(ctx context.Context) error {
+	done := make(chan struct{})
 	go func() {
-		_ = s.Run()
+		s.Server.GracefulStop()
+		close(done)
 	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.Server.Stop()
+		return ctx.Err()
+	}
 }
 
-func (s *GrpcServer) GracefulShutdown() {
-	s.Server.GracefulStop()
+//组件健康检查
+func (s *GrpcServer) Health() error {
+	if atomic.LoadInt32(&s.running) != 1 {
+		return errors.New("grpc server not running")
+	}
+	return nil
 }
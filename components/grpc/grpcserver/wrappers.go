@@ -20,7 +20,9 @@ func (w *WrappedServerStream) Context() context.Context {
 
 // WrapServerStream returns a ServerStream that has the ability to overwrite context.
 func NewWrappedServerStream(stream grpc.ServerStream, ctx context.Context) grpc.ServerStream {
+	//已包装时更新 ctx 避免多个拦截器包装时丢失后设置的 ctx
 	if existing, ok := stream.(*WrappedServerStream); ok {
+		existing.WrappedContext = ctx
 		return existing
 	}
 	return &WrappedServerStream{
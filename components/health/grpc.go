@@ -0,0 +1,80 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+//grpc.health.v1.Health 实现
+//service 为空时返回整体就绪状态 否则返回对应检查 如 redis.app
+type GrpcHealthServer struct {
+	//Watch 检查间隔
+	WatchInterval time.Duration
+}
+
+//注册 grpc 健康检查服务
+func UseGrpcHealth(s *grpc.Server) *GrpcHealthServer {
+	hs := NewGrpcHealthServer()
+	healthpb.RegisterHealthServer(s, hs)
+	return hs
+}
+
+func NewGrpcHealthServer() *GrpcHealthServer {
+	return &GrpcHealthServer{WatchInterval: 5 * time.Second}
+}
+
+func (s *GrpcHealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	st, err := s.status(ctx, req.GetService())
+	if err != nil {
+		return nil, err
+	}
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+//状态变化时推送 检查项不存在时推送 SERVICE_UNKNOWN
+func (s *GrpcHealthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	last := healthpb.HealthCheckResponse_ServingStatus(-1)
+	ticker := time.NewTicker(s.WatchInterval)
+	defer ticker.Stop()
+	for {
+		st, err := s.status(stream.Context(), req.GetService())
+		if err != nil {
+			st = healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+		}
+		if st != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return status.Error(codes.Canceled, "stream has ended")
+			}
+			last = st
+		}
+		select {
+		case <-stream.Context().Done():
+			return status.Error(codes.Canceled, "stream has ended")
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *GrpcHealthServer) status(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	if len(service) == 0 {
+		if Ready(ctx).Ok {
+			return healthpb.HealthCheckResponse_SERVING, nil
+		}
+		return healthpb.HealthCheckResponse_NOT_SERVING, nil
+	}
+	mg.mutex.RLock()
+	_, ok := mg.checks[service]
+	mg.mutex.RUnlock()
+	if !ok {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, status.Error(codes.NotFound, "unknown service")
+	}
+	if !IsServing() || Check(ctx, service) != nil {
+		return healthpb.HealthCheckResponse_NOT_SERVING, nil
+	}
+	return healthpb.HealthCheckResponse_SERVING, nil
+}
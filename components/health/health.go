@@ -0,0 +1,194 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//健康检查 聚合各组件检查结果
+//liveness 存活检查 只包含进程内组件 如 http grpc server
+//readiness 就绪检查 包含存活检查和外部依赖 如 redis mongo kafka 关闭时先切换为不可用
+//usage:
+//	health.RegisterLiveness("httpserver", func(ctx context.Context) error { return nil })
+//	health.Register("redis.app", func(ctx context.Context) error { return r.Ping(ctx) })
+//	health.SetServing(true)
+//	report := health.Ready(context.Background())
+
+//单个检查超时时间
+var CheckTimeout = 3 * time.Second
+
+//关闭中 不再接收流量
+var ErrNotServing = errors.New("not serving")
+
+//检查函数
+type Checker func(ctx context.Context) error
+
+//检查结果
+type Report struct {
+	//是否通过
+	Ok bool `json:"ok"`
+	//各组件检查结果 空字符串为正常
+	Checks map[string]string `json:"checks"`
+}
+
+type check struct {
+	checker  Checker
+	liveness bool
+}
+
+var mg Manager
+var once sync.Once
+
+func init() {
+	once.Do(func() {
+		mg = Manager{
+			checks: make(map[string]check),
+		}
+	})
+}
+
+type Manager struct {
+	checks  map[string]check
+	serving int32
+	mutex   sync.RWMutex
+}
+
+//注册就绪检查 同名覆盖
+func Register(name string, checker Checker) {
+	defer mg.mutex.Unlock()
+	mg.mutex.Lock()
+	mg.checks[name] = check{checker: checker}
+}
+
+//注册存活检查 同时作为就绪检查
+func RegisterLiveness(name string, checker Checker) {
+	defer mg.mutex.Unlock()
+	mg.mutex.Lock()
+	mg.checks[name] = check{checker: checker, liveness: true}
+}
+
+func Unregister(name string) {
+	defer mg.mutex.Unlock()
+	mg.mutex.Lock()
+	delete(mg.checks, name)
+}
+
+//检查名称
+func Names() []string {
+	mg.mutex.RLock()
+	names := make([]string, 0, len(mg.checks))
+	for name := range mg.checks {
+		names = append(names, name)
+	}
+	mg.mutex.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+//设置是否可接收流量
+func SetServing(serving bool) {
+	var v int32
+	if serving {
+		v = 1
+	}
+	atomic.StoreInt32(&mg.serving, v)
+}
+
+func IsServing() bool {
+	return atomic.LoadInt32(&mg.serving) == 1
+}
+
+//存活检查
+func Live(ctx context.Context) Report {
+	return run(ctx, true)
+}
+
+//就绪检查 不可接收流量时不通过
+func Ready(ctx context.Context) Report {
+	report := run(ctx, false)
+	if !IsServing() {
+		report.Ok = false
+		report.Checks["serving"] = ErrNotServing.Error()
+	}
+	return report
+}
+
+//检查单个组件
+func Check(ctx context.Context, name string) error {
+	mg.mutex.RLock()
+	c, ok := mg.checks[name]
+	mg.mutex.RUnlock()
+	if !ok {
+		return errors.New(fmt.Sprintf("health check:%s not exists", name))
+	}
+	return call(ctx, c.checker)
+}
+
+//并发执行检查
+func run(ctx context.Context, liveness bool) Report {
+	mg.mutex.RLock()
+	checks := make(map[string]Checker, len(mg.checks))
+	for name, c := range mg.checks {
+		if !liveness || c.liveness {
+			checks[name] = c.checker
+		}
+	}
+	mg.mutex.RUnlock()
+
+	report := Report{Ok: true, Checks: make(map[string]string, len(checks))}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for name, checker := range checks {
+		wg.Add(1)
+		go func(name string, checker Checker) {
+			defer wg.Done()
+			msg := ""
+			if err := call(ctx, checker); err != nil {
+				msg = err.Error()
+			}
+			mutex.Lock()
+			report.Checks[name] = msg
+			if len(msg) > 0 {
+				report.Ok = false
+			}
+			mutex.Unlock()
+		}(name, checker)
+	}
+	wg.Wait()
+	return report
+}
+
+//带超时执行 检查函数不响应 ctx 时同样按超时返回
+func call(ctx context.Context, checker Checker) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- errors.New(fmt.Sprintf("health check panic:%v", r))
+			}
+		}()
+		done <- checker(ctx)
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//清空检查 恢复为不可接收流量
+func Reset() {
+	defer mg.mutex.Unlock()
+	mg.mutex.Lock()
+	mg.checks = make(map[string]check)
+	atomic.StoreInt32(&mg.serving, 0)
+}
@@ -0,0 +1,100 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestReady(t *testing.T) {
+	defer Reset()
+	RegisterLiveness("httpserver", func(ctx context.Context) error { return nil })
+	Register("redis.app", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	live := Live(context.Background())
+	assert.True(t, live.Ok)
+	assert.Equal(t, map[string]string{"httpserver": ""}, live.Checks)
+
+	SetServing(true)
+	ready := Ready(context.Background())
+	assert.False(t, ready.Ok)
+	assert.Equal(t, "connection refused", ready.Checks["redis.app"])
+
+	Unregister("redis.app")
+	assert.True(t, Ready(context.Background()).Ok)
+
+	//关闭时切换为不可用
+	SetServing(false)
+	ready = Ready(context.Background())
+	assert.False(t, ready.Ok)
+	assert.Equal(t, ErrNotServing.Error(), ready.Checks["serving"])
+}
+
+func TestCheck_Timeout(t *testing.T) {
+	defer Reset()
+	timeout := CheckTimeout
+	CheckTimeout = 10 * time.Millisecond
+	defer func() { CheckTimeout = timeout }()
+
+	Register("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	Register("panic", func(ctx context.Context) error {
+		panic("boom")
+	})
+	assert.Equal(t, context.DeadlineExceeded, Check(context.Background(), "slow"))
+	assert.NotNil(t, Check(context.Background(), "panic"))
+	assert.NotNil(t, Check(context.Background(), "not-exists"))
+}
+
+func TestHttpHealth(t *testing.T) {
+	defer Reset()
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	UseHttpHealth(engine)
+	RegisterLiveness("httpserver", func(ctx context.Context) error { return nil })
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, LivenessPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ReadinessPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "not serving before start")
+
+	SetServing(true)
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ReadinessPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGrpcHealth(t *testing.T) {
+	defer Reset()
+	s := NewGrpcHealthServer()
+	Register("redis.app", func(ctx context.Context) error { return nil })
+	SetServing(true)
+
+	res, err := s.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+
+	res, err = s.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "redis.app"})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+
+	_, err = s.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "mongo.app"})
+	assert.NotNil(t, err)
+
+	SetServing(false)
+	res, err = s.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, res.Status)
+}
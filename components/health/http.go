@@ -0,0 +1,36 @@
+package health
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+//注册 /healthz /readyz
+func UseHttpHealth(engine *gin.Engine) {
+	engine.GET(LivenessPath, LivenessHandler)
+	engine.GET(ReadinessPath, ReadinessHandler)
+}
+
+//存活检查 不通过返回 503
+func LivenessHandler(c *gin.Context) {
+	writeReport(c, Live(c.Request.Context()))
+}
+
+//就绪检查 不通过返回 503
+func ReadinessHandler(c *gin.Context) {
+	writeReport(c, Ready(c.Request.Context()))
+}
+
+func writeReport(c *gin.Context, report Report) {
+	code := http.StatusOK
+	if !report.Ok {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, report)
+}
@@ -34,9 +34,11 @@ package httplib
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"io"
 	"io/ioutil"
 	"log"
@@ -48,11 +50,16 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"gopkg.in/yaml.v2"
+
+	"github.com/jeevic/lego/components/breakers"
+	"github.com/jeevic/lego/components/retry"
+	"github.com/jeevic/lego/components/tracing"
 )
 
 var defaultSetting = HLSettings{
@@ -159,6 +166,57 @@ type HLRequest struct {
 	resp        *http.Response
 	body        []byte
 	dump        []byte
+	//请求上下文 用于取消和链路追踪
+	ctx context.Context
+	//熔断器名称 为空不熔断
+	breaker  string
+	fallback FallbackFunc
+	//重试策略 设置后 Retries 不生效
+	retry *retry.Policy
+	//非幂等方法也重试
+	retryAllMethods bool
+}
+
+// FallbackFunc returns the response when the breaker rejects the request
+type FallbackFunc func(ctx context.Context, err error) (*http.Response, error)
+
+//5xx 响应计为熔断失败 响应照常返回
+var errServerStatus = errors.New("httplib: server error status")
+
+//WithRetry 默认重试的状态码
+var RetryStatus = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+//WithRetry 默认只重试幂等方法 非幂等方法重试可能重复写入
+var IdempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// StatusError is returned to retry.Classifier when the response status is in RetryStatus
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return "httplib: retry status " + strconv.Itoa(e.StatusCode)
+}
+
+// RetryableError is the default classifier of WithRetry, retries transport errors and RetryStatus
+func RetryableError(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return RetryStatus[se.StatusCode]
+	}
+	var ue *url.Error
+	return errors.As(err, &ue)
 }
 
 type FileReader struct {
@@ -171,6 +229,39 @@ func (b *HLRequest) GetRequest() *http.Request {
 	return b.req
 }
 
+// WithContext set request context, traceparent of ctx span is sent with request
+func (b *HLRequest) WithContext(ctx context.Context) *HLRequest {
+	b.ctx = ctx
+	return b
+}
+
+// WithBreaker wraps the request in the named breaker, 5xx responses and transport errors count as failures
+func (b *HLRequest) WithBreaker(name string) *HLRequest {
+	b.breaker = name
+	return b
+}
+
+// WithFallback sets the response used when the breaker rejects the request
+func (b *HLRequest) WithFallback(fallback FallbackFunc) *HLRequest {
+	b.fallback = fallback
+	return b
+}
+
+// WithRetry retries the request by policy with backoff, it replaces Retries.
+// Only IdempotentMethods are retried unless WithRetryAllMethods is set.
+// Requests with body set by PostFile are not retried.
+func (b *HLRequest) WithRetry(p retry.Policy) *HLRequest {
+	b.retry = &p
+	return b
+}
+
+// WithRetryAllMethods allows WithRetry to retry non-idempotent methods such as POST and PATCH,
+// use it only when the server deduplicates the request, e.g. by an idempotency key.
+func (b *HLRequest) WithRetryAllMethods() *HLRequest {
+	b.retryAllMethods = true
+	return b
+}
+
 // Setting Change request settings
 func (b *HLRequest) Setting(setting HLSettings) *HLRequest {
 	b.setting = setting
@@ -337,17 +428,22 @@ func (b *HLRequest) PostFileReader(formname, filename string, reader io.ReadClos
 func (b *HLRequest) Body(data interface{}) *HLRequest {
 	switch t := data.(type) {
 	case string:
-		bf := bytes.NewBufferString(t)
-		b.req.Body = ioutil.NopCloser(bf)
-		b.req.ContentLength = int64(len(t))
+		b.setBody([]byte(t))
 	case []byte:
-		bf := bytes.NewBuffer(t)
-		b.req.Body = ioutil.NopCloser(bf)
-		b.req.ContentLength = int64(len(t))
+		b.setBody(t)
 	}
 	return b
 }
 
+//GetBody 用于重试时重新读取 body
+func (b *HLRequest) setBody(byts []byte) {
+	b.req.Body = ioutil.NopCloser(bytes.NewReader(byts))
+	b.req.ContentLength = int64(len(byts))
+	b.req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(byts)), nil
+	}
+}
+
 // XMLBody adds request raw body encoding by XML.
 func (b *HLRequest) XMLBody(obj interface{}) (*HLRequest, error) {
 	if b.req.Body == nil && obj != nil {
@@ -355,8 +451,7 @@ func (b *HLRequest) XMLBody(obj interface{}) (*HLRequest, error) {
 		if err != nil {
 			return b, err
 		}
-		b.req.Body = ioutil.NopCloser(bytes.NewReader(byts))
-		b.req.ContentLength = int64(len(byts))
+		b.setBody(byts)
 		b.req.Header.Set("Content-Type", "application/xml")
 	}
 	return b, nil
@@ -369,8 +464,7 @@ func (b *HLRequest) YAMLBody(obj interface{}) (*HLRequest, error) {
 		if err != nil {
 			return b, err
 		}
-		b.req.Body = ioutil.NopCloser(bytes.NewReader(byts))
-		b.req.ContentLength = int64(len(byts))
+		b.setBody(byts)
 		b.req.Header.Set("Content-Type", "application/x+yaml")
 	}
 	return b, nil
@@ -383,8 +477,7 @@ func (b *HLRequest) JSONBody(obj interface{}) (*HLRequest, error) {
 		if err != nil {
 			return b, err
 		}
-		b.req.Body = ioutil.NopCloser(bytes.NewReader(byts))
-		b.req.ContentLength = int64(len(byts))
+		b.setBody(byts)
 		b.req.Header.Set("Content-Type", "application/json")
 	}
 	return b, nil
@@ -549,15 +642,162 @@ func (b *HLRequest) DoRequest() (resp *http.Response, err error) {
 		}
 		b.dump = dump
 	}
-	// retries default value is 0, it will run once.
-	// retries equal to -1, it will run forever until success
-	// retries is setted, it will retries fixed times.
-	for i := 0; b.setting.Retries == -1 || i <= b.setting.Retries; i++ {
-		resp, err = client.Do(b.req)
-		if err == nil {
-			break
+	ctx := b.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracing.Start(ctx, "HTTP "+b.req.Method, tracing.SpanKindClient)
+	defer span.End()
+	span.SetAttribute("http.method", b.req.Method)
+	span.SetAttribute("http.host", urlParsed.Host)
+	span.SetAttribute("http.target", urlParsed.Path)
+	tracing.Inject(ctx, tracing.HeaderCarrier(b.req.Header))
+	b.req = b.req.WithContext(ctx)
+
+	//单次请求 Retries 只在未设置 WithRetry 时生效
+	do := func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		req = req.WithContext(ctx)
+		if b.retry != nil {
+			return client.Do(req)
+		}
+		// retries default value is 0, it will run once.
+		// retries equal to -1, it will run forever until success
+		// retries is setted, it will retries fixed times.
+		var resp *http.Response
+		var err error
+		for i := 0; b.setting.Retries == -1 || i <= b.setting.Retries; i++ {
+			resp, err = client.Do(req)
+			if err == nil {
+				break
+			}
 		}
+		return resp, err
+	}
+	//熔断在重试之内 每次尝试都计入熔断
+	send := do
+	if len(b.breaker) > 0 {
+		send = func(ctx context.Context, req *http.Request) (*http.Response, error) {
+			return b.doBreaker(ctx, req, do)
+		}
+	}
+	if b.retry != nil {
+		resp, err = b.doRetry(ctx, b.req, send)
+	} else {
+		resp, err = send(ctx, b.req)
+	}
+	if err != nil {
+		span.SetError(err)
+	} else {
+		span.SetAttribute("http.status_code", strconv.Itoa(resp.StatusCode))
+	}
+	return resp, err
+}
+
+//按策略重试 重试前关闭上一次的响应 重试状态码用尽时返回最后一次的响应
+func (b *HLRequest) doRetry(ctx context.Context, req *http.Request, send func(context.Context, *http.Request) (*http.Response, error)) (resp *http.Response, err error) {
+	p := *b.retry
+	if len(p.Name) == 0 {
+		p.Name = req.Method + " " + req.URL.Host + req.URL.Path
+	}
+	if p.Retryable == nil {
+		p.Retryable = RetryableError
+	}
+	//非幂等方法未显式开启 body 不可重放 均只请求一次
+	if !b.retryAllMethods && !IdempotentMethods[req.Method] {
+		p.MaxAttempts = 1
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		p.MaxAttempts = 1
+	}
+	attempt := 0
+	err = retry.Do(ctx, p, func(ctx context.Context) error {
+		if attempt++; attempt > 1 {
+			if resp != nil {
+				resp.Body.Close()
+				resp = nil
+			}
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return retry.Permanent(err)
+				}
+				req.Body = body
+			}
+		}
+		var err error
+		resp, err = send(ctx, req)
+		if err != nil {
+			return err
+		}
+		if RetryStatus[resp.StatusCode] {
+			return &StatusError{StatusCode: resp.StatusCode}
+		}
+		return nil
+	})
+	//等待重试时 ctx 结束 返回 ctx 错误
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	var se *StatusError
+	if errors.As(err, &se) && resp != nil {
+		return resp, nil
+	}
+	//因 ctx 等错误结束 关闭上一次的响应
+	if err != nil && resp != nil {
+		resp.Body.Close()
+		resp = nil
+	}
+	return resp, err
+}
+
+//熔断执行单次请求 5xx 计为失败 响应照常返回 熔断时返回 fallback 的结果
+func (b *HLRequest) doBreaker(ctx context.Context, req *http.Request, do func(context.Context, *http.Request) (*http.Response, error)) (resp *http.Response, err error) {
+	fellBack := false
+	bk := breakers.NewBreaker().WithAcceptable(func(err error) bool { return err == nil })
+	if b.fallback != nil {
+		bk = bk.WithFallback(func(bkErr error) error {
+			fellBack = true
+			resp, err = b.fallback(ctx, bkErr)
+			return err
+		})
+	}
+	//熔断超时取消请求并立即返回 请求结果通过 done 传递 调用方不再读取时关闭响应
+	var (
+		doneMutex sync.Mutex
+		abandoned bool
+	)
+	done := make(chan *http.Response, 1)
+	berr := bk.GetOrBuild(b.breaker).DoCtx(ctx, func(ctx context.Context) error {
+		r, e := do(ctx, req)
+		if e != nil {
+			return e
+		}
+		doneMutex.Lock()
+		if abandoned {
+			r.Body.Close()
+		} else {
+			done <- r
+		}
+		doneMutex.Unlock()
+		if r.StatusCode >= http.StatusInternalServerError {
+			return errServerStatus
+		}
+		return nil
+	})
+	if !fellBack && (berr == nil || berr == errServerStatus) {
+		return <-done, nil
+	}
+	if !fellBack {
+		resp, err = nil, berr
+	}
+	doneMutex.Lock()
+	abandoned = true
+	select {
+	case r := <-done:
+		r.Body.Close()
+	default:
 	}
+	doneMutex.Unlock()
 	return resp, err
 }
 
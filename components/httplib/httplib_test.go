@@ -15,13 +15,20 @@
 package httplib
 
 import (
+	"context"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/jeevic/lego/components/breakers"
+	"github.com/jeevic/lego/components/retry"
+	"github.com/jeevic/lego/components/tracing"
 )
 
 func TestResponse(t *testing.T) {
@@ -33,6 +40,218 @@ func TestResponse(t *testing.T) {
 	t.Log(resp)
 }
 
+func TestWithContextTraceparent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get(tracing.TraceparentHeader)))
+	}))
+	defer ts.Close()
+
+	ctx, span := tracing.Start(context.Background(), "caller", tracing.SpanKindInternal)
+	defer span.End()
+	str, err := Get(ts.URL).WithContext(ctx).String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := tracing.ParseTraceparent(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID() != span.SpanContext().TraceID() || sc.SpanID() == span.SpanContext().SpanID() {
+		t.Fatal("traceparent should carry client span of caller trace, got " + str)
+	}
+}
+
+func TestWithBreaker(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	fallbacks := 0
+	fallback := func(ctx context.Context, err error) (*http.Response, error) {
+		fallbacks++
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("fallback"))}, nil
+	}
+	for i := 0; i < 200; i++ {
+		resp, err := Get(ts.URL).WithBreaker("httplib-test").WithFallback(fallback).DoRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusInternalServerError && resp.StatusCode != http.StatusOK {
+			t.Fatal("unexpected status", resp.StatusCode)
+		}
+		resp.Body.Close()
+	}
+	if fallbacks == 0 {
+		t.Fatal("breaker should open after 5xx responses")
+	}
+	bk, ok := breakers.Get("httplib-test")
+	if !ok || bk.Stat().Drops != uint64(fallbacks) {
+		t.Fatal("breaker should be registered with drops")
+	}
+}
+
+func TestWithBreakerTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	breakers.NewBreaker().WithTimeout(20 * time.Millisecond).GetOrBuild("httplib-timeout")
+	start := time.Now()
+	_, err := Get(ts.URL).WithBreaker("httplib-timeout").DoRequest()
+	if err != context.DeadlineExceeded {
+		t.Fatal("breaker timeout should cancel request", err)
+	}
+	if time.Since(start) > 200*time.Millisecond {
+		t.Fatal("breaker timeout should return immediately", time.Since(start))
+	}
+}
+
+//忽略 ctx 超时后仍返回响应
+type lateTransport struct {
+	closed chan struct{}
+}
+
+func (l *lateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	time.Sleep(50 * time.Millisecond)
+	return &http.Response{StatusCode: http.StatusOK, Body: &closeNotifier{closed: l.closed}, Request: req}, nil
+}
+
+type closeNotifier struct {
+	closed chan struct{}
+}
+
+func (c *closeNotifier) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (c *closeNotifier) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestWithBreakerTimeoutClosesLateResponse(t *testing.T) {
+	tr := &lateTransport{closed: make(chan struct{})}
+	breakers.NewBreaker().WithTimeout(10 * time.Millisecond).GetOrBuild("httplib-late")
+	_, err := Get("http://127.0.0.1/late").SetTransport(tr).WithBreaker("httplib-late").DoRequest()
+	if err != context.DeadlineExceeded {
+		t.Fatal("breaker timeout should cancel request", err)
+	}
+	select {
+	case <-tr.closed:
+	case <-time.After(time.Second):
+		t.Fatal("late response body should be closed")
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "payload" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if calls++; calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	p := retry.Policy{Setting: retry.Setting{MaxAttempts: 3, InitialBackoff: time.Millisecond}}
+	str, err := Put(ts.URL).Body("payload").WithRetry(p).String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str != "ok" || calls != 3 {
+		t.Fatal("request should be retried with body replayed, got", str, calls)
+	}
+
+	calls = -10
+	resp, err := Put(ts.URL).Body("payload").WithRetry(p).DoRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || calls != -7 {
+		t.Fatal("last response should be returned after attempts exhausted, got", resp.StatusCode, calls)
+	}
+
+	//非幂等方法默认不重试
+	calls = 0
+	resp, err = Post(ts.URL).Body("payload").WithRetry(p).DoRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || calls != 1 {
+		t.Fatal("post should not be retried by default, got", resp.StatusCode, calls)
+	}
+
+	calls = 0
+	str, err = Post(ts.URL).Body("payload").WithRetry(p).WithRetryAllMethods().String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str != "ok" || calls != 3 {
+		t.Fatal("post should be retried with WithRetryAllMethods, got", str, calls)
+	}
+}
+
+func TestWithRetryBreaker(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	//每次尝试都计入熔断
+	p := retry.Policy{Setting: retry.Setting{MaxAttempts: 3, InitialBackoff: time.Millisecond}}
+	resp, err := Get(ts.URL).WithBreaker("httplib-retry").WithRetry(p).DoRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	bk, _ := breakers.Get("httplib-retry")
+	if calls != 3 || bk.Stat().Total != 3 {
+		t.Fatal("every attempt should count in breaker, got", calls, bk.Stat().Total)
+	}
+}
+
+//固定返回 503
+type statusTransport struct {
+	closed chan struct{}
+}
+
+func (s *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: &closeNotifier{closed: s.closed}, Request: req}, nil
+}
+
+func TestWithRetryCancelClosesResponse(t *testing.T) {
+	tr := &statusTransport{closed: make(chan struct{})}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	//等待重试时 ctx 结束 关闭上一次的响应
+	p := retry.Policy{Setting: retry.Setting{MaxAttempts: 3, InitialBackoff: time.Second}}
+	_, err := Get("http://127.0.0.1/retry").SetTransport(tr).WithContext(ctx).WithRetry(p).DoRequest()
+	if err == nil {
+		t.Fatal("canceled retry should return error")
+	}
+	select {
+	case <-tr.closed:
+	default:
+		t.Fatal("last response body should be closed")
+	}
+}
+
 func TestGet(t *testing.T) {
 	req := Get("http://httpbin.org/get")
 	b, err := req.Bytes()
@@ -2,18 +2,29 @@ package httpserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/jeevic/lego/components/config"
+	"github.com/jeevic/lego/components/graceful"
 )
 
+//组件名称
+const ComponentName = "httpserver"
+
 type HttpServer struct {
 	Engine  *gin.Engine
 	Setting *Setting
 	Server  *http.Server
+	//运行状态 1 运行中
+	running int32
 }
 
 type Setting struct {
@@ -49,18 +60,31 @@ func (h *HttpServer) SetMiddleware(middleware ...gin.HandlerFunc) *HttpServer {
 	return h
 }
 
+//平滑重启时 复用父进程传递的监听
 func (h *HttpServer) ServerRun() {
+	lis, err := h.listen()
+	if err != nil {
+		log.Fatalf("http server listen err:%s", err)
+	}
+	h.serve(lis)
+}
+
+func (h *HttpServer) listen() (net.Listener, error) {
+	return graceful.Listen(ComponentName, "tcp", h.Server.Addr)
+}
 
+//Coroutine start server
+func (h *HttpServer) serve(lis net.Listener) {
 	isHttps := h.Setting.IsHttps
+	atomic.StoreInt32(&h.running, 1)
 
-	//Coroutine start server
 	go func() {
 		if isHttps {
-			if err := h.Server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			if err := h.Server.ServeTLS(lis, "", ""); err != nil && err != http.ErrServerClosed {
 				log.Fatalf("http server run https err:%s", err)
 			}
 		} else {
-			if err := h.Server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			if err := h.Server.Serve(lis); err != nil && err != http.ErrServerClosed {
 				log.Fatalf("graceful server run http err:%s", err)
 			}
 		}
@@ -84,4 +108,40 @@ func (h *HttpServer) GracefulShutdown() {
 	if err := h.Server.Shutdown(ctx); err != nil {
 		log.Fatalf("graceful shutdown server error: %s", err)
 	}
+	atomic.StoreInt32(&h.running, 0)
+}
+
+//组件名称
+func (h *HttpServer) Name() string {
+	return ComponentName
+}
+
+//组件初始化 server 由 NewHttpServer 创建 无需处理
+func (h *HttpServer) Init(cfg *config.Config) error {
+	return nil
+}
+
+//组件启动 监听失败时返回错误 只有 Serve 在协程中运行
+func (h *HttpServer) Start() error {
+	lis, err := h.listen()
+	if err != nil {
+		return err
+	}
+	h.serve(lis)
+	return nil
+}
+
+//组件停止 等待请求处理完成 直到ctx超时
+func (h *HttpServer) Stop(ctx context.Context) error {
+	defer atomic.StoreInt32(&h.running, 0)
+	log.Println("graceful shutdown server ...")
+	return h.Server.Shutdown(ctx)
+}
+
+//组件健康检查
+func (h *HttpServer) Health() error {
+	if atomic.LoadInt32(&h.running) != 1 {
+		return errors.New("http server not running")
+	}
+	return nil
 }
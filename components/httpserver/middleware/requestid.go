@@ -3,6 +3,10 @@ package middleware
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jeevic/lego/components/log"
+	"github.com/jeevic/lego/components/tracing"
 )
 
 func RequestIdMiddleware(requestIdName string) gin.HandlerFunc {
@@ -19,6 +23,13 @@ func RequestIdMiddleware(requestIdName string) gin.HandlerFunc {
 		c.Request.Header.Set(requestIdName, u)
 		c.Writer.Header().Set(requestIdName, u)
 
+		//绑定请求 logger handler 中 log.FromContext(c) 获取
+		fields := tracing.LogFields(c.Request.Context())
+		fields["request_id"] = u
+		fields["method"] = c.Request.Method
+		fields["path"] = c.Request.URL.Path
+		c.Request = c.Request.WithContext(log.WithFields(c.Request.Context(), logrus.Fields(fields)))
+
 		c.Next()
 	}
 }
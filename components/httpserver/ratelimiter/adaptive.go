@@ -0,0 +1,38 @@
+package ratelimiter
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jeevic/lego/components/ratelimit"
+	"github.com/jeevic/lego/pkg/app"
+	"github.com/jeevic/lego/util"
+)
+
+//过载返回 503
+var AdaptiveResFunc = func(c *gin.Context) {
+	res := util.Response{
+		Code: http.StatusServiceUnavailable,
+		Msg:  "server overloaded",
+	}
+	requestId := c.Request.Header.Get(app.App.GetRequestId())
+	if len(requestId) > 1 {
+		res.RequestId = requestId
+	}
+	c.Header("Retry-After", "1")
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, res)
+}
+
+//自适应并发限制 超过并发上限时拒绝
+func AdaptiveMiddleware(l *ratelimit.AdaptiveLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		done, ok := l.Acquire()
+		if !ok {
+			AdaptiveResFunc(c)
+			return
+		}
+		defer done()
+		c.Next()
+	}
+}
@@ -1,22 +1,26 @@
 package ratelimiter
 
 import (
-	"sync"
+	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/juju/ratelimit"
 
+	"github.com/jeevic/lego/components/metrics"
+	"github.com/jeevic/lego/components/ratelimit"
 	"github.com/jeevic/lego/pkg/app"
 	"github.com/jeevic/lego/util"
 )
 
-//全局限流标志
+//全局限流标志 全局限流与接口限流同时生效
 const LegoWholeAppSign = "_lego_whole_app#lego"
 
+//拒绝时限流结果存入 gin.Context 自定义返回可读取
+const ResultKey = "_lego_ratelimit_result"
+
 //限流模块
 var RateLimiter = RateLimit{
-	RB: make(map[string]*ratelimit.Bucket),
+	Engine: ratelimit.NewEngine(),
 	RLResFunc: func(c *gin.Context) {
 		res := util.Response{
 			Code: 403,
@@ -31,55 +35,94 @@ var RateLimiter = RateLimit{
 }
 
 type RateLimit struct {
-	//存储url对应的bucket
-	RB map[string]*ratelimit.Bucket
+	//限流策略
+	*ratelimit.Engine
 	//定义返回的 url
 	RLResFunc func(c *gin.Context)
-	mutex     sync.Mutex
 }
 
-//添加对应的路径和限速速率
+//添加对应的路径和限速速率 每秒 capacity 次
 func (r *RateLimit) AddRateLimit(path string, capacity int64) {
-	defer r.mutex.Unlock()
-	r.mutex.Lock()
-	r.RB[path] = ratelimit.NewBucketWithQuantum(1*time.Second, capacity, capacity)
+	_ = r.AddPolicy(ratelimit.Policy{Name: path, Path: path, Limit: capacity, Period: time.Second})
 }
 
-//单容器进行限速 设置后 对单App不生效
+//单容器进行限速
 func (r *RateLimit) AddWholeRateLimit(capacity int64) {
-	defer r.mutex.Unlock()
-	r.mutex.Lock()
-	r.RB[LegoWholeAppSign] = ratelimit.NewBucketWithQuantum(1*time.Second, capacity, capacity)
+	_ = r.AddPolicy(ratelimit.Policy{Name: LegoWholeAppSign, Limit: capacity, Period: time.Second})
+}
+
+//删除对应路径的限速 path 为 LegoWholeAppSign 时删除全局限流
+func (r *RateLimit) RemoveRateLimit(path string) {
+	r.RemovePolicy(path)
 }
 
-//自定义限速返回
+//整体替换限速配置 whole <= 0 时不设置全局限流 容量 <= 0 的路径忽略
+//容量未变化的 bucket 保留 避免重置令牌
+func (r *RateLimit) ResetRateLimit(whole int64, paths map[string]int64) {
+	_ = r.SetPolicies(PathPolicies(whole, paths))
+}
+
+//自定义限速返回 需在启动前设置
 func (r *RateLimit) AddCustomResponseFunc(f func(*gin.Context)) {
-	defer r.mutex.Unlock()
-	r.mutex.Lock()
 	r.RLResFunc = f
 }
 
-func RateLimitMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		path := c.FullPath()
+//按路径容量生成策略
+func PathPolicies(whole int64, paths map[string]int64) []ratelimit.Policy {
+	ps := make([]ratelimit.Policy, 0, len(paths)+1)
+	if whole > 0 {
+		ps = append(ps, ratelimit.Policy{Name: LegoWholeAppSign, Limit: whole, Period: time.Second})
+	}
+	names := make([]string, 0, len(paths))
+	for path := range paths {
+		names = append(names, path)
+	}
+	sort.Strings(names)
+	for _, path := range names {
+		if capacity := paths[path]; capacity > 0 {
+			ps = append(ps, ratelimit.Policy{Name: path, Path: path, Limit: capacity, Period: time.Second})
+		}
+	}
+	return ps
+}
 
-		var bucket *ratelimit.Bucket
-		var ok bool
+type httpRequest struct {
+	c *gin.Context
+}
 
-		bucket, ok = RateLimiter.RB[LegoWholeAppSign]
-		// 如果没有全局限流 则获取单个接口限流
-		if !ok {
-			//获取限流
-			bucket, ok = RateLimiter.RB[path]
-		}
+func (r httpRequest) Route() string {
+	return r.c.FullPath()
+}
+
+func (r httpRequest) Method() string {
+	return r.c.Request.Method
+}
+
+func (r httpRequest) ClientIP() string {
+	return r.c.ClientIP()
+}
 
-		if ok {
-			take := bucket.TakeAvailable(1)
-			//如果未获取到take中断停止
-			if take == 0 {
-				RateLimiter.RLResFunc(c)
-				return
-			}
+func (r httpRequest) Header(key string) string {
+	return r.c.GetHeader(key)
+}
+
+//命中策略时输出 X-RateLimit-Limit X-RateLimit-Remaining X-RateLimit-Reset 拒绝时输出 Retry-After
+func RateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, matched := RateLimiter.Allow(c.Request.Context(), httpRequest{c})
+		if !matched {
+			c.Next()
+			return
+		}
+		for k, v := range res.Headers() {
+			c.Header(k, v)
+		}
+		//如果未获取到令牌中断停止
+		if !res.Allowed {
+			metrics.RateLimitRejected.WithLabelValues("http", c.FullPath()).Inc()
+			c.Set(ResultKey, res)
+			RateLimiter.RLResFunc(c)
+			return
 		}
 		c.Next()
 	}
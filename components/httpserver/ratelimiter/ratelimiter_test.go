@@ -0,0 +1,81 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jeevic/lego/components/ratelimit"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func() { _ = RateLimiter.SetPolicies(nil) }()
+	assert.Nil(t, RateLimiter.SetPolicies([]ratelimit.Policy{
+		{Name: "key", Path: "/user", KeyBy: []string{"header:X-Api-Key"}, Limit: 1, Period: time.Minute},
+	}))
+	r := gin.New()
+	r.Use(RateLimitMiddleware())
+	r.GET("/user", func(c *gin.Context) { c.String(200, "ok") })
+	r.GET("/free", func(c *gin.Context) { c.String(200, "ok") })
+
+	do := func(path string, key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("X-Api-Key", key)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	w := do("/user", "a")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+	w = do("/user", "a")
+	assert.Equal(t, 403, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, 200, do("/user", "b").Code)
+	w = do("/free", "a")
+	assert.Equal(t, 200, w.Code)
+	assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+}
+
+func TestAdaptiveMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := ratelimit.NewAdaptiveLimiter(ratelimit.AdaptiveSetting{InitialLimit: 1, MinLimit: 1, MaxLimit: 1})
+	block := make(chan struct{})
+	entered := make(chan struct{})
+	r := gin.New()
+	r.Use(AdaptiveMiddleware(l))
+	r.GET("/slow", func(c *gin.Context) {
+		close(entered)
+		<-block
+		c.String(200, "ok")
+	})
+
+	first := httptest.NewRecorder()
+	finished := make(chan struct{})
+	go func() {
+		req, _ := http.NewRequest("GET", "/slow", nil)
+		r.ServeHTTP(first, req)
+		close(finished)
+	}()
+	<-entered
+
+	//并发超过上限 503
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/slow", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	close(block)
+	<-finished
+	assert.Equal(t, 200, first.Code)
+	assert.Equal(t, int64(0), l.Inflight())
+}
@@ -2,12 +2,15 @@ package consumer
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"sync"
 
 	"github.com/Shopify/sarama"
 	"go.uber.org/atomic"
 
+	"github.com/jeevic/lego/components/metrics"
+	"github.com/jeevic/lego/components/tracing"
 	"github.com/jeevic/lego/pkg/app"
 )
 
@@ -19,6 +22,10 @@ type Consumer struct {
 	groups             []sarama.ConsumerGroup
 	partitionConsumers []sarama.PartitionConsumer
 	stopFlag           *atomic.Bool //0标识 未关闭
+
+	//健康检查复用的 client 首次检查时建立
+	pingMutex  sync.Mutex
+	pingClient sarama.Client
 }
 type setting struct {
 	Hosts       []string
@@ -41,7 +48,13 @@ func NewSetting() *setting {
 
 func NewConsumer(setting *setting) (*Consumer, error) {
 	config := buildConsumerConfig(setting)
-	return &Consumer{config, setting, make([]sarama.ConsumerGroup, 0), make([]sarama.PartitionConsumer, 0), atomic.NewBool(false)}, nil
+	return &Consumer{
+		config:             config,
+		setting:            setting,
+		groups:             make([]sarama.ConsumerGroup, 0),
+		partitionConsumers: make([]sarama.PartitionConsumer, 0),
+		stopFlag:           atomic.NewBool(false),
+	}, nil
 }
 
 func buildConsumerConfig(setting *setting) *sarama.Config {
@@ -74,6 +87,7 @@ func (consumer *Consumer) ConsumerMsg(topic string, f func(msg string)) error {
 		consumer.partitionConsumers = append(consumer.partitionConsumers, partitionConsumer)
 		wg.Add(1)
 		for msg := range partitionConsumer.Messages() {
+			metrics.KafkaConsumed.WithLabelValues(msg.Topic).Inc()
 			f(string(msg.Value))
 		}
 		wg.Done()
@@ -105,15 +119,56 @@ func (consumer *Consumer) ConsumerGroupMsg(topic string, groupId string, handler
 	ctx := context.Background()
 	for !consumer.stopFlag.Load() {
 		topics := strings.Split(topic, ",")
-		err := group.Consume(ctx, topics, handler)
+		err := group.Consume(ctx, topics, meteredHandler{handler})
 		if err != nil && !consumer.stopFlag.Load() {
 			app.App.GetLogger().Errorf("ERROR %s", err.Error())
 		}
 	}
 	return nil
 }
+
+//健康检查 刷新 topic 元数据 未配置 topic 时检查可用 broker
+//复用同一个 client 不在每次检查时重新连接
+func (consumer *Consumer) Ping() error {
+	if consumer.stopFlag.Load() {
+		return errors.New("kafka consumer closed")
+	}
+	client, err := consumer.getPingClient()
+	if err != nil {
+		return err
+	}
+	if len(consumer.setting.Topic) > 0 {
+		return client.RefreshMetadata(strings.Split(consumer.setting.Topic, ",")...)
+	}
+	if len(client.Brokers()) == 0 {
+		return errors.New("kafka no available broker")
+	}
+	return nil
+}
+
+func (consumer *Consumer) getPingClient() (sarama.Client, error) {
+	defer consumer.pingMutex.Unlock()
+	consumer.pingMutex.Lock()
+
+	if consumer.pingClient != nil && !consumer.pingClient.Closed() {
+		return consumer.pingClient, nil
+	}
+	client, err := sarama.NewClient(consumer.setting.Hosts, consumer.config)
+	if err != nil {
+		return nil, err
+	}
+	consumer.pingClient = client
+	return client, nil
+}
+
 func (consumer *Consumer) Close() {
 	consumer.stopFlag.Store(true)
+	consumer.pingMutex.Lock()
+	if consumer.pingClient != nil {
+		_ = consumer.pingClient.Close()
+		consumer.pingClient = nil
+	}
+	consumer.pingMutex.Unlock()
 	for _, item := range consumer.groups {
 		if item != nil {
 			item.Close()
@@ -125,3 +180,75 @@ func (consumer *Consumer) Close() {
 		}
 	}
 }
+
+//统计消费数量的 handler
+type meteredHandler struct {
+	sarama.ConsumerGroupHandler
+}
+
+func (h meteredHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	return h.ConsumerGroupHandler.ConsumeClaim(sess, &meteredClaim{claim, meterMessages(sess, claim)})
+}
+
+type meteredClaim struct {
+	sarama.ConsumerGroupClaim
+	messages <-chan *sarama.ConsumerMessage
+}
+
+func (c *meteredClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+//转发消息并计数 session 结束时退出
+func meterMessages(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) <-chan *sarama.ConsumerMessage {
+	out := make(chan *sarama.ConsumerMessage)
+	go func() {
+		defer close(out)
+		for msg := range claim.Messages() {
+			metrics.KafkaConsumed.WithLabelValues(msg.Topic).Inc()
+			select {
+			case out <- msg:
+			case <-sess.Context().Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+//读取消息头 traceparent 开启消费 span 处理完成后调用 span.End()
+func StartSpan(ctx context.Context, msg *sarama.ConsumerMessage) (context.Context, *tracing.Span) {
+	ctx = tracing.Extract(ctx, HeaderCarrier{msg})
+	ctx, span := tracing.Start(ctx, "kafka receive "+msg.Topic, tracing.SpanKindConsumer)
+	span.SetAttribute("messaging.system", "kafka")
+	span.SetAttribute("messaging.destination", msg.Topic)
+	return ctx, span
+}
+
+//kafka 消费消息头
+type HeaderCarrier struct {
+	Msg *sarama.ConsumerMessage
+}
+
+func (c HeaderCarrier) Get(key string) string {
+	for _, h := range c.Msg.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c HeaderCarrier) Set(key string, value string) {
+	c.Msg.Headers = append(c.Msg.Headers, &sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.Msg.Headers))
+	for _, h := range c.Msg.Headers {
+		if h != nil {
+			keys = append(keys, string(h.Key))
+		}
+	}
+	return keys
+}
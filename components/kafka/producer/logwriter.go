@@ -0,0 +1,67 @@
+package producer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+//日志发送到 kafka 用作 log sink 的发送端 每次 Write 一条消息
+//首次写入时按生产者实例配置创建独立的同步生产者 不共用实例连接
+//实例在退出时先注销 sink 仍可发送队列中的日志 由 log.CloseAll 关闭
+//不经过 SendMsg* 避免 trace 日志再次产生 span
+type LogWriter struct {
+	instance string
+	topic    string
+	producer sarama.SyncProducer
+	mutex    sync.Mutex
+}
+
+func NewLogWriter(instance string, topic string) *LogWriter {
+	return &LogWriter{instance: instance, topic: topic}
+}
+
+func (w *LogWriter) Write(p []byte) (int, error) {
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+	if w.producer == nil {
+		ins, err := GetProducer(w.instance)
+		if err != nil {
+			return 0, err
+		}
+		if len(w.topic) == 0 {
+			w.topic = ins.setting.Topic
+		}
+		if len(w.topic) == 0 {
+			return 0, errors.New(fmt.Sprintf("instance:%s log topic is empty", w.instance))
+		}
+		config := buildProducerConfig(ins.setting)
+		//同步生产者要求返回成功与失败
+		config.Producer.Return.Successes = true
+		config.Producer.Return.Errors = true
+		if w.producer, err = sarama.NewSyncProducer(ins.setting.Hosts, config); err != nil {
+			return 0, errors.New(fmt.Sprintf(" create sync producer error:%s", err.Error()))
+		}
+	}
+	//p 在发送完成前不会被修改
+	_, _, err := w.producer.SendMessage(&sarama.ProducerMessage{Topic: w.topic, Value: sarama.ByteEncoder(p)})
+	observeProduce(w.topic, err)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+//关闭生产者及其连接
+func (w *LogWriter) Close() error {
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+	if w.producer == nil {
+		return nil
+	}
+	err := w.producer.Close()
+	w.producer = nil
+	return err
+}
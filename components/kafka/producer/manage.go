@@ -46,6 +46,21 @@ func GetProducer(instance string) (*Producer, error) {
 		return nil, errors.New(fmt.Sprintf("instance:%s not exists!", instance))
 	}
 }
+
+//注销实例 并关闭连接
+func Unregister(instance string) error {
+	defer mg.mutex.Unlock()
+	mg.mutex.Lock()
+
+	ins, ok := mg.instances[instance]
+	if !ok {
+		return errors.New(fmt.Sprintf("instance:%s not exists!", instance))
+	}
+	ins.Close()
+	delete(mg.instances, instance)
+	return nil
+}
+
 func Reset() {
 	defer mg.mutex.Unlock()
 	mg.mutex.Lock()
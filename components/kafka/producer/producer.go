@@ -1,12 +1,16 @@
 package producer
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/Shopify/sarama"
 
+	"github.com/jeevic/lego/components/metrics"
+	"github.com/jeevic/lego/components/retry"
+	"github.com/jeevic/lego/components/tracing"
 	"github.com/jeevic/lego/pkg/app"
 )
 
@@ -23,6 +27,8 @@ type setting struct {
 	RequiredAcks  int
 	Timeout       int
 	MaxRetry      int
+	//sarama 重试之外 按策略退避重试发送 为空不重试
+	Retry *retry.Policy
 }
 
 func NewSetting() *setting {
@@ -64,16 +70,32 @@ func buildProducerConfig(producerSetting *setting) *sarama.Config {
 }
 
 func (kafkaProducer *Producer) SendMsgSync(topic string, key string, value string) (partition int32, offset int64, err error) {
+	return kafkaProducer.SendMsgSyncCtx(context.Background(), topic, key, value)
+}
+
+//同步发送 ctx 中的 trace 写入消息头
+func (kafkaProducer *Producer) SendMsgSyncCtx(ctx context.Context, topic string, key string, value string) (partition int32, offset int64, err error) {
 	if len(topic) == 0 && len(kafkaProducer.setting.Topic) > 0 {
 		topic = kafkaProducer.setting.Topic
 	}
+	ctx, span := startProduceSpan(ctx, topic)
+	defer span.End()
 	syncProducer, err := sarama.NewSyncProducerFromClient(kafkaProducer.client)
 	if err != nil {
 		return int32(-1), int64(-1), errors.New(fmt.Sprintf(" create sync producer error:%s", err.Error()))
 	}
 	defer syncProducer.Close()
 	msg := sarama.ProducerMessage{Topic: topic, Key: sarama.StringEncoder(key), Value: sarama.ByteEncoder(value)}
-	partition, offset, err = syncProducer.SendMessage(&msg)
+	tracing.Inject(ctx, HeaderCarrier{&msg})
+	err = kafkaProducer.send(ctx, topic, func(ctx context.Context) error {
+		//sarama 会修改发送的消息 每次使用副本
+		m := msg
+		var err error
+		partition, offset, err = syncProducer.SendMessage(&m)
+		return err
+	})
+	observeProduce(topic, err)
+	span.SetError(err)
 	if err != nil {
 		return int32(-1), int64(-1), errors.New(fmt.Sprintf("send message error:%s", err.Error()))
 	}
@@ -81,25 +103,140 @@ func (kafkaProducer *Producer) SendMsgSync(topic string, key string, value strin
 }
 
 func (kafkaProducer *Producer) SendMsgASync(topic string, key string, value string) error {
+	return kafkaProducer.SendMsgASyncCtx(context.Background(), topic, key, value)
+}
+
+//异步发送 ctx 中的 trace 写入消息头
+func (kafkaProducer *Producer) SendMsgASyncCtx(ctx context.Context, topic string, key string, value string) error {
 	if len(topic) == 0 && len(kafkaProducer.setting.Topic) > 0 {
 		topic = kafkaProducer.setting.Topic
 	}
+	ctx, span := startProduceSpan(ctx, topic)
+	defer span.End()
 	asyncProducer, err := sarama.NewAsyncProducerFromClient(kafkaProducer.client)
 	if err != nil {
 		return errors.New(fmt.Sprintf(" create aSync producer error:%s", err.Error()))
 	}
 	defer asyncProducer.Close()
 	msg := sarama.ProducerMessage{Topic: topic, Key: sarama.StringEncoder(key), Value: sarama.ByteEncoder(value)}
-	asyncProducer.Input() <- &msg
-	select {
-	case suc := <-asyncProducer.Successes():
-		app.App.GetLogger().Debugf("offset: %d,  timestamp: %s", suc.Offset, suc.Timestamp.String())
-		return nil
-	case fail := <-asyncProducer.Errors():
-		app.App.GetLogger().Errorf("err: %s\n", fail.Err.Error())
-		return fail
+	tracing.Inject(ctx, HeaderCarrier{&msg})
+	err = kafkaProducer.send(ctx, topic, func(ctx context.Context) error {
+		m := msg
+		asyncProducer.Input() <- &m
+		select {
+		case suc := <-asyncProducer.Successes():
+			app.App.GetLogger().Debugf("offset: %d,  timestamp: %s", suc.Offset, suc.Timestamp.String())
+			return nil
+		case fail := <-asyncProducer.Errors():
+			app.App.GetLogger().Errorf("err: %s\n", fail.Err.Error())
+			return fail
+		}
+	})
+	observeProduce(topic, err)
+	span.SetError(err)
+	return err
+}
+
+//按 Retry 策略发送
+func (kafkaProducer *Producer) send(ctx context.Context, topic string, fn func(ctx context.Context) error) error {
+	if kafkaProducer.setting.Retry == nil {
+		return fn(ctx)
+	}
+	p := *kafkaProducer.setting.Retry
+	if p.Retryable == nil {
+		p.Retryable = RetryableError
+	}
+	if len(p.Name) == 0 {
+		p.Name = "kafka send " + topic
+	}
+	return retry.Do(ctx, p, fn)
+}
+
+//默认重试的错误 broker 不可用 leader 切换 超时 副本不足
+func RetryableError(err error) bool {
+	var pe *sarama.ProducerError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	if errors.Is(err, sarama.ErrOutOfBrokers) || errors.Is(err, sarama.ErrNotConnected) {
+		return true
+	}
+	var ke sarama.KError
+	if !errors.As(err, &ke) {
+		return false
+	}
+	switch ke {
+	case sarama.ErrLeaderNotAvailable, sarama.ErrNotLeaderForPartition, sarama.ErrRequestTimedOut,
+		sarama.ErrBrokerNotAvailable, sarama.ErrNetworkException, sarama.ErrNotEnoughReplicas,
+		sarama.ErrNotEnoughReplicasAfterAppend:
+		return true
+	default:
+		return false
+	}
+}
+
+//健康检查 刷新 topic 元数据 未配置 topic 时检查可用 broker
+func (kafkaProducer *Producer) Ping() error {
+	if kafkaProducer.client.Closed() {
+		return errors.New("kafka client closed")
+	}
+	if len(kafkaProducer.setting.Topic) > 0 {
+		return kafkaProducer.client.RefreshMetadata(kafkaProducer.setting.Topic)
+	}
+	if len(kafkaProducer.client.Brokers()) == 0 {
+		return errors.New("kafka no available broker")
 	}
+	return nil
 }
+
 func (kafkaProducer *Producer) Close() {
 	kafkaProducer.client.Close()
 }
+
+//生产消息计数
+func observeProduce(topic string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	metrics.KafkaProduced.WithLabelValues(topic, result).Inc()
+}
+
+func startProduceSpan(ctx context.Context, topic string) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(ctx, "kafka send "+topic, tracing.SpanKindProducer)
+	span.SetAttribute("messaging.system", "kafka")
+	span.SetAttribute("messaging.destination", topic)
+	return ctx, span
+}
+
+//kafka 消息头 传递 traceparent
+type HeaderCarrier struct {
+	Msg *sarama.ProducerMessage
+}
+
+func (c HeaderCarrier) Get(key string) string {
+	for _, h := range c.Msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c HeaderCarrier) Set(key string, value string) {
+	for i, h := range c.Msg.Headers {
+		if string(h.Key) == key {
+			c.Msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.Msg.Headers = append(c.Msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.Msg.Headers))
+	for _, h := range c.Msg.Headers {
+		keys = append(keys, string(h.Key))
+	}
+	return keys
+}
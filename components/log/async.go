@@ -0,0 +1,163 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//异步写 默认值
+const (
+	DefaultAsyncBuffer        = 8192
+	DefaultAsyncFlushInterval = time.Second
+	//缓冲超过该大小立即写入
+	asyncBatchSize = 64 * 1024
+)
+
+//异步缓冲写 日志先写入有界队列 后台批量写入文件 避免慢盘阻塞请求
+//队列满时 block 为 true 阻塞等待 否则丢弃并计数
+//Close 后退化为同步写
+type AsyncWriter struct {
+	w        io.Writer
+	queue    chan []byte
+	block    bool
+	interval time.Duration
+	dropped  uint64
+
+	flushReq chan chan error
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+	//关闭时等待进行中的入队完成
+	state  sync.RWMutex
+	closed bool
+	//同步写入加锁
+	mutex sync.Mutex
+}
+
+//size 队列条数 interval 批量写入间隔 <=0 使用默认值
+func NewAsyncWriter(w io.Writer, size int, interval time.Duration, block bool) *AsyncWriter {
+	if size <= 0 {
+		size = DefaultAsyncBuffer
+	}
+	if interval <= 0 {
+		interval = DefaultAsyncFlushInterval
+	}
+	a := &AsyncWriter{
+		w:        w,
+		queue:    make(chan []byte, size),
+		block:    block,
+		interval: interval,
+		flushReq: make(chan chan error),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	//调用方可能复用 p
+	b := make([]byte, len(p))
+	copy(b, p)
+
+	a.state.RLock()
+	if a.closed {
+		a.state.RUnlock()
+		return a.writeSync(b)
+	}
+	if a.block {
+		//关闭前后台持续消费 不会阻塞 Close
+		a.queue <- b
+	} else {
+		select {
+		case a.queue <- b:
+		default:
+			atomic.AddUint64(&a.dropped, 1)
+		}
+	}
+	a.state.RUnlock()
+	return len(p), nil
+}
+
+func (a *AsyncWriter) writeSync(p []byte) (int, error) {
+	defer a.mutex.Unlock()
+	a.mutex.Lock()
+	return a.w.Write(p)
+}
+
+//队列满丢弃的条数
+func (a *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+//写入调用前已进入队列的日志
+func (a *AsyncWriter) Flush() error {
+	ack := make(chan error, 1)
+	select {
+	case a.flushReq <- ack:
+		return <-ack
+	case <-a.done:
+		return nil
+	}
+}
+
+//写入剩余日志 停止后台写 之后的写入为同步写
+func (a *AsyncWriter) Close() error {
+	a.once.Do(func() {
+		a.state.Lock()
+		a.closed = true
+		a.state.Unlock()
+		close(a.stop)
+	})
+	<-a.done
+	return nil
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	var buf bytes.Buffer
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	write := func() error {
+		if buf.Len() == 0 {
+			return nil
+		}
+		_, err := a.writeSync(buf.Bytes())
+		buf.Reset()
+		return err
+	}
+	//取出当前队列中的全部日志
+	drain := func() {
+		for {
+			select {
+			case b := <-a.queue:
+				buf.Write(b)
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case b := <-a.queue:
+			buf.Write(b)
+			if buf.Len() >= asyncBatchSize {
+				_ = write()
+			}
+		case <-ticker.C:
+			_ = write()
+		case ack := <-a.flushReq:
+			drain()
+			ack <- write()
+		case <-a.stop:
+			drain()
+			_ = write()
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package log
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//可阻塞的 writer 模拟慢盘
+type slowWriter struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+	gate  chan struct{}
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	<-w.gate
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+	return w.buf.Write(p)
+}
+
+func (w *slowWriter) String() string {
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+	return w.buf.String()
+}
+
+func TestAsyncWriter_Drop(t *testing.T) {
+	w := &slowWriter{gate: make(chan struct{})}
+	a := NewAsyncWriter(w, 2, time.Millisecond, false)
+
+	//后台写入阻塞 队列满后丢弃 不阻塞调用方
+	for i := 0; i < 10; i++ {
+		n, err := a.Write([]byte("x\n"))
+		assert.Nil(t, err)
+		assert.Equal(t, 2, n)
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.True(t, a.Dropped() > 0)
+
+	close(w.gate)
+	assert.Nil(t, a.Close())
+	written := uint64(len(w.String()) / 2)
+	assert.Equal(t, uint64(10), written+a.Dropped())
+
+	//关闭后同步写
+	_, _ = a.Write([]byte("after\n"))
+	assert.Contains(t, w.String(), "after\n")
+}
+
+func TestAsyncWriter_FlushBlock(t *testing.T) {
+	w := &slowWriter{gate: make(chan struct{})}
+	close(w.gate)
+	a := NewAsyncWriter(w, 1, time.Hour, true)
+	for i := 0; i < 100; i++ {
+		_, _ = a.Write([]byte("x"))
+	}
+	assert.Nil(t, a.Flush())
+	assert.Equal(t, 100, len(w.String()))
+	assert.Equal(t, uint64(0), a.Dropped())
+	assert.Nil(t, a.Close())
+}
+
+func TestNewLog_Async(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alog")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, backend := range []string{BackendLogrus, BackendZerolog} {
+		logger, err := NewLog(Setting{
+			Path:               dir,
+			FileName:           backend + ".log",
+			Level:              "debug",
+			Format:             "json",
+			Split:              ".%Y%m%d",
+			Backend:            backend,
+			Async:              true,
+			AsyncFlushInterval: time.Hour,
+		})
+		assert.Nil(t, err)
+		logger.GetLogger().Debug("async " + backend)
+
+		content, _ := ioutil.ReadFile(dir + "/" + backend + ".log")
+		assert.NotContains(t, string(content), "async "+backend)
+
+		assert.Nil(t, logger.Close())
+		content, _ = ioutil.ReadFile(dir + "/" + backend + ".log")
+		assert.Contains(t, string(content), "async "+backend)
+	}
+}
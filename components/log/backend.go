@@ -0,0 +1,48 @@
+package log
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+//日志后端
+const (
+	BackendLogrus  = "logrus"
+	BackendZerolog = "zerolog"
+)
+
+//后端无关的日志接口
+//usage:
+//	l, _ := log.GetLog("app")
+//	l.Handler().WithFields(map[string]interface{}{"uid": 1}).Infof("login %s", name)
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	WithFields(fields map[string]interface{}) Logger
+}
+
+//logrus 实现
+type logrusLogger struct {
+	entry *logrus.Entry
+}
+
+func (l logrusLogger) Debugf(format string, args ...interface{}) {
+	l.entry.Debugf(format, args...)
+}
+
+func (l logrusLogger) Infof(format string, args ...interface{}) {
+	l.entry.Infof(format, args...)
+}
+
+func (l logrusLogger) Warnf(format string, args ...interface{}) {
+	l.entry.Warnf(format, args...)
+}
+
+func (l logrusLogger) Errorf(format string, args ...interface{}) {
+	l.entry.Errorf(format, args...)
+}
+
+func (l logrusLogger) WithFields(fields map[string]interface{}) Logger {
+	return logrusLogger{entry: l.entry.WithFields(fields)}
+}
@@ -0,0 +1,52 @@
+package log
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+//请求级 logger 随 ctx 传递
+//usage:
+//	//中间件 拦截器绑定 request_id method path trace_id
+//	ctx = log.WithFields(ctx, logrus.Fields{"request_id": id})
+//	//handler 中获取 输出自动带上绑定的字段
+//	log.FromContext(c).Info("get user")
+
+//未绑定时使用的日志实例
+var defaultInstance = "app"
+
+type entryKey struct{}
+
+//设置未绑定 logger 时使用的实例
+func SetDefaultInstance(instance string) {
+	defaultInstance = instance
+}
+
+//绑定 logger 到 ctx
+func WithContext(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, entry)
+}
+
+//在 ctx 已绑定的 logger 上追加字段
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	return WithContext(ctx, FromContext(ctx).WithFields(fields))
+}
+
+//获取 ctx 绑定的 logger 未绑定时返回默认实例 默认实例未注册时返回 logrus 标准 logger
+//gin.Context 从 Request 的 ctx 中获取
+func FromContext(ctx context.Context) *logrus.Entry {
+	if c, ok := ctx.(*gin.Context); ok && c.Request != nil {
+		ctx = c.Request.Context()
+	}
+	if ctx != nil {
+		if entry, ok := ctx.Value(entryKey{}).(*logrus.Entry); ok {
+			return entry
+		}
+	}
+	if l := GetLogger(defaultInstance); l != nil {
+		return logrus.NewEntry(l)
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
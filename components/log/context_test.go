@@ -0,0 +1,43 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetFormatter(&YdLogFormatter{TimestampFormat: "2006"})
+
+	//未绑定 未注册默认实例 返回标准 logger
+	assert.Equal(t, logrus.StandardLogger(), FromContext(context.Background()).Logger)
+
+	ctx := WithContext(context.Background(), logrus.NewEntry(l))
+	ctx = WithFields(ctx, logrus.Fields{"request_id": "r1", "path": "/user/1"})
+	ctx = WithFields(ctx, logrus.Fields{"method": "GET"})
+	FromContext(ctx).Info("get user")
+	assert.Contains(t, buf.String(), "|method=GET|path=/user/1|request_id=r1|get user")
+
+	//gin.Context 从 Request ctx 获取
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithFields(ctx, logrus.Fields{"request_id": "r2"}))
+		c.Next()
+	})
+	engine.GET("/", func(c *gin.Context) {
+		FromContext(c).Info("gin")
+	})
+	buf.Reset()
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, buf.String(), "request_id=r2|gin")
+}
@@ -8,10 +8,12 @@ import (
 	"log"
 	"os"
 	"path"
+	"sync"
 	"time"
 
 	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
 	"github.com/rifflock/lfshook"
+	"github.com/rs/zerolog"
 	"github.com/sirupsen/logrus"
 
 	"github.com/jeevic/lego/util"
@@ -34,6 +36,12 @@ import (
 //	}
 //	logger, err := NewLog(c)
 //	logger.getLogger().Debug("debug")
+//
+//	zerolog 后端 按大小切割 GetLogger() 仍可用
+//	c.Backend = BackendZerolog
+//	c.MaxSize = 512
+//	logger, err := NewLog(c)
+//	logger.Zero().Info().Str("uid", uid).Msg("login")
 
 type Log struct {
 	//日志配置
@@ -41,6 +49,14 @@ type Log struct {
 	//初始化日志句柄
 	Logger *logrus.Logger
 	Writer io.Writer
+	//zerolog 后端
+	zero   *zeroBackend
+	closer func() error
+	//异步写
+	asyncs []*AsyncWriter
+	//远程输出
+	sinks []*Sink
+	mutex sync.Mutex
 }
 
 //日志配置信息
@@ -56,19 +72,53 @@ type Setting struct {
 	ReportCaller    bool          //是否打印调用栈位置 行号
 	ReportHostIp    bool          //是否打印host ip
 	ReportShortFile bool          //文件路径短写
+	Backend         string        //logrus(默认) zerolog
+	//zerolog 后端
+	Console    bool //同时输出到控制台
+	MaxSize    int  //单文件大小 单位 MB 默认 100
+	MaxBackups int  //保留文件数 0 不限制
+	Compress   bool //切割后压缩
+	//异步写 慢盘不阻塞请求
+	Async              bool          //开启异步写
+	AsyncBuffer        int           //队列条数 默认 8192
+	AsyncFlushInterval time.Duration //批量写入间隔 默认 1s
+	AsyncBlock         bool          //队列满时阻塞 默认丢弃
 }
 
 //实例化Log
 func NewLog(setting Setting) (*Log, error) {
-	h, w, err := InitLogrus(&setting)
+	switch setting.Backend {
+	case "", BackendLogrus:
+	case BackendZerolog:
+		return newZeroLog(&setting)
+	default:
+		return nil, errors.New(fmt.Sprintf("log backend:%s not support", setting.Backend))
+	}
+	lg := &Log{Setting: &setting}
+	h, w, err := lg.initLogrus(&setting)
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("log init logrus error err:%s", err.Error()))
 	}
-	return &Log{Setting: &setting, Logger: h, Writer: w}, nil
+	lg.Logger, lg.Writer = h, w
+	return lg, nil
 }
 
 //进行初始化
 func InitLogrus(c *Setting) (*logrus.Logger, io.Writer, error) {
+	return new(Log).initLogrus(c)
+}
+
+//开启异步写时包装文件 writer
+func (lg *Log) wrapAsync(c *Setting, w io.Writer) io.Writer {
+	if !c.Async {
+		return w
+	}
+	aw := NewAsyncWriter(w, c.AsyncBuffer, c.AsyncFlushInterval, c.AsyncBlock)
+	lg.asyncs = append(lg.asyncs, aw)
+	return aw
+}
+
+func (lg *Log) initLogrus(c *Setting) (*logrus.Logger, io.Writer, error) {
 	l := logrus.New()
 	//如果未设置path filename 直接返回
 	if c == nil || len(c.Path) == 0 {
@@ -87,6 +137,8 @@ func InitLogrus(c *Setting) (*logrus.Logger, io.Writer, error) {
 		log.Printf("failed to create rotatelogs err:%s", err)
 		return nil, nil, err
 	}
+	//rotatelogs 关闭后再写入会 panic 不随 Close 关闭
+	writer2 := lg.wrapAsync(c, writer)
 	//错误文件地址
 	var errWriter io.Writer
 	if len(c.ErrFileName) > 0 {
@@ -101,44 +153,20 @@ func InitLogrus(c *Setting) (*logrus.Logger, io.Writer, error) {
 			log.Printf("failed to create error rotatelogs err:%s", err)
 			return nil, nil, err
 		}
-		errWriter = io.MultiWriter(writer, ew)
+		errWriter = io.MultiWriter(writer2, lg.wrapAsync(c, ew))
 	} else {
-		errWriter = writer
+		errWriter = writer2
 	}
 
 	//设置日志级别
-	switch c.Level {
-	case "trace":
-		l.SetLevel(logrus.TraceLevel)
-		break
-	case "debug":
-		l.SetLevel(logrus.DebugLevel)
-		break
-	case "info":
-		l.SetLevel(logrus.InfoLevel)
-		break
-	case "warn":
-		l.SetLevel(logrus.WarnLevel)
-		break
-	case "error":
-		l.SetLevel(logrus.ErrorLevel)
-		break
-	case "fatal":
-		l.SetLevel(logrus.FatalLevel)
-		break
-	case "panic":
-		l.SetLevel(logrus.PanicLevel)
-		break
-	default:
-		l.SetLevel(logrus.InfoLevel)
-	}
+	l.SetLevel(ParseLevel(c.Level))
 
 	//聚合文件地址
 	hook := lfshook.NewHook(
 		lfshook.WriterMap{
-			logrus.DebugLevel: writer,
-			logrus.InfoLevel:  writer,
-			logrus.WarnLevel:  writer,
+			logrus.DebugLevel: writer2,
+			logrus.InfoLevel:  writer2,
+			logrus.WarnLevel:  writer2,
 			logrus.ErrorLevel: errWriter,
 			logrus.FatalLevel: errWriter,
 			logrus.PanicLevel: errWriter,
@@ -151,42 +179,145 @@ func InitLogrus(c *Setting) (*logrus.Logger, io.Writer, error) {
 		l.SetReportCaller(c.ReportCaller)
 	}
 
-	switch c.Format {
-	case "json":
-		hook.SetFormatter(&logrus.JSONFormatter{})
-		break
-	case "text":
-		hook.SetFormatter(&logrus.TextFormatter{})
-		break
-	case "ydLog":
-		//Host Ip
-		ip, _ := util.GetLocalIp()
-		hook.SetFormatter(&YdLogFormatter{
-			TimestampFormat: "2006-01-02 15:04:05.000",
-			HostIp:          ip,
-			ReportCaller:    c.ReportCaller,
-			ReportHostIp:    c.ReportHostIp,
-			ReportShortFile: c.ReportShortFile,
-		})
-		break
-	default:
-		hook.SetFormatter(&logrus.JSONFormatter{})
-	}
+	hook.SetFormatter(newFormatter(c.Format, c))
 	l.Hooks.Add(hook)
 	//将logrus 指定到 dev
 	if devW, err := getDevNullWriter(); err == nil {
 		l.SetOutput(devW)
 	}
 	//自带log输出位置设置
-	log.SetOutput(writer)
+	log.SetOutput(writer2)
 
-	return l, writer, nil
+	return l, writer2, nil
 }
 
 func (l *Log) GetLogger() *logrus.Logger {
 	return l.Logger
 }
 
+//日志后端名称
+func (l *Log) Backend() string {
+	if l.zero != nil {
+		return BackendZerolog
+	}
+	return BackendLogrus
+}
+
+//后端无关的日志接口
+func (l *Log) Handler() Logger {
+	if l.zero != nil {
+		return zeroLogger{zb: l.zero, l: l.zero.base}
+	}
+	return logrusLogger{entry: logrus.NewEntry(l.Logger)}
+}
+
+//zerolog 句柄 logrus 后端返回 nil
+func (l *Log) Zero() *zerolog.Logger {
+	if l.zero == nil {
+		return nil
+	}
+	return l.zero.logger()
+}
+
+//添加远程输出
+func (l *Log) AddSink(s *Sink) {
+	defer l.mutex.Unlock()
+	l.mutex.Lock()
+	l.sinks = append(l.sinks, s)
+	l.Logger.AddHook(s)
+}
+
+//异步写入剩余日志 只刷新不关闭
+func (l *Log) Flush() error {
+	for _, a := range l.asyncs {
+		if err := a.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//异步队列满丢弃 远程发送失败的日志条数
+func (l *Log) Dropped() uint64 {
+	var n uint64
+	for _, a := range l.asyncs {
+		n += a.Dropped()
+	}
+	defer l.mutex.Unlock()
+	l.mutex.Lock()
+	for _, s := range l.sinks {
+		n += s.Dropped()
+	}
+	return n
+}
+
+//写入剩余异步日志 发送剩余远程日志 zerolog 后端关闭日志文件 之后的日志同步写入
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	for _, s := range l.sinks {
+		_ = s.Close()
+	}
+	l.mutex.Unlock()
+	for _, a := range l.asyncs {
+		_ = a.Close()
+	}
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer()
+}
+
+//运行时修改日志级别 用于配置热加载
+func (l *Log) SetLevel(level string) {
+	l.Setting.Level = level
+	l.Logger.SetLevel(ParseLevel(level))
+	if l.zero != nil {
+		l.zero.setLevel(level)
+	}
+}
+
+//解析日志级别 未知级别默认 info
+func ParseLevel(level string) logrus.Level {
+	switch level {
+	case "trace":
+		return logrus.TraceLevel
+	case "debug":
+		return logrus.DebugLevel
+	case "info":
+		return logrus.InfoLevel
+	case "warn":
+		return logrus.WarnLevel
+	case "error":
+		return logrus.ErrorLevel
+	case "fatal":
+		return logrus.FatalLevel
+	case "panic":
+		return logrus.PanicLevel
+	default:
+		return logrus.InfoLevel
+	}
+}
+
+//日志格式 json text ydLog 默认 json
+func newFormatter(format string, c *Setting) logrus.Formatter {
+	switch format {
+	case "text":
+		return &logrus.TextFormatter{}
+	case "ydLog":
+		//Host Ip
+		ip, _ := util.GetLocalIp()
+		return &YdLogFormatter{
+			TimestampFormat: "2006-01-02 15:04:05.000",
+			HostIp:          ip,
+			ReportCaller:    c.ReportCaller,
+			ReportHostIp:    c.ReportHostIp,
+			ReportShortFile: c.ReportShortFile,
+		}
+	default:
+		return &logrus.JSONFormatter{}
+	}
+}
+
 func getDevNullWriter() (io.Writer, error) {
 	src, err := os.OpenFile(os.DevNull, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
 	return bufio.NewWriter(src), err
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -45,3 +46,48 @@ func TestLog_Info(t *testing.T) {
 	logger := initLogger(t)
 	logger.Logger.Info("info")
 }
+
+func TestNewLog_Zerolog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zlog")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	logger, err := NewLog(Setting{
+		Path:         dir,
+		FileName:     "app.log",
+		ErrFileName:  "error.log",
+		Level:        "info",
+		Backend:      BackendZerolog,
+		ReportCaller: true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, BackendZerolog, logger.Backend())
+
+	//logrus 兼容调用 经 hook 写入 zerolog
+	logger.GetLogger().WithField("request_id", "r1").Info("compat")
+	logger.GetLogger().Debug("filtered")
+	logger.Zero().Error().Str("uid", "u1").Msg("direct")
+	logger.Handler().WithFields(map[string]interface{}{"k": "v"}).Warnf("handler %d", 1)
+
+	//热更新级别
+	logger.SetLevel("debug")
+	logger.GetLogger().Debug("debug on")
+	assert.Nil(t, logger.Close())
+
+	app, _ := ioutil.ReadFile(dir + "/app.log")
+	out := string(app)
+	assert.Contains(t, out, `"request_id":"r1"`)
+	assert.Contains(t, out, `"message":"compat"`)
+	assert.Contains(t, out, `"caller":`)
+	assert.NotContains(t, out, "filtered")
+	assert.Contains(t, out, `"uid":"u1"`)
+	assert.Contains(t, out, `"message":"handler 1"`)
+	assert.Contains(t, out, "debug on")
+
+	errLog, _ := ioutil.ReadFile(dir + "/error.log")
+	assert.Contains(t, string(errLog), "direct")
+	assert.NotContains(t, string(errLog), "compat")
+
+	_, err = NewLog(Setting{Backend: "unknown"})
+	assert.NotNil(t, err)
+}
@@ -56,6 +56,19 @@ func GetLogger(instance string) *logrus.Logger {
 	return nil
 }
 
+//写入所有实例的异步日志 用于退出前
+func CloseAll() error {
+	defer mg.mutex.Unlock()
+	mg.mutex.Lock()
+	var first error
+	for _, ins := range mg.instances {
+		if err := ins.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
 func Reset() {
 	defer mg.mutex.Unlock()
 	mg.mutex.Lock()
@@ -0,0 +1,301 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//远程日志输出 每个 sink 独立级别 格式 发送队列
+//usage:
+//	[log.sinks.remote]
+//	type = "syslog"    # syslog tcp kafka
+//	network = "udp"    # syslog 使用 udp tcp
+//	addr = "127.0.0.1:514"
+//	level = "warn"
+//	format = "json"
+//
+//	sink, err := log.NewSink("remote", setting)
+//	l.AddSink(sink)
+//zerolog 后端 Zero() 直接输出的日志不经过 sink
+
+//sink 类型
+const (
+	SinkSyslog = "syslog"
+	SinkTcp    = "tcp"
+	SinkKafka  = "kafka"
+)
+
+//sink 配置
+type SinkSetting struct {
+	Type    string `mapstructure:"type" valid:"Required"`
+	Network string `mapstructure:"network" default:"udp"`
+	Addr    string `mapstructure:"addr"`
+	//不低于该级别的日志输出
+	Level  string `mapstructure:"level" default:"info"`
+	Format string `mapstructure:"format" default:"json"`
+	//syslog facility 默认 local0
+	Facility int    `mapstructure:"facility" default:"16"`
+	AppName  string `mapstructure:"app_name"`
+	//kafka 生产者实例 topic
+	Producer string `mapstructure:"producer"`
+	Topic    string `mapstructure:"topic"`
+	//发送队列 满时丢弃
+	Buffer  int           `mapstructure:"buffer" default:"1024"`
+	Timeout time.Duration `mapstructure:"timeout" default:"3s"`
+}
+
+//日志 hook 格式化后放入队列 后台逐条发送
+type Sink struct {
+	Name      string
+	levels    []logrus.Level
+	formatter logrus.Formatter
+	out       io.WriteCloser
+	queue     chan []byte
+	dropped   uint64
+	stop      chan struct{}
+	done      chan struct{}
+	once      sync.Once
+	state     sync.RWMutex
+	closed    bool
+}
+
+//按配置创建 syslog tcp sink kafka 使用 NewSinkWriter 传入发送端
+func NewSink(name string, setting SinkSetting) (*Sink, error) {
+	if len(setting.Addr) == 0 {
+		return nil, errors.New(fmt.Sprintf("log sink:%s addr is empty", name))
+	}
+	switch setting.Type {
+	case SinkSyslog:
+		if setting.Network != "udp" && setting.Network != "tcp" {
+			return nil, errors.New(fmt.Sprintf("log sink:%s syslog network:%s not support", name, setting.Network))
+		}
+		return NewSinkWriter(name, setting, NewNetWriter(setting.Network, setting.Addr, setting.Timeout)), nil
+	case SinkTcp:
+		return NewSinkWriter(name, setting, NewNetWriter("tcp", setting.Addr, setting.Timeout)), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("log sink:%s type:%s not support", name, setting.Type))
+	}
+}
+
+//每次 Write 发送一条日志
+func NewSinkWriter(name string, setting SinkSetting, out io.WriteCloser) *Sink {
+	size := setting.Buffer
+	if size <= 0 {
+		size = DefaultAsyncBuffer
+	}
+	s := &Sink{
+		Name:      name,
+		levels:    levelsFrom(ParseLevel(setting.Level)),
+		formatter: sinkFormatter(setting),
+		out:       out,
+		queue:     make(chan []byte, size),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+//不低于 level 的级别
+func levelsFrom(level logrus.Level) []logrus.Level {
+	levels := make([]logrus.Level, 0, len(logrus.AllLevels))
+	for _, lv := range logrus.AllLevels {
+		if lv <= level {
+			levels = append(levels, lv)
+		}
+	}
+	return levels
+}
+
+func sinkFormatter(setting SinkSetting) logrus.Formatter {
+	f := newFormatter(setting.Format, &Setting{ReportHostIp: true, ReportShortFile: true})
+	if tf, ok := f.(*logrus.TextFormatter); ok {
+		tf.DisableColors = true
+	}
+	if setting.Type == SinkSyslog {
+		return NewSyslogFormatter(setting.Facility, setting.AppName, f)
+	}
+	return f
+}
+
+func (s *Sink) Levels() []logrus.Level {
+	return s.levels
+}
+
+//不阻塞日志调用 队列满时丢弃
+func (s *Sink) Fire(entry *logrus.Entry) error {
+	b, err := s.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	//formatter 可能复用 entry.Buffer
+	p := make([]byte, len(b))
+	copy(p, b)
+
+	defer s.state.RUnlock()
+	s.state.RLock()
+	if s.closed {
+		atomic.AddUint64(&s.dropped, 1)
+		return nil
+	}
+	select {
+	case s.queue <- p:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+	return nil
+}
+
+//队列满丢弃及发送失败的条数
+func (s *Sink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+//发送剩余日志并关闭连接
+func (s *Sink) Close() error {
+	s.once.Do(func() {
+		s.state.Lock()
+		s.closed = true
+		s.state.Unlock()
+		close(s.stop)
+	})
+	<-s.done
+	return s.out.Close()
+}
+
+func (s *Sink) run() {
+	defer close(s.done)
+	send := func(p []byte) {
+		if _, err := s.out.Write(p); err != nil {
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+	for {
+		select {
+		case p := <-s.queue:
+			send(p)
+		case <-s.stop:
+			for {
+				select {
+				case p := <-s.queue:
+					send(p)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+//网络发送 断开后下次写入重连 tcp 以换行分隔
+type NetWriter struct {
+	network string
+	addr    string
+	timeout time.Duration
+	conn    net.Conn
+	mutex   sync.Mutex
+}
+
+func NewNetWriter(network string, addr string, timeout time.Duration) *NetWriter {
+	return &NetWriter{network: network, addr: addr, timeout: timeout}
+}
+
+func (w *NetWriter) Write(p []byte) (int, error) {
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+	if w.network != "udp" && (len(p) == 0 || p[len(p)-1] != '\n') {
+		p = append(p, '\n')
+	}
+	//失败重连一次
+	var err error
+	for i := 0; i < 2; i++ {
+		if w.conn == nil {
+			if w.conn, err = net.DialTimeout(w.network, w.addr, w.timeout); err != nil {
+				w.conn = nil
+				return 0, err
+			}
+		}
+		if w.timeout > 0 {
+			_ = w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+		}
+		var n int
+		if n, err = w.conn.Write(p); err == nil {
+			return n, nil
+		}
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	return 0, err
+}
+
+func (w *NetWriter) Close() error {
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+//RFC5424 syslog 格式 消息体由 Inner 格式化
+//<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+type SyslogFormatter struct {
+	Facility int
+	AppName  string
+	Hostname string
+	Inner    logrus.Formatter
+}
+
+func NewSyslogFormatter(facility int, appName string, inner logrus.Formatter) *SyslogFormatter {
+	hostname, _ := os.Hostname()
+	if len(appName) == 0 {
+		appName = "-"
+	}
+	if len(hostname) == 0 {
+		hostname = "-"
+	}
+	return &SyslogFormatter{Facility: facility, AppName: appName, Hostname: hostname, Inner: inner}
+}
+
+func (f *SyslogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	msg, err := f.Inner.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d - - ",
+		f.Facility*8+syslogSeverity(entry.Level),
+		entry.Time.Format(time.RFC3339Nano),
+		f.Hostname, f.AppName, os.Getpid())
+	b.Write(bytes.TrimRight(msg, "\n"))
+	return b.Bytes(), nil
+}
+
+//logrus 级别对应 syslog severity
+func syslogSeverity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 0
+	case logrus.FatalLevel:
+		return 2
+	case logrus.ErrorLevel:
+		return 3
+	case logrus.WarnLevel:
+		return 4
+	case logrus.InfoLevel:
+		return 6
+	default:
+		return 7
+	}
+}
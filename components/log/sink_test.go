@@ -0,0 +1,129 @@
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSink_SyslogUdp(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer pc.Close()
+
+	l, err := NewLog(Setting{Level: "debug"})
+	assert.Nil(t, err)
+	sink, err := NewSink("syslog", SinkSetting{
+		Type:     SinkSyslog,
+		Network:  "udp",
+		Addr:     pc.LocalAddr().String(),
+		Level:    "warn",
+		Format:   "json",
+		Facility: 16,
+		AppName:  "lego",
+		Buffer:   16,
+		Timeout:  time.Second,
+	})
+	assert.Nil(t, err)
+	l.AddSink(sink)
+
+	//低于 warn 不发送
+	l.GetLogger().Info("skip")
+	l.GetLogger().WithField("uid", 1).Error("boom")
+	assert.Nil(t, l.Close())
+
+	_ = pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := pc.ReadFrom(buf)
+	assert.Nil(t, err)
+	msg := string(buf[:n])
+	//local0(16)*8 + error(3)
+	prefix := "<131>1 "
+	assert.True(t, strings.HasPrefix(msg, prefix), msg)
+	parts := strings.SplitN(msg, " ", 8)
+	assert.Equal(t, 8, len(parts))
+	_, err = time.Parse(time.RFC3339Nano, parts[1])
+	assert.Nil(t, err)
+	assert.Equal(t, "lego", parts[3])
+	assert.Equal(t, fmt.Sprint(os.Getpid()), parts[4])
+
+	var body map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(parts[7]), &body))
+	assert.Equal(t, "boom", body["msg"])
+	assert.Equal(t, float64(1), body["uid"])
+
+	//只收到一条
+	_ = pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _, err = pc.ReadFrom(buf)
+	assert.NotNil(t, err)
+}
+
+func TestSink_TcpJson(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	l, err := NewLog(Setting{Level: "debug", Backend: BackendZerolog})
+	assert.Nil(t, err)
+	sink, err := NewSink("tcp", SinkSetting{Type: SinkTcp, Addr: ln.Addr().String(), Level: "debug", Format: "json"})
+	assert.Nil(t, err)
+	l.AddSink(sink)
+	for i := 0; i < 3; i++ {
+		l.GetLogger().Debugf("line %d", i)
+	}
+	assert.Nil(t, l.Close())
+
+	var got []string
+	for line := range lines {
+		got = append(got, line)
+	}
+	assert.Equal(t, 3, len(got))
+	for i, line := range got {
+		var body map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &body))
+		assert.Equal(t, fmt.Sprintf("line %d", i), body["msg"])
+		assert.Equal(t, "debug", body["level"])
+	}
+	assert.Equal(t, uint64(0), l.Dropped())
+}
+
+func TestSink_Dropped(t *testing.T) {
+	//无监听端口 发送失败计入丢弃
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	sink, err := NewSink("down", SinkSetting{Type: SinkTcp, Addr: addr, Level: "info", Timeout: time.Second})
+	assert.Nil(t, err)
+	l := logrus.New()
+	l.SetOutput(&strings.Builder{})
+	l.AddHook(sink)
+	l.Info("lost")
+	assert.Nil(t, sink.Close())
+	assert.Equal(t, uint64(1), sink.Dropped())
+
+	_, err = NewSink("bad", SinkSetting{Type: "http", Addr: addr})
+	assert.NotNil(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -56,10 +57,15 @@ func (y *YdLogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 		y.writeCaller(b, entry)
 	}
 
-	//write key value
-	for k, v := range entry.Data {
+	//write key value 按 key 排序 请求绑定的字段位置固定
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
 		b.WriteByte('|')
-		y.appendKeyValue(b, fmt.Sprintf("%s=", k), v)
+		y.appendKeyValue(b, fmt.Sprintf("%s=", k), entry.Data[k])
 	}
 	// write mssage
 	y.appendKeyValue(b, "|", entry.Message)
@@ -0,0 +1,219 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/jeevic/lego/util"
+)
+
+//zerolog 后端 按大小切割(lumberjack)
+//Logger 字段仍为 logrus 句柄 日志通过 hook 转写到 zerolog 兼容已有调用
+//高 QPS 场景直接使用 Zero() 或 Handler() 避免 logrus 的分配
+
+func init() {
+	zerolog.TimeFieldFormat = "2006-01-02 15:04:05.000"
+}
+
+type zeroBackend struct {
+	//trace 级别 基础句柄 级别由 level 控制 支持热更新
+	base zerolog.Logger
+	//带调用位置的句柄 Zero() 返回
+	caller zerolog.Logger
+	level  int32
+}
+
+func newZeroLog(setting *Setting) (*Log, error) {
+	lg := &Log{Setting: setting}
+	writers := make([]io.Writer, 0, 3)
+	closers := make([]io.Closer, 0, 2)
+	closer := func() error {
+		var errs []string
+		for _, c := range closers {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%d logger close errors: %s", len(errs), strings.Join(errs, ". Also, "))
+		}
+		return nil
+	}
+
+	if setting.Console || len(setting.Path) == 0 {
+		writers = append(writers, zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: zerolog.TimeFieldFormat})
+	}
+	var writer io.Writer = os.Stdout
+	if len(setting.Path) > 0 {
+		fw := newRotator(setting, setting.FileName)
+		closers = append(closers, fw)
+		writer = lg.wrapAsync(setting, fw)
+		writers = append(writers, formatWriter(setting, writer))
+		//错误日志单独文件
+		if len(setting.ErrFileName) > 0 {
+			ew := newRotator(setting, setting.ErrFileName)
+			closers = append(closers, ew)
+			writers = append(writers, &levelWriter{w: formatWriter(setting, lg.wrapAsync(setting, ew)), min: zerolog.ErrorLevel})
+		}
+	}
+
+	c := zerolog.New(zerolog.MultiLevelWriter(writers...)).Level(zerolog.TraceLevel).With().Timestamp()
+	if setting.ReportHostIp {
+		ip, _ := util.GetLocalIp()
+		c = c.Str("host", ip)
+	}
+	base := c.Logger()
+	zb := &zeroBackend{base: base, caller: base}
+	if setting.ReportCaller {
+		zb.caller = base.With().Caller().Logger()
+	}
+	zb.setLevel(setting.Level)
+
+	//logrus 兼容句柄 只经 hook 输出
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	l.SetLevel(ParseLevel(setting.Level))
+	l.SetReportCaller(setting.ReportCaller)
+	l.Hooks.Add(&zeroHook{zb: zb})
+
+	lg.Logger, lg.Writer, lg.zero, lg.closer = l, writer, zb, closer
+	return lg, nil
+}
+
+//按大小切割 LifeTime 小时换算为天
+func newRotator(setting *Setting, filename string) *lumberjack.Logger {
+	return &lumberjack.Logger{
+		Filename:   path.Join(setting.Path, filename),
+		MaxSize:    setting.MaxSize,
+		MaxAge:     int(math.Ceil(float64(setting.LifeTime) / 24)),
+		MaxBackups: setting.MaxBackups,
+		Compress:   setting.Compress,
+	}
+}
+
+//text 格式按控制台格式输出 其他为 json
+func formatWriter(setting *Setting, w io.Writer) io.Writer {
+	if setting.Format == "text" {
+		return zerolog.ConsoleWriter{Out: w, NoColor: true, TimeFormat: zerolog.TimeFieldFormat}
+	}
+	return w
+}
+
+func (z *zeroBackend) setLevel(level string) {
+	atomic.StoreInt32(&z.level, int32(zeroLevel(ParseLevel(level))))
+}
+
+func (z *zeroBackend) getLevel() zerolog.Level {
+	return zerolog.Level(atomic.LoadInt32(&z.level))
+}
+
+func (z *zeroBackend) logger() *zerolog.Logger {
+	l := z.caller.Level(z.getLevel())
+	return &l
+}
+
+//logrus 级别转换
+func zeroLevel(level logrus.Level) zerolog.Level {
+	switch level {
+	case logrus.TraceLevel:
+		return zerolog.TraceLevel
+	case logrus.DebugLevel:
+		return zerolog.DebugLevel
+	case logrus.InfoLevel:
+		return zerolog.InfoLevel
+	case logrus.WarnLevel:
+		return zerolog.WarnLevel
+	case logrus.ErrorLevel:
+		return zerolog.ErrorLevel
+	case logrus.FatalLevel:
+		return zerolog.FatalLevel
+	default:
+		return zerolog.PanicLevel
+	}
+}
+
+//logrus 日志转写 zerolog
+type zeroHook struct {
+	zb *zeroBackend
+}
+
+func (h *zeroHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *zeroHook) Fire(entry *logrus.Entry) error {
+	lv := zeroLevel(entry.Level)
+	if lv < h.zb.getLevel() {
+		return nil
+	}
+	//fatal panic 由 logrus 处理退出 这里只写日志
+	e := h.zb.base.WithLevel(lv)
+	if len(entry.Data) > 0 {
+		e = e.Fields(map[string]interface{}(entry.Data))
+	}
+	if entry.HasCaller() {
+		e = e.Str(zerolog.CallerFieldName, fmt.Sprintf("%s:%d", entry.Caller.File, entry.Caller.Line))
+	}
+	e.Msg(entry.Message)
+	return nil
+}
+
+//只写入不低于 min 级别的日志
+type levelWriter struct {
+	w   io.Writer
+	min zerolog.Level
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+func (w *levelWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level < w.min {
+		return len(p), nil
+	}
+	return w.w.Write(p)
+}
+
+//zerolog 实现 级别随 Log.SetLevel 变化
+type zeroLogger struct {
+	zb *zeroBackend
+	l  zerolog.Logger
+}
+
+func (z zeroLogger) log(level zerolog.Level, format string, args []interface{}) {
+	if level < z.zb.getLevel() {
+		return
+	}
+	z.l.WithLevel(level).Msgf(format, args...)
+}
+
+func (z zeroLogger) Debugf(format string, args ...interface{}) {
+	z.log(zerolog.DebugLevel, format, args)
+}
+
+func (z zeroLogger) Infof(format string, args ...interface{}) {
+	z.log(zerolog.InfoLevel, format, args)
+}
+
+func (z zeroLogger) Warnf(format string, args ...interface{}) {
+	z.log(zerolog.WarnLevel, format, args)
+}
+
+func (z zeroLogger) Errorf(format string, args ...interface{}) {
+	z.log(zerolog.ErrorLevel, format, args)
+}
+
+func (z zeroLogger) WithFields(fields map[string]interface{}) Logger {
+	return zeroLogger{zb: z.zb, l: z.l.With().Fields(fields).Logger()}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/jeevic/lego/components/config"
+	"github.com/jeevic/lego/components/graceful"
+)
+
+//独立端口暴露指标 组件名称
+const ComponentName = "metrics"
+
+//独立端口指标服务 实现 app.Component 统一启停
+type AdminServer struct {
+	Addr   string
+	Path   string
+	Server *http.Server
+	mux    *http.ServeMux
+	//运行状态 1 运行中
+	running int32
+}
+
+func NewAdminServer(addr string, path string) *AdminServer {
+	if len(path) == 0 {
+		path = DefaultPath
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, Handler())
+	return &AdminServer{
+		Addr:   addr,
+		Path:   path,
+		Server: &http.Server{Addr: addr, Handler: mux},
+		mux:    mux,
+	}
+}
+
+//挂载其他管理接口 需在 Start 前调用
+func (s *AdminServer) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *AdminServer) Name() string {
+	return ComponentName
+}
+
+func (s *AdminServer) Init(cfg *config.Config) error {
+	return nil
+}
+
+//组件启动 监听失败直接返回 平滑重启时复用父进程传递的监听
+func (s *AdminServer) Start() error {
+	l, err := graceful.Listen(ComponentName, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&s.running, 1)
+	go func() {
+		defer atomic.StoreInt32(&s.running, 0)
+		_ = s.Server.Serve(l)
+	}()
+	return nil
+}
+
+func (s *AdminServer) Stop(ctx context.Context) error {
+	defer atomic.StoreInt32(&s.running, 0)
+	return s.Server.Shutdown(ctx)
+}
+
+func (s *AdminServer) Health() error {
+	if atomic.LoadInt32(&s.running) != 1 {
+		return errors.New("metrics server not running")
+	}
+	return nil
+}
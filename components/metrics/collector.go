@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/jeevic/lego/components/breakers"
+	"github.com/jeevic/lego/components/breakers/breaker"
+	"github.com/jeevic/lego/components/grpc/grpcclient"
+	"github.com/jeevic/lego/components/ratelimit"
+)
+
+var (
+	breakerAccepts = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "breaker", "window_accepts"),
+		"Accepted requests of breaker in the rolling window.", []string{"name"}, nil)
+	breakerTotal = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "breaker", "window_requests"),
+		"Total requests of breaker in the rolling window.", []string{"name"}, nil)
+	breakerDrops = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "breaker", "dropped_total"),
+		"Total requests dropped by breaker.", []string{"name"}, nil)
+	breakerCancels = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "breaker", "cancelled_total"),
+		"Total requests cancelled by caller in breaker.", []string{"name"}, nil)
+
+	poolCapacity = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "grpc", "client_pool_capacity"),
+		"Capacity of grpc client pool.", []string{"pool", "target"}, nil)
+	poolConns = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "grpc", "client_pool_conns"),
+		"Connections of grpc client pool by state.", []string{"pool", "target", "state"}, nil)
+	poolHealthy = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "grpc", "client_pool_healthy_conns"),
+		"Healthy connections of grpc client pool.", []string{"pool", "target"}, nil)
+	poolInflight = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "grpc", "client_pool_inflight"),
+		"Inflight requests of grpc client pool.", []string{"pool", "target"}, nil)
+	poolRedials = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "grpc", "client_pool_redials_total"),
+		"Total connections redialed by grpc client pool.", []string{"pool", "target"}, nil)
+
+	adaptiveLimit = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "ratelimit", "adaptive_limit"),
+		"Concurrency limit of adaptive limiter.", []string{"server"}, nil)
+	adaptiveInflight = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "ratelimit", "adaptive_inflight"),
+		"Inflight requests of adaptive limiter.", []string{"server"}, nil)
+	adaptiveDropped = prometheus.NewDesc(prometheus.BuildFQName(Namespace, "ratelimit", "adaptive_dropped_total"),
+		"Total requests dropped by adaptive limiter.", []string{"server"}, nil)
+)
+
+//采集 breakers 统计
+type breakerCollector struct{}
+
+func (breakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- breakerAccepts
+	ch <- breakerTotal
+	ch <- breakerDrops
+	ch <- breakerCancels
+}
+
+func (breakerCollector) Collect(ch chan<- prometheus.Metric) {
+	breakers.Range(func(name string, bk breaker.EffectiveBreaker) {
+		st := bk.Stat()
+		ch <- prometheus.MustNewConstMetric(breakerAccepts, prometheus.GaugeValue, float64(st.Accepts), name)
+		ch <- prometheus.MustNewConstMetric(breakerTotal, prometheus.GaugeValue, float64(st.Total), name)
+		ch <- prometheus.MustNewConstMetric(breakerDrops, prometheus.CounterValue, float64(st.Drops), name)
+		ch <- prometheus.MustNewConstMetric(breakerCancels, prometheus.CounterValue, float64(st.Cancels), name)
+	})
+}
+
+var pools sync.Map
+
+//注册 grpc 客户端连接池 采集连接状态
+func RegisterGrpcPool(name string, p *grpcclient.Pool) {
+	pools.Store(name, p)
+}
+
+func UnregisterGrpcPool(name string) {
+	pools.Delete(name)
+}
+
+//采集 grpc 客户端连接池状态
+type poolCollector struct{}
+
+func (poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolCapacity
+	ch <- poolConns
+	ch <- poolHealthy
+	ch <- poolInflight
+	ch <- poolRedials
+}
+
+func (poolCollector) Collect(ch chan<- prometheus.Metric) {
+	pools.Range(func(key, value interface{}) bool {
+		name := key.(string)
+		st := value.(*grpcclient.Pool).Stats()
+		ch <- prometheus.MustNewConstMetric(poolCapacity, prometheus.GaugeValue, float64(st.Capacity), name, st.Target)
+		for state, n := range st.States {
+			ch <- prometheus.MustNewConstMetric(poolConns, prometheus.GaugeValue, float64(n), name, st.Target, state)
+		}
+		ch <- prometheus.MustNewConstMetric(poolHealthy, prometheus.GaugeValue, float64(st.Healthy), name, st.Target)
+		ch <- prometheus.MustNewConstMetric(poolInflight, prometheus.GaugeValue, float64(st.Inflight), name, st.Target)
+		ch <- prometheus.MustNewConstMetric(poolRedials, prometheus.CounterValue, float64(st.Redials), name, st.Target)
+		return true
+	})
+}
+
+var adaptives sync.Map
+
+//注册自适应限流 server 为 http grpc
+func RegisterAdaptive(server string, l *ratelimit.AdaptiveLimiter) {
+	adaptives.Store(server, l)
+}
+
+//采集自适应限流状态
+type adaptiveCollector struct{}
+
+func (adaptiveCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- adaptiveLimit
+	ch <- adaptiveInflight
+	ch <- adaptiveDropped
+}
+
+func (adaptiveCollector) Collect(ch chan<- prometheus.Metric) {
+	adaptives.Range(func(key, value interface{}) bool {
+		server := key.(string)
+		l := value.(*ratelimit.AdaptiveLimiter)
+		ch <- prometheus.MustNewConstMetric(adaptiveLimit, prometheus.GaugeValue, l.Limit(), server)
+		ch <- prometheus.MustNewConstMetric(adaptiveInflight, prometheus.GaugeValue, float64(l.Inflight()), server)
+		ch <- prometheus.MustNewConstMetric(adaptiveDropped, prometheus.CounterValue, float64(l.Dropped()), server)
+		return true
+	})
+}
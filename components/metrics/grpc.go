@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	grpcTypeUnary  = "unary"
+	grpcTypeStream = "stream"
+)
+
+//grpc unary 请求统计
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observeGrpc(info.FullMethod, grpcTypeUnary, start, err)
+		return resp, err
+	}
+}
+
+//grpc stream 请求统计
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+		observeGrpc(info.FullMethod, grpcTypeStream, start, err)
+		return err
+	}
+}
+
+func observeGrpc(method string, t string, start time.Time, err error) {
+	GrpcRequests.WithLabelValues(method, t, status.Code(err).String()).Inc()
+	GrpcDuration.WithLabelValues(method, t).Observe(time.Since(start).Seconds())
+}
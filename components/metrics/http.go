@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//未匹配路由 避免 404 请求产生大量 label
+const unmatchedRoute = "unmatched"
+
+//gin 注册请求统计中间件 并挂载指标路径 path 为空时只统计不挂载
+func UseHttpMetrics(engine *gin.Engine, path string) {
+	engine.Use(HttpMiddleware())
+	if len(path) > 0 {
+		engine.GET(path, gin.WrapH(Handler()))
+	}
+}
+
+//请求数 耗时统计 按路由模板区分
+func HttpMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if len(route) == 0 {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		HttpRequests.WithLabelValues(route, c.Request.Method, status).Inc()
+		HttpDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+//prometheus 指标
+//usage:
+//	//gin 挂载 /metrics 以及请求统计中间件
+//	metrics.UseHttpMetrics(engine, "/metrics")
+//	//grpc 拦截器
+//	grpcserver.WithAppendUnaryInterceptor(metrics.UnaryServerInterceptor())
+//	//grpc 客户端连接池
+//	metrics.RegisterGrpcPool("user", pool)
+
+//指标前缀
+const Namespace = "lego"
+
+//默认暴露路径
+const DefaultPath = "/metrics"
+
+//指标注册中心 包含 go 运行时 进程指标
+var Registry = prometheus.NewRegistry()
+
+var (
+	//http 请求数
+	HttpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Total number of http requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	//http 请求耗时
+	HttpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Http request latency by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	//grpc 请求数
+	GrpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "grpc",
+		Name:      "server_handled_total",
+		Help:      "Total number of grpc requests by method, type and code.",
+	}, []string{"method", "type", "code"})
+
+	//grpc 请求耗时
+	GrpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "grpc",
+		Name:      "server_handling_seconds",
+		Help:      "Grpc request latency by method and type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "type"})
+
+	//限流拒绝次数 server 为 http grpc
+	RateLimitRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "ratelimit",
+		Name:      "rejected_total",
+		Help:      "Total number of requests rejected by rate limiter.",
+	}, []string{"server", "path"})
+
+	//kafka 生产消息数 result 为 success error
+	KafkaProduced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "kafka",
+		Name:      "produced_total",
+		Help:      "Total number of kafka messages produced by topic and result.",
+	}, []string{"topic", "result"})
+
+	//kafka 消费消息数
+	KafkaConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "kafka",
+		Name:      "consumed_total",
+		Help:      "Total number of kafka messages consumed by topic.",
+	}, []string{"topic"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		HttpRequests,
+		HttpDuration,
+		GrpcRequests,
+		GrpcDuration,
+		RateLimitRejected,
+		KafkaProduced,
+		KafkaConsumed,
+		breakerCollector{},
+		poolCollector{},
+		adaptiveCollector{},
+	)
+}
+
+//注册自定义指标
+func Register(cs ...prometheus.Collector) error {
+	for _, c := range cs {
+		if err := Registry.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//指标输出 handler
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
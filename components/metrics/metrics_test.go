@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jeevic/lego/components/breakers"
+)
+
+func TestUseHttpMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	UseHttpMetrics(engine, DefaultPath)
+	engine.GET("/user/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	before := testutil.ToFloat64(HttpRequests.WithLabelValues("/user/:id", "GET", "200"))
+	for _, path := range []string{"/user/1", "/user/2", "/not-found"} {
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	assert.Equal(t, before+2, testutil.ToFloat64(HttpRequests.WithLabelValues("/user/:id", "GET", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(HttpRequests.WithLabelValues(unmatchedRoute, "GET", "404")))
+
+	//breaker 统计
+	bk := breakers.NewBreaker().GetOrBuild("metrics_test")
+	_ = bk.Do(func() error { return nil })
+	_ = bk.Do(func() error { return errors.New("fail") })
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, DefaultPath, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body, _ := ioutil.ReadAll(w.Body)
+	out := string(body)
+	assert.True(t, strings.Contains(out, `lego_http_requests_total{method="GET",route="/user/:id",status="200"}`))
+	assert.True(t, strings.Contains(out, `lego_breaker_window_requests{name="metrics_test"} 2`))
+	assert.True(t, strings.Contains(out, `lego_breaker_window_accepts{name="metrics_test"} 1`))
+	assert.True(t, strings.Contains(out, "go_goroutines"))
+}
@@ -56,6 +56,20 @@ func GetMongoClient(instance string) *mongo.Client {
 	return nil
 }
 
+//注销实例 并关闭连接
+func Unregister(instance string) error {
+	defer mg.mutex.Unlock()
+	mg.mutex.Lock()
+
+	ins, ok := mg.instances[instance]
+	if !ok {
+		return errors.New(fmt.Sprintf("instance:%s not exists!", instance))
+	}
+	ins.Close()
+	delete(mg.instances, instance)
+	return nil
+}
+
 func Reset() {
 	defer mg.mutex.Unlock()
 	mg.mutex.Lock()
@@ -1,12 +1,15 @@
 package consumer
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/apache/pulsar-client-go/pulsar"
+
+	"github.com/jeevic/lego/components/tracing"
 )
 
 var wg sync.WaitGroup
@@ -74,7 +77,25 @@ func (consumer *Consumer) NackMsg(msg pulsar.Message) {
 	consumer.Consumer.Nack(msg)
 }
 
+//健康检查 查询 topic 分区
+func (consumer *Consumer) Ping() error {
+	if consumer.Consumer == nil {
+		return errors.New("pulsar consumer not subscribed")
+	}
+	_, err := consumer.client.TopicPartitions(consumer.setting.Topic)
+	return err
+}
+
 func (consumer *Consumer) Close() {
 	consumer.Consumer.Close()
 	consumer.client.Close()
 }
+
+//读取消息属性 traceparent 开启消费 span 处理完成后调用 span.End()
+func StartSpan(ctx context.Context, msg pulsar.Message) (context.Context, *tracing.Span) {
+	ctx = tracing.Extract(ctx, tracing.MapCarrier(msg.Properties()))
+	ctx, span := tracing.Start(ctx, "pulsar receive "+msg.Topic(), tracing.SpanKindConsumer)
+	span.SetAttribute("messaging.system", "pulsar")
+	span.SetAttribute("messaging.destination", msg.Topic())
+	return ctx, span
+}
@@ -7,6 +7,9 @@ import (
 	"time"
 
 	"github.com/apache/pulsar-client-go/pulsar"
+
+	"github.com/jeevic/lego/components/retry"
+	"github.com/jeevic/lego/components/tracing"
 )
 
 type Producer struct {
@@ -21,6 +24,8 @@ type setting struct {
 	OperationTimeout  time.Duration
 	ConnectionTimeout time.Duration
 	Token             string
+	//按策略退避重试发送 为空不重试
+	Retry *retry.Policy
 }
 
 func NewSetting() *setting {
@@ -47,24 +52,80 @@ func NewProducer(setting *setting) (*Producer, error) {
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("create pulsar producer error:%s", err.Error()))
 	}
-	return &Producer{producer: producer, setting: setting}, nil
+	return &Producer{producer: producer, client: client, setting: setting}, nil
 }
 func (pulsarProducer *Producer) SendMsgSync(key string, value string) (msgId pulsar.MessageID, err error) {
 	return pulsarProducer.SendMsgDelay(key, value, -1)
 }
 
+//同步发送 ctx 中的 trace 写入消息属性
+func (pulsarProducer *Producer) SendMsgSyncCtx(ctx context.Context, key string, value string) (msgId pulsar.MessageID, err error) {
+	return pulsarProducer.SendMsgDelayCtx(ctx, key, value, -1)
+}
+
 func (pulsarProducer *Producer) SendMsgDelay(key string, value string, delayAfter time.Duration) (msgId pulsar.MessageID, err error) {
-	msg := pulsar.ProducerMessage{Payload: []byte(value), Key: key}
+	return pulsarProducer.SendMsgDelayCtx(context.Background(), key, value, delayAfter)
+}
+
+func (pulsarProducer *Producer) SendMsgDelayCtx(ctx context.Context, key string, value string, delayAfter time.Duration) (msgId pulsar.MessageID, err error) {
+	ctx, span := tracing.Start(ctx, "pulsar send "+pulsarProducer.setting.Topic, tracing.SpanKindProducer)
+	defer span.End()
+	span.SetAttribute("messaging.system", "pulsar")
+	span.SetAttribute("messaging.destination", pulsarProducer.setting.Topic)
+
+	msg := pulsar.ProducerMessage{Payload: []byte(value), Key: key, Properties: map[string]string{}}
 	if delayAfter > 0 {
 		msg.DeliverAfter = delayAfter
 	}
-	msgId, err = pulsarProducer.producer.Send(context.Background(), &msg)
+	tracing.Inject(ctx, tracing.MapCarrier(msg.Properties))
+	err = pulsarProducer.send(ctx, func(ctx context.Context) error {
+		var err error
+		msgId, err = pulsarProducer.producer.Send(ctx, &msg)
+		return err
+	})
 	if err != nil {
+		span.SetError(err)
 		return nil, errors.New(fmt.Sprintf("send message error:%s", err.Error()))
 	}
 	return msgId, nil
 }
 
+//按 Retry 策略发送
+func (pulsarProducer *Producer) send(ctx context.Context, fn func(ctx context.Context) error) error {
+	if pulsarProducer.setting.Retry == nil {
+		return fn(ctx)
+	}
+	p := *pulsarProducer.setting.Retry
+	if p.Retryable == nil {
+		p.Retryable = RetryableError
+	}
+	if len(p.Name) == 0 {
+		p.Name = "pulsar send " + pulsarProducer.setting.Topic
+	}
+	return retry.Do(ctx, p, fn)
+}
+
+//默认重试的错误 超时 连接失败 发送队列满
+func RetryableError(err error) bool {
+	var pe *pulsar.Error
+	if !errors.As(err, &pe) {
+		return false
+	}
+	switch pe.Result() {
+	case pulsar.TimeoutError, pulsar.LookupError, pulsar.ConnectError, pulsar.NotConnectedError,
+		pulsar.ServiceUnitNotReady, pulsar.ProducerQueueIsFull, pulsar.TooManyLookupRequestException:
+		return true
+	default:
+		return false
+	}
+}
+
+//健康检查 查询 topic 分区
+func (pulsarProducer *Producer) Ping() error {
+	_, err := pulsarProducer.client.TopicPartitions(pulsarProducer.setting.Topic)
+	return err
+}
+
 func (pulsarProducer *Producer) Close() {
 	pulsarProducer.producer.Close()
 	pulsarProducer.client.Close()
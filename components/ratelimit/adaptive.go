@@ -0,0 +1,217 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jeevic/lego/components/breakers/breaker"
+)
+
+//自适应并发限制 无需按接口配置 qps
+//按延迟梯度调整并发上限 延迟超过空载延迟 tolerance 倍时收缩 饱和且延迟正常时按 sqrt(limit) 增长
+//空载延迟取长期基线与窗口内 bucket 平均延迟最小值中较小者
+//长期基线为各周期平均延迟的慢速 EWMA 持续过载时只缓慢上移 窗口内延迟下降时随之下降
+//usage:
+//
+//	[httpserver.adaptive]
+//	enable = true
+//	min_limit = 10
+//	max_limit = 1000
+//
+//	l := ratelimit.NewAdaptiveLimiter(setting)
+//	done, ok := l.Acquire()
+//	if !ok {
+//		//过载 拒绝请求
+//	}
+//	defer done()
+
+//bucket 样本数不足时不参与空载延迟计算
+const adaptiveMinSamples = 10
+
+//自适应限流配置
+type AdaptiveSetting struct {
+	Enable       bool `mapstructure:"enable"`
+	InitialLimit int  `mapstructure:"initial_limit" default:"100"`
+	MinLimit     int  `mapstructure:"min_limit" default:"10"`
+	MaxLimit     int  `mapstructure:"max_limit" default:"1000"`
+	//允许的延迟放大倍数
+	Tolerance float64 `mapstructure:"tolerance" default:"2"`
+	//每次调整的平滑系数 (0,1]
+	Smoothing float64 `mapstructure:"smoothing" default:"0.2"`
+	//延迟统计窗口 bucket 数 每个 bucket 结束时调整一次上限
+	Window  time.Duration `mapstructure:"window" default:"10s"`
+	Buckets int           `mapstructure:"buckets" default:"50"`
+	//空载延迟长期基线的时间常数 需远大于 window
+	BaselineWindow time.Duration `mapstructure:"baseline_window" default:"10m"`
+}
+
+type AdaptiveLimiter struct {
+	setting  AdaptiveSetting
+	interval time.Duration
+	//延迟 ms
+	rt       *breaker.RollingWindow
+	inflight int64
+	//float64 bits
+	limit   uint64
+	dropped uint64
+
+	//当前周期统计
+	mutex       sync.Mutex
+	sum         float64
+	count       int64
+	maxInflight int64
+	lastUpdate  time.Time
+	//长期基线延迟 ms 0 表示未初始化
+	baseline float64
+}
+
+//补全默认值
+func NewAdaptiveLimiter(setting AdaptiveSetting) *AdaptiveLimiter {
+	if setting.MinLimit <= 0 {
+		setting.MinLimit = 1
+	}
+	if setting.MaxLimit < setting.MinLimit {
+		setting.MaxLimit = setting.MinLimit
+	}
+	if setting.InitialLimit < setting.MinLimit {
+		setting.InitialLimit = setting.MinLimit
+	}
+	if setting.InitialLimit > setting.MaxLimit {
+		setting.InitialLimit = setting.MaxLimit
+	}
+	if setting.Tolerance < 1 {
+		setting.Tolerance = 1
+	}
+	if setting.Smoothing <= 0 || setting.Smoothing > 1 {
+		setting.Smoothing = 0.2
+	}
+	if setting.Window <= 0 {
+		setting.Window = 10 * time.Second
+	}
+	if setting.Buckets <= 0 {
+		setting.Buckets = 50
+	}
+	if setting.BaselineWindow < setting.Window {
+		setting.BaselineWindow = 60 * setting.Window
+	}
+	interval := setting.Window / time.Duration(setting.Buckets)
+	l := &AdaptiveLimiter{
+		setting:    setting,
+		interval:   interval,
+		rt:         breaker.NewRollingWindow(setting.Buckets, interval),
+		lastUpdate: time.Now(),
+	}
+	l.setLimit(float64(setting.InitialLimit))
+	return l
+}
+
+//获取执行许可 ok 为 false 时过载应拒绝 否则请求结束后调用 done
+func (l *AdaptiveLimiter) Acquire() (done func(), ok bool) {
+	inflight := atomic.AddInt64(&l.inflight, 1)
+	if float64(inflight) > l.Limit() {
+		atomic.AddInt64(&l.inflight, -1)
+		atomic.AddUint64(&l.dropped, 1)
+		return nil, false
+	}
+	start := time.Now()
+	var once int32
+	return func() {
+		if atomic.CompareAndSwapInt32(&once, 0, 1) {
+			l.onComplete(time.Since(start), inflight)
+			atomic.AddInt64(&l.inflight, -1)
+		}
+	}, true
+}
+
+//当前并发上限
+func (l *AdaptiveLimiter) Limit() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&l.limit))
+}
+
+func (l *AdaptiveLimiter) setLimit(v float64) {
+	atomic.StoreUint64(&l.limit, math.Float64bits(v))
+}
+
+//执行中的请求数
+func (l *AdaptiveLimiter) Inflight() int64 {
+	return atomic.LoadInt64(&l.inflight)
+}
+
+//拒绝的请求数
+func (l *AdaptiveLimiter) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+func (l *AdaptiveLimiter) onComplete(rt time.Duration, inflight int64) {
+	ms := float64(rt) / float64(time.Millisecond)
+	l.rt.Add(ms)
+
+	defer l.mutex.Unlock()
+	l.mutex.Lock()
+	l.sum += ms
+	l.count++
+	if inflight > l.maxInflight {
+		l.maxInflight = inflight
+	}
+	if time.Since(l.lastUpdate) < l.interval {
+		return
+	}
+	l.update(l.sum/float64(l.count), l.maxInflight)
+	l.sum, l.count, l.maxInflight = 0, 0, 0
+	l.lastUpdate = time.Now()
+}
+
+//按本周期平均延迟调整上限
+func (l *AdaptiveLimiter) update(shortRT float64, maxInflight int64) {
+	noLoad := l.updateBaseline(shortRT)
+	if min := l.noLoadRT(); min > 0 && min < noLoad {
+		noLoad = min
+	}
+	if noLoad <= 0 || noLoad > shortRT {
+		noLoad = shortRT
+	}
+	limit := l.Limit()
+	gradient := 1.0
+	if shortRT > 0 {
+		gradient = math.Max(0.5, math.Min(1, l.setting.Tolerance*noLoad/shortRT))
+	}
+	newLimit := limit*gradient + math.Sqrt(limit)
+	//未达到上限一半 流量不足以验证更高的并发 不增长
+	if float64(maxInflight) < limit/2 && newLimit > limit {
+		newLimit = limit
+	}
+	newLimit = (1-l.setting.Smoothing)*limit + l.setting.Smoothing*newLimit
+	newLimit = math.Max(float64(l.setting.MinLimit), math.Min(float64(l.setting.MaxLimit), newLimit))
+	l.setLimit(newLimit)
+}
+
+//按本周期平均延迟更新长期基线 返回更新后的基线
+//基线远高于当前延迟时快速回落 避免负载下降后上限增长过慢
+func (l *AdaptiveLimiter) updateBaseline(shortRT float64) float64 {
+	if l.baseline <= 0 {
+		l.baseline = shortRT
+		return l.baseline
+	}
+	alpha := math.Min(1, float64(l.interval)/float64(l.setting.BaselineWindow))
+	l.baseline += alpha * (shortRT - l.baseline)
+	if shortRT > 0 && l.baseline/shortRT > 2 {
+		l.baseline *= 0.95
+	}
+	return l.baseline
+}
+
+//窗口内 bucket 平均延迟的最小值
+func (l *AdaptiveLimiter) noLoadRT() float64 {
+	min := 0.0
+	l.rt.Reduce(func(b *breaker.Bucket) {
+		if b.Count < adaptiveMinSamples {
+			return
+		}
+		if avg := b.Sum / float64(b.Count); min == 0 || avg < min {
+			min = avg
+		}
+	})
+	return min
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveLimiter_Acquire(t *testing.T) {
+	l := NewAdaptiveLimiter(AdaptiveSetting{InitialLimit: 2, MinLimit: 1, MaxLimit: 10})
+	d1, ok := l.Acquire()
+	assert.True(t, ok)
+	_, ok = l.Acquire()
+	assert.True(t, ok)
+	_, ok = l.Acquire()
+	assert.False(t, ok)
+	assert.Equal(t, uint64(1), l.Dropped())
+	assert.Equal(t, int64(2), l.Inflight())
+
+	//重复调用 done 只释放一次
+	d1()
+	d1()
+	assert.Equal(t, int64(1), l.Inflight())
+	_, ok = l.Acquire()
+	assert.True(t, ok)
+}
+
+func TestAdaptiveLimiter_Gradient(t *testing.T) {
+	l := NewAdaptiveLimiter(AdaptiveSetting{InitialLimit: 20, MinLimit: 5, MaxLimit: 100, Tolerance: 2, Smoothing: 0.5, Window: 200 * time.Millisecond, Buckets: 20})
+	feed := func(rt time.Duration, inflight func() int64, rounds int) {
+		for i := 0; i < rounds; i++ {
+			for j := 0; j < adaptiveMinSamples; j++ {
+				l.onComplete(rt, inflight())
+			}
+			time.Sleep(l.interval)
+		}
+	}
+	saturated := func() int64 { return int64(l.Limit()) }
+
+	//流量不足 不增长
+	feed(time.Millisecond, func() int64 { return 1 }, 5)
+	assert.Equal(t, float64(20), l.Limit())
+
+	//饱和且延迟正常 增长
+	feed(time.Millisecond, saturated, 10)
+	grown := l.Limit()
+	assert.True(t, grown > 20, "limit:%v", grown)
+
+	//延迟超过空载 tolerance 倍 收缩
+	feed(10*time.Millisecond, saturated, 10)
+	assert.True(t, l.Limit() < grown/2, "limit:%v", l.Limit())
+	assert.True(t, l.Limit() >= 5)
+}
+
+func TestAdaptiveLimiter_SustainedOverload(t *testing.T) {
+	l := NewAdaptiveLimiter(AdaptiveSetting{InitialLimit: 50, MinLimit: 5, MaxLimit: 100, Tolerance: 2, Smoothing: 0.5, Window: 100 * time.Millisecond, Buckets: 10})
+	feed := func(rt time.Duration, rounds int) {
+		for i := 0; i < rounds; i++ {
+			for j := 0; j < adaptiveMinSamples; j++ {
+				l.onComplete(rt, int64(l.Limit()))
+			}
+			time.Sleep(l.interval)
+		}
+	}
+	feed(time.Millisecond, 20)
+
+	//高延迟持续超过窗口数倍 窗口内最小延迟已追上 长期基线仍保持收缩
+	feed(10*time.Millisecond, 60)
+	assert.Equal(t, float64(5), l.Limit())
+	assert.True(t, l.noLoadRT() >= 10, "window min:%v", l.noLoadRT())
+	assert.True(t, l.baseline < 5, "baseline:%v", l.baseline)
+
+	//延迟恢复后重新增长
+	feed(time.Millisecond, 30)
+	assert.True(t, l.Limit() > 5, "limit:%v", l.Limit())
+}
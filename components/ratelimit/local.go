@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/juju/ratelimit"
+)
+
+//单机令牌桶 每个分桶一个 bucket
+//分桶数达到 MaxLocalKeys 后新 key 共用一个溢出桶 按 ip header 分桶时内存有上限
+var MaxLocalKeys = 10000
+
+//定时清理已补满的桶 补满的桶与新建等价 没有分桶时停止
+var LocalSweepInterval = 10 * time.Second
+
+type localLimiter struct {
+	limit   int64
+	burst   int64
+	rate    float64
+	buckets map[string]*ratelimit.Bucket
+	//分桶数达到上限后新 key 共用
+	overflow *ratelimit.Bucket
+	interval time.Duration
+	sweeping bool
+	mutex    sync.Mutex
+}
+
+func NewLocalLimiter(p Policy) Limiter {
+	if p.Period <= 0 {
+		p.Period = DefaultPeriod
+	}
+	if p.Burst <= 0 {
+		p.Burst = p.Limit
+	}
+	rate := float64(p.Limit) / p.Period.Seconds()
+	return &localLimiter{
+		limit:    p.Limit,
+		burst:    p.Burst,
+		rate:     rate,
+		buckets:  make(map[string]*ratelimit.Bucket),
+		overflow: ratelimit.NewBucketWithRate(rate, p.Burst),
+		interval: LocalSweepInterval,
+	}
+}
+
+func (l *localLimiter) bucket(key string) *ratelimit.Bucket {
+	defer l.mutex.Unlock()
+	l.mutex.Lock()
+	if b, ok := l.buckets[key]; ok {
+		return b
+	}
+	if len(l.buckets) >= MaxLocalKeys {
+		return l.overflow
+	}
+	b := ratelimit.NewBucketWithRate(l.rate, l.burst)
+	l.buckets[key] = b
+	if !l.sweeping {
+		l.sweeping = true
+		time.AfterFunc(l.interval, l.sweep)
+	}
+	return b
+}
+
+//删除已补满的桶
+func (l *localLimiter) sweep() {
+	defer l.mutex.Unlock()
+	l.mutex.Lock()
+	for k, b := range l.buckets {
+		if b.Available() >= b.Capacity() {
+			delete(l.buckets, k)
+		}
+	}
+	if len(l.buckets) == 0 {
+		l.sweeping = false
+		return
+	}
+	time.AfterFunc(l.interval, l.sweep)
+}
+
+func (l *localLimiter) Allow(ctx context.Context, key string) Result {
+	b := l.bucket(key)
+	allowed := b.TakeAvailable(1) == 1
+	remaining := b.Available()
+	if remaining < 0 {
+		remaining = 0
+	}
+	res := Result{
+		Allowed:   allowed,
+		Limit:     l.limit,
+		Remaining: remaining,
+		Reset:     l.duration(float64(l.burst - remaining)),
+	}
+	if !allowed {
+		res.RetryAfter = l.duration(1)
+	}
+	return res
+}
+
+//补充 n 个令牌需要的时间
+func (l *localLimiter) duration(n float64) time.Duration {
+	return time.Duration(n / l.rate * float64(time.Second))
+}
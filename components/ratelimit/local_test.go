@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalLimiter_MaxKeys(t *testing.T) {
+	defer func(n int, d time.Duration) { MaxLocalKeys, LocalSweepInterval = n, d }(MaxLocalKeys, LocalSweepInterval)
+	MaxLocalKeys = 3
+	LocalSweepInterval = 50 * time.Millisecond
+
+	l := NewLocalLimiter(Policy{Limit: 1, Period: 100 * time.Millisecond}).(*localLimiter)
+	keys := func() int {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		return len(l.buckets)
+	}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.Allow(ctx, fmt.Sprintf("key-%d", i)).Allowed)
+	}
+	//超过上限的 key 共用溢出桶 不再新建
+	assert.True(t, l.Allow(ctx, "new-1").Allowed)
+	assert.False(t, l.Allow(ctx, "new-2").Allowed)
+	assert.Equal(t, 3, keys())
+	//已有分桶不受影响
+	assert.False(t, l.Allow(ctx, "key-0").Allowed)
+
+	//补满后定时清理 新 key 重新分桶
+	assert.Eventually(t, func() bool {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		return len(l.buckets) == 0 && !l.sweeping
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, l.Allow(ctx, "new-2").Allowed)
+	assert.Equal(t, 1, keys())
+}
@@ -0,0 +1,362 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//限流策略引擎 http grpc 共用
+//策略按 path method 匹配请求 按 key_by 维度分桶 命中的策略全部通过才放行
+//usage:
+//
+//	[[httpserver.ratelimit.policies]]
+//	name = "user_api_key"
+//	path = "/api/v1/*"         # 空或 * 匹配全部 末尾 * 前缀匹配 grpc 为 FullMethod
+//	method = "POST"            # 空匹配全部
+//	key_by = ["route", "header:X-Api-Key"]
+//	limit = 100                # 每 period 请求数
+//	period = "1s"
+//	burst = 200                # 默认 limit
+//	store = "local"            # local(默认) redis 见 redis.go
+//
+//	engine := ratelimit.NewEngine()
+//	engine.AddPolicy(ratelimit.Policy{Name: "ip", KeyBy: []string{ratelimit.KeyIp}, Limit: 10})
+//	res, matched := engine.Allow(ctx, req)
+
+//分桶维度
+const (
+	//路由 http 为 method + FullPath grpc 为 FullMethod
+	KeyRoute = "route"
+	//客户端 ip
+	KeyIp = "ip"
+	//请求头 如 header:X-Api-Key
+	KeyHeader = "header:"
+	//grpc metadata 如 metadata:tenant http 等同请求头
+	KeyMetadata = "metadata:"
+)
+
+//限流存储
+const (
+	StoreLocal = "local"
+	StoreRedis = "redis"
+)
+
+//限流算法 单机只支持令牌桶
+const (
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmSlidingWindow = "sliding_window"
+)
+
+//默认限流周期
+const DefaultPeriod = time.Second
+
+//默认 redis 实例 与 app.DefaultInstance 一致
+const DefaultRedisInstance = "app"
+
+//维度取值为空时使用的分桶
+const emptyKey = "-"
+
+//限流策略
+type Policy struct {
+	Name   string        `mapstructure:"name"`
+	Path   string        `mapstructure:"path"`
+	Method string        `mapstructure:"method"`
+	KeyBy  []string      `mapstructure:"key_by"`
+	Limit  int64         `mapstructure:"limit"`
+	Period time.Duration `mapstructure:"period"`
+	Burst  int64         `mapstructure:"burst"`
+	//local redis
+	Store string `mapstructure:"store"`
+	//redis 实例名
+	Redis     string `mapstructure:"redis"`
+	Algorithm string `mapstructure:"algorithm"`
+}
+
+//限流结果 用于输出 X-RateLimit-* Retry-After
+type Result struct {
+	Allowed bool
+	//命中的策略
+	Policy    string
+	Limit     int64
+	Remaining int64
+	//令牌补满的时间
+	Reset time.Duration
+	//拒绝时 下一个令牌可用的时间
+	RetryAfter time.Duration
+}
+
+//请求信息 由 http grpc 分别实现
+type Request interface {
+	//http FullPath grpc FullMethod
+	Route() string
+	//http method grpc 为空
+	Method() string
+	ClientIP() string
+	//http 请求头 grpc metadata
+	Header(key string) string
+}
+
+//限流器 key 为策略内的分桶
+type Limiter interface {
+	Allow(ctx context.Context, key string) Result
+}
+
+//按策略创建限流器
+type LimiterFactory func(p Policy) Limiter
+
+//按策略 store 创建限流器
+func NewLimiter(p Policy) Limiter {
+	if p.Store == StoreRedis {
+		return NewRedisLimiter(p)
+	}
+	return NewLocalLimiter(p)
+}
+
+type policy struct {
+	Policy
+	limiter Limiter
+}
+
+type Engine struct {
+	policies []*policy
+	factory  LimiterFactory
+	mutex    sync.RWMutex
+}
+
+func NewEngine() *Engine {
+	return &Engine{factory: NewLimiter}
+}
+
+//设置限流器创建方式 已有策略不受影响
+func (e *Engine) SetLimiterFactory(f LimiterFactory) {
+	defer e.mutex.Unlock()
+	e.mutex.Lock()
+	e.factory = f
+}
+
+//补全默认值
+func normalize(p Policy) (Policy, error) {
+	if p.Limit <= 0 {
+		return p, errors.New(fmt.Sprintf("ratelimit policy:%s limit must be positive", p.Name))
+	}
+	if p.Period <= 0 {
+		p.Period = DefaultPeriod
+	}
+	if p.Burst <= 0 {
+		p.Burst = p.Limit
+	}
+	p.Method = strings.ToUpper(p.Method)
+	switch p.Store {
+	case "":
+		p.Store = StoreLocal
+	case StoreLocal:
+	case StoreRedis:
+		if len(p.Redis) == 0 {
+			p.Redis = DefaultRedisInstance
+		}
+	default:
+		return p, errors.New(fmt.Sprintf("ratelimit policy:%s store:%s not support", p.Name, p.Store))
+	}
+	switch p.Algorithm {
+	case "":
+		p.Algorithm = AlgorithmTokenBucket
+	case AlgorithmTokenBucket, AlgorithmSlidingWindow:
+	default:
+		return p, errors.New(fmt.Sprintf("ratelimit policy:%s algorithm:%s not support", p.Name, p.Algorithm))
+	}
+	for _, k := range p.KeyBy {
+		if k != KeyRoute && k != KeyIp && !isHeaderKey(k) {
+			return p, errors.New(fmt.Sprintf("ratelimit policy:%s key_by:%s not support", p.Name, k))
+		}
+	}
+	if len(p.Name) == 0 {
+		p.Name = strings.Join(append([]string{p.Method, p.Path}, p.KeyBy...), "|")
+	}
+	return p, nil
+}
+
+func isHeaderKey(k string) bool {
+	return (strings.HasPrefix(k, KeyHeader) && len(k) > len(KeyHeader)) ||
+		(strings.HasPrefix(k, KeyMetadata) && len(k) > len(KeyMetadata))
+}
+
+//限流参数相同
+func samePolicy(a, b Policy) bool {
+	if a.Path != b.Path || a.Method != b.Method || a.Limit != b.Limit || a.Period != b.Period || a.Burst != b.Burst ||
+		a.Store != b.Store || a.Redis != b.Redis || a.Algorithm != b.Algorithm || len(a.KeyBy) != len(b.KeyBy) {
+		return false
+	}
+	for i := range a.KeyBy {
+		if a.KeyBy[i] != b.KeyBy[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//添加策略 同名策略替换
+func (e *Engine) AddPolicy(p Policy) error {
+	p, err := normalize(p)
+	if err != nil {
+		return err
+	}
+	defer e.mutex.Unlock()
+	e.mutex.Lock()
+	np := &policy{Policy: p, limiter: e.factory(p)}
+	for i, old := range e.policies {
+		if old.Name == p.Name {
+			e.policies[i] = np
+			return nil
+		}
+	}
+	e.policies = append(e.policies, np)
+	return nil
+}
+
+//删除策略
+func (e *Engine) RemovePolicy(name string) {
+	defer e.mutex.Unlock()
+	e.mutex.Lock()
+	for i, p := range e.policies {
+		if p.Name == name {
+			e.policies = append(e.policies[:i:i], e.policies[i+1:]...)
+			return
+		}
+	}
+}
+
+//整体替换策略 用于配置热加载 参数未变化的策略保留令牌
+func (e *Engine) SetPolicies(ps []Policy) error {
+	policies := make([]*policy, 0, len(ps))
+	names := make(map[string]bool, len(ps))
+	for _, p := range ps {
+		p, err := normalize(p)
+		if err != nil {
+			return err
+		}
+		if names[p.Name] {
+			return errors.New(fmt.Sprintf("ratelimit policy:%s duplicate", p.Name))
+		}
+		names[p.Name] = true
+		policies = append(policies, &policy{Policy: p})
+	}
+
+	defer e.mutex.Unlock()
+	e.mutex.Lock()
+	old := make(map[string]*policy, len(e.policies))
+	for _, p := range e.policies {
+		old[p.Name] = p
+	}
+	for _, p := range policies {
+		if o, ok := old[p.Name]; ok && samePolicy(o.Policy, p.Policy) {
+			p.limiter = o.limiter
+			continue
+		}
+		p.limiter = e.factory(p.Policy)
+	}
+	e.policies = policies
+	return nil
+}
+
+//当前策略
+func (e *Engine) Policies() []Policy {
+	defer e.mutex.RUnlock()
+	e.mutex.RLock()
+	ps := make([]Policy, 0, len(e.policies))
+	for _, p := range e.policies {
+		ps = append(ps, p.Policy)
+	}
+	return ps
+}
+
+//依次检查命中的策略 任一拒绝即拒绝
+//返回拒绝的策略结果 全部通过时返回剩余最少的结果 matched 为是否命中策略
+func (e *Engine) Allow(ctx context.Context, req Request) (res Result, matched bool) {
+	e.mutex.RLock()
+	policies := e.policies
+	e.mutex.RUnlock()
+
+	res = Result{Allowed: true, Remaining: math.MaxInt64}
+	for _, p := range policies {
+		if !p.match(req) {
+			continue
+		}
+		r := p.limiter.Allow(ctx, p.key(req))
+		r.Policy = p.Name
+		if !r.Allowed {
+			return r, true
+		}
+		if !matched || r.Remaining < res.Remaining {
+			res = r
+		}
+		matched = true
+	}
+	return res, matched
+}
+
+func (p *policy) match(req Request) bool {
+	if len(p.Method) > 0 && p.Method != strings.ToUpper(req.Method()) {
+		return false
+	}
+	switch {
+	case len(p.Path) == 0 || p.Path == "*":
+		return true
+	case strings.HasSuffix(p.Path, "*"):
+		return strings.HasPrefix(req.Route(), strings.TrimSuffix(p.Path, "*"))
+	default:
+		return p.Path == req.Route()
+	}
+}
+
+//分桶 key 未配置维度时策略共用一个桶
+func (p *policy) key(req Request) string {
+	if len(p.KeyBy) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(p.KeyBy))
+	for _, k := range p.KeyBy {
+		var v string
+		switch {
+		case k == KeyRoute:
+			v = strings.TrimSpace(req.Method() + " " + req.Route())
+		case k == KeyIp:
+			v = req.ClientIP()
+		case strings.HasPrefix(k, KeyHeader):
+			v = req.Header(k[len(KeyHeader):])
+		case strings.HasPrefix(k, KeyMetadata):
+			v = req.Header(k[len(KeyMetadata):])
+		}
+		if len(v) == 0 {
+			v = emptyKey
+		}
+		parts = append(parts, v)
+	}
+	return strings.Join(parts, "|")
+}
+
+//响应头 秒 向上取整
+func (r Result) Headers() map[string]string {
+	h := map[string]string{
+		"X-RateLimit-Limit":     strconv.FormatInt(r.Limit, 10),
+		"X-RateLimit-Remaining": strconv.FormatInt(r.Remaining, 10),
+		"X-RateLimit-Reset":     strconv.FormatInt(ceilSeconds(r.Reset), 10),
+	}
+	if !r.Allowed {
+		after := ceilSeconds(r.RetryAfter)
+		if after < 1 {
+			after = 1
+		}
+		h["Retry-After"] = strconv.FormatInt(after, 10)
+	}
+	return h
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
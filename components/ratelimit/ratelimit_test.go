@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRequest struct {
+	route   string
+	method  string
+	ip      string
+	headers map[string]string
+}
+
+func (r fakeRequest) Route() string            { return r.route }
+func (r fakeRequest) Method() string           { return r.method }
+func (r fakeRequest) ClientIP() string         { return r.ip }
+func (r fakeRequest) Header(key string) string { return r.headers[key] }
+
+func TestEngine_KeyBy(t *testing.T) {
+	e := NewEngine()
+	assert.Nil(t, e.AddPolicy(Policy{Name: "ip", Path: "/api/*", KeyBy: []string{KeyIp}, Limit: 2, Period: time.Minute}))
+	assert.Nil(t, e.AddPolicy(Policy{Name: "tenant", Method: "post", KeyBy: []string{KeyRoute, "header:X-Tenant"}, Limit: 1, Period: time.Minute}))
+	ctx := context.Background()
+
+	a := fakeRequest{route: "/api/user", method: "GET", ip: "10.0.0.1"}
+	b := fakeRequest{route: "/api/user", method: "GET", ip: "10.0.0.2"}
+	for i := 0; i < 2; i++ {
+		res, matched := e.Allow(ctx, a)
+		assert.True(t, matched)
+		assert.True(t, res.Allowed)
+	}
+	res, _ := e.Allow(ctx, a)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, "ip", res.Policy)
+	assert.True(t, res.RetryAfter > 0)
+	//不同 ip 独立分桶
+	res, _ = e.Allow(ctx, b)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(1), res.Remaining)
+
+	//路径不匹配
+	_, matched := e.Allow(ctx, fakeRequest{route: "/health", method: "GET"})
+	assert.False(t, matched)
+
+	//method + route + 租户 组合分桶
+	t1 := fakeRequest{route: "/order", method: "POST", headers: map[string]string{"X-Tenant": "t1"}}
+	t2 := fakeRequest{route: "/order", method: "POST", headers: map[string]string{"X-Tenant": "t2"}}
+	res, _ = e.Allow(ctx, t1)
+	assert.True(t, res.Allowed)
+	res, _ = e.Allow(ctx, t1)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, "tenant", res.Policy)
+	res, _ = e.Allow(ctx, t2)
+	assert.True(t, res.Allowed)
+	res, _ = e.Allow(ctx, fakeRequest{route: "/other", method: "POST", headers: map[string]string{"X-Tenant": "t1"}})
+	assert.True(t, res.Allowed)
+}
+
+func TestEngine_GlobalAndPath(t *testing.T) {
+	//全局与接口限流同时生效
+	e := NewEngine()
+	assert.Nil(t, e.SetPolicies([]Policy{
+		{Name: "whole", Limit: 100, Period: time.Minute},
+		{Name: "user", Path: "/user", Limit: 1, Period: time.Minute},
+	}))
+	ctx := context.Background()
+	res, _ := e.Allow(ctx, fakeRequest{route: "/user"})
+	assert.True(t, res.Allowed)
+	assert.Equal(t, "user", res.Policy)
+	res, _ = e.Allow(ctx, fakeRequest{route: "/user"})
+	assert.False(t, res.Allowed)
+	assert.Equal(t, "user", res.Policy)
+
+	//参数未变化的策略保留令牌
+	assert.Nil(t, e.SetPolicies([]Policy{
+		{Name: "whole", Limit: 200, Period: time.Minute},
+		{Name: "user", Path: "/user", Limit: 1, Period: time.Minute},
+	}))
+	res, _ = e.Allow(ctx, fakeRequest{route: "/user"})
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 2, len(e.Policies()))
+
+	e.RemovePolicy("user")
+	res, _ = e.Allow(ctx, fakeRequest{route: "/user"})
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(200), res.Limit)
+
+	assert.NotNil(t, e.AddPolicy(Policy{Name: "bad", Limit: 0}))
+	assert.NotNil(t, e.AddPolicy(Policy{Name: "bad", Limit: 1, KeyBy: []string{"cookie"}}))
+	assert.NotNil(t, e.SetPolicies([]Policy{{Name: "a", Limit: 1}, {Name: "a", Limit: 2}}))
+}
+
+func TestResult_Headers(t *testing.T) {
+	h := Result{Allowed: false, Limit: 10, Remaining: 0, Reset: 1500 * time.Millisecond, RetryAfter: 100 * time.Millisecond}.Headers()
+	assert.Equal(t, "10", h["X-RateLimit-Limit"])
+	assert.Equal(t, "0", h["X-RateLimit-Remaining"])
+	assert.Equal(t, "2", h["X-RateLimit-Reset"])
+	assert.Equal(t, "1", h["Retry-After"])
+
+	h = Result{Allowed: true, Limit: 10, Remaining: 9}.Headers()
+	_, ok := h["Retry-After"]
+	assert.False(t, ok)
+}
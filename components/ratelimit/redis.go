@@ -0,0 +1,254 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+
+	"github.com/jeevic/lego/components/log"
+	"github.com/jeevic/lego/components/redis"
+)
+
+//redis 分布式限流 多副本共享配额 发布不重置
+//lua 脚本原子执行 时间取 redis TIME 避免副本时钟偏差 单 key 兼容集群
+//redis 不可用时降级为单机令牌桶 RedisRetryInterval 后重试 redis
+//usage:
+//
+//	[[httpserver.ratelimit.policies]]
+//	name = "api_key"
+//	key_by = ["header:X-Api-Key"]
+//	limit = 100
+//	store = "redis"
+//	redis = "app"                    # redis 实例 默认 app
+//	algorithm = "sliding_window"     # token_bucket(默认) sliding_window
+
+//redis key 前缀
+var RedisKeyPrefix = "lego:ratelimit:"
+
+//redis 失败后降级时长
+var RedisRetryInterval = time.Second
+
+//redis 命令 UniversalClient 实现
+type RedisClient interface {
+	Eval(script string, keys []string, args ...interface{}) *goredis.Cmd
+	EvalSha(sha1 string, keys []string, args ...interface{}) *goredis.Cmd
+	ScriptExists(hashes ...string) *goredis.BoolSliceCmd
+	ScriptLoad(script string) *goredis.StringCmd
+}
+
+//令牌桶 hash 保存令牌数(千分之一) 更新时间(ms)
+//ARGV: rate(每秒令牌) burst ttl(ms)
+//返回: allowed tokens(千分之一)
+var tokenBucketScript = goredis.NewScript(`
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2]) * 1000
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local data = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1000 then
+	tokens = tokens - 1000
+	allowed = 1
+end
+tokens = math.floor(tokens)
+redis.call("HMSET", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return {allowed, tokens}
+`)
+
+//滑动窗口计数 上一窗口按剩余比例计入
+//ARGV: limit window(ms)
+//返回: allowed cur prev elapsed(ms)
+var slidingWindowScript = goredis.NewScript(`
+redis.replicate_commands()
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local idx = math.floor(now / window)
+local data = redis.call("HMGET", KEYS[1], "idx", "cur", "prev")
+local widx = tonumber(data[1]) or idx
+local cur = tonumber(data[2]) or 0
+local prev = tonumber(data[3]) or 0
+if idx == widx + 1 then
+	prev = cur
+	cur = 0
+elseif idx > widx + 1 then
+	prev = 0
+	cur = 0
+end
+local elapsed = now - idx * window
+local allowed = 0
+if prev * (window - elapsed) / window + cur + 1 <= limit then
+	cur = cur + 1
+	allowed = 1
+end
+redis.call("HMSET", KEYS[1], "idx", idx, "cur", cur, "prev", prev)
+redis.call("PEXPIRE", KEYS[1], window * 2)
+return {allowed, cur, prev, elapsed}
+`)
+
+type redisLimiter struct {
+	policy Policy
+	rate   float64
+	client func() (RedisClient, error)
+	//降级使用的单机令牌桶
+	local Limiter
+	//降级截止时间 unix nano
+	degradeUntil int64
+	degraded     int32
+}
+
+//redis 限流器 首次请求时获取 redis 实例
+func NewRedisLimiter(p Policy) Limiter {
+	instance := p.Redis
+	return newRedisLimiter(p, func() (RedisClient, error) {
+		r, err := redis.GetRedis(instance)
+		if err != nil {
+			return nil, err
+		}
+		return r.Client, nil
+	})
+}
+
+func newRedisLimiter(p Policy, client func() (RedisClient, error)) *redisLimiter {
+	if p.Period <= 0 {
+		p.Period = DefaultPeriod
+	}
+	if p.Burst <= 0 {
+		p.Burst = p.Limit
+	}
+	if len(p.Redis) == 0 {
+		p.Redis = DefaultRedisInstance
+	}
+	return &redisLimiter{
+		policy: p,
+		rate:   float64(p.Limit) / p.Period.Seconds(),
+		client: client,
+		local:  NewLocalLimiter(p),
+	}
+}
+
+func (l *redisLimiter) Allow(ctx context.Context, key string) Result {
+	if time.Now().UnixNano() < atomic.LoadInt64(&l.degradeUntil) {
+		return l.local.Allow(ctx, key)
+	}
+	res, err := l.allow(RedisKeyPrefix + l.policy.Name + ":" + key)
+	if err != nil {
+		atomic.StoreInt64(&l.degradeUntil, time.Now().Add(RedisRetryInterval).UnixNano())
+		if atomic.CompareAndSwapInt32(&l.degraded, 0, 1) {
+			log.FromContext(ctx).Warnf("[ratelimit] policy:%s redis:%s unavailable fallback to local error:%s", l.policy.Name, l.policy.Redis, err.Error())
+		}
+		return l.local.Allow(ctx, key)
+	}
+	if atomic.CompareAndSwapInt32(&l.degraded, 1, 0) {
+		log.FromContext(ctx).Infof("[ratelimit] policy:%s redis:%s recovered", l.policy.Name, l.policy.Redis)
+	}
+	return res
+}
+
+func (l *redisLimiter) allow(key string) (Result, error) {
+	client, err := l.client()
+	if err != nil {
+		return Result{}, err
+	}
+	if l.policy.Algorithm == AlgorithmSlidingWindow {
+		window := l.policy.Period.Milliseconds()
+		if window <= 0 {
+			window = 1
+		}
+		vals, err := runScript(client, slidingWindowScript, key, 4, l.policy.Limit, window)
+		if err != nil {
+			return Result{}, err
+		}
+		return slidingWindowResult(l.policy.Limit, l.policy.Period, vals[0] == 1, vals[1], vals[2], vals[3]), nil
+	}
+	//补满时间后过期
+	ttl := int64(math.Ceil(float64(l.policy.Burst)/l.rate*1000)) + 1000
+	//每毫秒补充的千分之一令牌数 即每秒令牌数
+	vals, err := runScript(client, tokenBucketScript, key, 2, strconv.FormatFloat(l.rate, 'f', -1, 64), l.policy.Burst, ttl)
+	if err != nil {
+		return Result{}, err
+	}
+	return l.tokenBucketResult(vals[0] == 1, float64(vals[1])/1000), nil
+}
+
+//执行脚本 返回整数数组
+func runScript(client RedisClient, script *goredis.Script, key string, n int, args ...interface{}) ([]int64, error) {
+	v, err := script.Run(client, []string{key}, args...).Result()
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) != n {
+		return nil, errors.New(fmt.Sprintf("ratelimit script unexpected result:%v", v))
+	}
+	vals := make([]int64, n)
+	for i, item := range arr {
+		if vals[i], ok = item.(int64); !ok {
+			return nil, errors.New(fmt.Sprintf("ratelimit script unexpected result:%v", v))
+		}
+	}
+	return vals, nil
+}
+
+func (l *redisLimiter) tokenBucketResult(allowed bool, tokens float64) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     l.policy.Limit,
+		Remaining: int64(tokens),
+		Reset:     time.Duration((float64(l.policy.Burst) - tokens) / l.rate * float64(time.Second)),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / l.rate * float64(time.Second))
+	}
+	return res
+}
+
+//按窗口计数计算剩余和重试时间
+func slidingWindowResult(limit int64, period time.Duration, allowed bool, cur, prev, elapsed int64) Result {
+	window := float64(period.Milliseconds())
+	if window <= 0 {
+		window = 1
+	}
+	left := window - float64(elapsed)
+	count := float64(prev)*left/window + float64(cur)
+	remaining := int64(float64(limit) - count)
+	if remaining < 0 {
+		remaining = 0
+	}
+	ms := func(v float64) time.Duration {
+		return time.Duration(v * float64(time.Millisecond))
+	}
+	//上一窗口计数衰减完 当前窗口结束
+	res := Result{Allowed: allowed, Limit: limit, Remaining: remaining, Reset: ms(left)}
+	if allowed {
+		return res
+	}
+	//当前窗口已满 等待窗口切换后 cur 作为 prev 衰减
+	if cur >= limit {
+		res.RetryAfter = ms(left + window*(1-float64(limit-1)/float64(cur)))
+	} else {
+		//prev 衰减到可容纳一次请求
+		wait := left - float64(limit-1-cur)*window/float64(prev)
+		if wait < 1 {
+			wait = 1
+		}
+		res.RetryAfter = ms(wait)
+	}
+	return res
+}
@@ -0,0 +1,189 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+//返回固定结果 EvalSha 未加载脚本时走 Eval
+type fakeRedis struct {
+	result interface{}
+	err    error
+	evals  int
+	keys   []string
+}
+
+func (f *fakeRedis) Eval(script string, keys []string, args ...interface{}) *goredis.Cmd {
+	f.evals++
+	f.keys = keys
+	return goredis.NewCmdResult(f.result, f.err)
+}
+
+func (f *fakeRedis) EvalSha(sha1 string, keys []string, args ...interface{}) *goredis.Cmd {
+	return goredis.NewCmdResult(nil, errors.New("NOSCRIPT No matching script"))
+}
+
+func (f *fakeRedis) ScriptExists(hashes ...string) *goredis.BoolSliceCmd {
+	return goredis.NewBoolSliceResult([]bool{false}, nil)
+}
+
+func (f *fakeRedis) ScriptLoad(script string) *goredis.StringCmd {
+	return goredis.NewStringResult("", nil)
+}
+
+func TestRedisLimiter_TokenBucket(t *testing.T) {
+	fr := &fakeRedis{result: []interface{}{int64(1), int64(4500)}}
+	p, _ := normalize(Policy{Name: "api", Limit: 10, Store: StoreRedis})
+	l := newRedisLimiter(p, func() (RedisClient, error) { return fr, nil })
+	ctx := context.Background()
+
+	res := l.Allow(ctx, "k1")
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(4), res.Remaining)
+	assert.Equal(t, int64(10), res.Limit)
+	assert.Equal(t, 550*time.Millisecond, res.Reset)
+	assert.Equal(t, 1, fr.evals)
+	assert.Equal(t, []string{RedisKeyPrefix + "api:k1"}, fr.keys)
+
+	fr.result = []interface{}{int64(0), int64(200)}
+	res = l.Allow(ctx, "k1")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 80*time.Millisecond, res.RetryAfter)
+}
+
+func TestRedisLimiter_SlidingWindow(t *testing.T) {
+	//当前窗口已满 窗口切换后上一窗口衰减
+	res := slidingWindowResult(10, time.Second, false, 10, 0, 400)
+	assert.Equal(t, int64(0), res.Remaining)
+	assert.Equal(t, 700*time.Millisecond, res.RetryAfter)
+	//上一窗口衰减到可容纳一次请求
+	res = slidingWindowResult(10, time.Second, false, 5, 10, 400)
+	assert.Equal(t, 200*time.Millisecond, res.RetryAfter)
+	res = slidingWindowResult(10, time.Second, true, 3, 10, 500)
+	assert.Equal(t, int64(2), res.Remaining)
+	assert.Equal(t, 500*time.Millisecond, res.Reset)
+
+	fr := &fakeRedis{result: []interface{}{int64(1), int64(1), int64(0), int64(0)}}
+	p, _ := normalize(Policy{Name: "sw", Limit: 10, Store: StoreRedis, Algorithm: AlgorithmSlidingWindow})
+	l := newRedisLimiter(p, func() (RedisClient, error) { return fr, nil })
+	res = l.Allow(context.Background(), "k")
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(9), res.Remaining)
+}
+
+func TestRedisLimiter_Fallback(t *testing.T) {
+	defer func(d time.Duration) { RedisRetryInterval = d }(RedisRetryInterval)
+	RedisRetryInterval = 50 * time.Millisecond
+
+	fr := &fakeRedis{err: errors.New("dial tcp: connection refused")}
+	p, _ := normalize(Policy{Name: "fb", Limit: 1, Period: time.Minute, Store: StoreRedis})
+	l := newRedisLimiter(p, func() (RedisClient, error) { return fr, nil })
+	ctx := context.Background()
+
+	//降级为单机令牌桶
+	assert.True(t, l.Allow(ctx, "k").Allowed)
+	assert.False(t, l.Allow(ctx, "k").Allowed)
+	assert.Equal(t, 1, fr.evals)
+	assert.Equal(t, int32(1), l.degraded)
+
+	//重试间隔后恢复 redis
+	time.Sleep(60 * time.Millisecond)
+	fr.err, fr.result = nil, []interface{}{int64(1), int64(0)}
+	assert.True(t, l.Allow(ctx, "k").Allowed)
+	assert.Equal(t, 2, fr.evals)
+	assert.Equal(t, int32(0), l.degraded)
+
+	//未注册的 redis 实例同样降级
+	p, _ = normalize(Policy{Name: "missing", Limit: 1, Store: StoreRedis, Redis: "not-exists"})
+	assert.True(t, NewLimiter(p).Allow(ctx, "k").Allowed)
+}
+
+//在 miniredis 中执行 lua 脚本 TIME 返回 SetTime 设置的时间
+func newMiniRedis(t *testing.T) (*miniredis.Miniredis, RedisClient) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Skip("miniredis unavailable:", err)
+	}
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+		mr.Close()
+	})
+	return mr, client
+}
+
+func TestRedisLimiter_TokenBucketScript(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	now := time.Unix(1700000000, 0)
+	mr.SetTime(now)
+	p, _ := normalize(Policy{Name: "tb", Limit: 2, Period: time.Second, Store: StoreRedis})
+	l := newRedisLimiter(p, func() (RedisClient, error) { return client, nil })
+	key := RedisKeyPrefix + "tb:k"
+
+	//key 不存在时 HMGET 返回 nil 按满桶处理
+	res, err := l.allow(key)
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(1), res.Remaining)
+	res, _ = l.allow(key)
+	assert.True(t, res.Allowed)
+	res, _ = l.allow(key)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+	assert.Equal(t, "0", mr.HGet(key, "tokens"))
+
+	//每秒 2 个令牌 250ms 补充半个令牌
+	mr.SetTime(now.Add(250 * time.Millisecond))
+	res, _ = l.allow(key)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, "500", mr.HGet(key, "tokens"))
+	mr.SetTime(now.Add(500 * time.Millisecond))
+	res, _ = l.allow(key)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+
+	//补满后不超过 burst
+	mr.SetTime(now.Add(10 * time.Second))
+	res, _ = l.allow(key)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(1), res.Remaining)
+}
+
+func TestRedisLimiter_SlidingWindowScript(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	now := time.Unix(1700000000, 0)
+	mr.SetTime(now)
+	p, _ := normalize(Policy{Name: "sw", Limit: 2, Period: time.Second, Store: StoreRedis, Algorithm: AlgorithmSlidingWindow})
+	l := newRedisLimiter(p, func() (RedisClient, error) { return client, nil })
+	key := RedisKeyPrefix + "sw:k"
+
+	res, err := l.allow(key)
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+	res, _ = l.allow(key)
+	assert.True(t, res.Allowed)
+	res, _ = l.allow(key)
+	assert.False(t, res.Allowed)
+
+	//进入下一窗口 上一窗口 2 次按剩余一半计入
+	mr.SetTime(now.Add(1500 * time.Millisecond))
+	res, _ = l.allow(key)
+	assert.True(t, res.Allowed)
+	res, _ = l.allow(key)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, "2", mr.HGet(key, "prev"))
+	assert.Equal(t, "1", mr.HGet(key, "cur"))
+
+	//跨过多个窗口 计数清零
+	mr.SetTime(now.Add(3 * time.Second))
+	res, _ = l.allow(key)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(1), res.Remaining)
+	assert.Equal(t, "0", mr.HGet(key, "prev"))
+}
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -67,6 +68,20 @@ func buildUniversalOptions(setting *Setting) *redis.UniversalOptions {
 	return options
 }
 
+//健康检查 ctx 结束时直接返回 未完成的 ping 由读写超时结束
+func (redis *Redis) Ping(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- redis.Client.Ping().Err()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (redis *Redis) Close() {
 	err := redis.Client.Close()
 	if err != nil {
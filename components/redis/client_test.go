@@ -1,8 +1,11 @@
 package redis
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestNewRedisUniversal(t *testing.T) {
@@ -26,3 +29,33 @@ func TestNewRedisUniversal(t *testing.T) {
 	result := redis.Client.Ping()
 	fmt.Println(result)
 }
+
+func TestPingContext(t *testing.T) {
+	//只接受连接不响应
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		for {
+			c, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	redis := NewRedisUniversal(&Setting{Hosts: []string{lis.Addr().String()}})
+	defer redis.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := redis.Ping(ctx); err != context.DeadlineExceeded {
+		t.Fatal("ping should return when ctx done, got", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("ping should not wait read timeout")
+	}
+}
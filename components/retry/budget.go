@@ -0,0 +1,71 @@
+package retry
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jeevic/lego/components/breakers/breaker"
+)
+
+//重试预算 限制重试占请求的比例 避免下游故障时重试放大流量
+//窗口内允许的重试数 = ratio * 请求数 + minPerSecond * 窗口秒数
+
+//预算统计窗口
+var BudgetWindow = 10 * time.Second
+
+const budgetBuckets = 10
+
+type Budget struct {
+	ratio        float64
+	minPerSecond int
+	window       time.Duration
+	requests     *breaker.RollingWindow
+	retries      *breaker.RollingWindow
+	mutex        sync.Mutex
+	exhausted    uint64
+}
+
+func NewBudget(ratio float64, minPerSecond int) *Budget {
+	if minPerSecond < 0 {
+		minPerSecond = 0
+	}
+	interval := BudgetWindow / budgetBuckets
+	return &Budget{
+		ratio:        ratio,
+		minPerSecond: minPerSecond,
+		window:       BudgetWindow,
+		requests:     breaker.NewRollingWindow(budgetBuckets, interval),
+		retries:      breaker.NewRollingWindow(budgetBuckets, interval),
+	}
+}
+
+func (b *Budget) request() {
+	b.requests.Add(1)
+}
+
+//获取一次重试 预算不足返回 false
+func (b *Budget) acquire() bool {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	allowed := b.ratio*float64(count(b.requests)) + float64(b.minPerSecond)*b.window.Seconds()
+	if float64(count(b.retries)) >= allowed {
+		atomic.AddUint64(&b.exhausted, 1)
+		return false
+	}
+	b.retries.Add(1)
+	return true
+}
+
+//预算不足放弃重试的次数
+func (b *Budget) Exhausted() uint64 {
+	return atomic.LoadUint64(&b.exhausted)
+}
+
+func count(rw *breaker.RollingWindow) int64 {
+	var n int64
+	rw.Reduce(func(b *breaker.Bucket) {
+		n += b.Count
+	})
+	return n
+}
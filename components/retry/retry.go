@@ -0,0 +1,205 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jeevic/lego/components/log"
+)
+
+//重试策略 指数退避加随机抖动 httplib grpcclient kafka pulsar 生产者共用
+//第 n 次重试前等待 min(initial_backoff * multiplier^(n-1), max_backoff) 上下浮动 jitter 比例
+//达到 max_attempts 超过 max_elapsed ctx 结束 错误不可重试 预算耗尽时返回最后一次的错误
+//usage:
+//
+//	[kafka.producer.app.retry]
+//	max_attempts = 3
+//	initial_backoff = "100ms"
+//	max_backoff = "2s"
+//	max_elapsed = "5s"
+//	budget_ratio = 0.1               # 重试数不超过请求数的 10% 0 不限制
+//
+//	p := retry.NewPolicy("user-api", setting)
+//	err := retry.Do(ctx, p, func(ctx context.Context) error {
+//		return call(ctx)
+//	})
+
+//重试配置
+type Setting struct {
+	//总尝试次数 包含首次 小于 0 不限制 由 max_elapsed 或 ctx 结束
+	MaxAttempts    int           `mapstructure:"max_attempts" default:"3"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff" default:"100ms"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff" default:"2s"`
+	Multiplier     float64       `mapstructure:"multiplier" default:"2"`
+	//退避时间随机浮动比例 [0,1]
+	Jitter float64 `mapstructure:"jitter" default:"0.2"`
+	//从首次请求开始的最长时间 0 不限制
+	MaxElapsed time.Duration `mapstructure:"max_elapsed"`
+	//重试预算 窗口内重试数不超过请求数的比例 0 不限制
+	BudgetRatio float64 `mapstructure:"budget_ratio"`
+	//预算的保底 每秒允许的重试数
+	BudgetMinPerSecond int `mapstructure:"budget_min_per_second" default:"10"`
+}
+
+//是否可以重试
+type Classifier func(err error) bool
+
+type Policy struct {
+	Setting
+	//用于日志
+	Name string
+	//为空时除 ctx 结束和 Permanent 外的错误都重试
+	Retryable Classifier
+	//为空不限制 多个请求共用
+	Budget *Budget
+}
+
+//按配置创建策略 配置了 budget_ratio 时创建预算
+func NewPolicy(name string, s Setting) Policy {
+	p := Policy{Setting: s, Name: name}
+	if s.BudgetRatio > 0 {
+		p.Budget = NewBudget(s.BudgetRatio, s.BudgetMinPerSecond)
+	}
+	return p
+}
+
+//默认配置
+func NewSetting() Setting {
+	return Setting{
+		MaxAttempts:        3,
+		InitialBackoff:     100 * time.Millisecond,
+		MaxBackoff:         2 * time.Second,
+		Multiplier:         2,
+		Jitter:             0.2,
+		BudgetMinPerSecond: 10,
+	}
+}
+
+//补全默认值
+func (p Policy) normalize() Policy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	}
+	if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+	return p
+}
+
+//第 retries 次重试前的等待时间 从 1 开始
+func (p Policy) Backoff(retries int) time.Duration {
+	p = p.normalize()
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retries-1))
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d = d * (1 - p.Jitter + 2*p.Jitter*randFloat())
+	}
+	return time.Duration(d)
+}
+
+var (
+	random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	mutex  sync.Mutex
+)
+
+func randFloat() float64 {
+	defer mutex.Unlock()
+	mutex.Lock()
+	return random.Float64()
+}
+
+//不可重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+//标记错误不可重试 Do 返回原始错误
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func (p Policy) retryable(err error) bool {
+	var pe *permanentError
+	if errors.As(err, &pe) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if p.Retryable == nil {
+		return true
+	}
+	return p.Retryable(err)
+}
+
+//执行 fn 失败时按策略重试 返回最后一次的错误
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error) error {
+	p = p.normalize()
+	if p.Budget != nil {
+		p.Budget.request()
+	}
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			if attempt > 1 {
+				log.FromContext(ctx).Infof("[retry] %s succeeded after attempt:%d", p.Name, attempt)
+			}
+			return nil
+		}
+		if !p.retryable(err) {
+			var pe *permanentError
+			if errors.As(err, &pe) {
+				return pe.err
+			}
+			return err
+		}
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			log.FromContext(ctx).Warnf("[retry] %s give up after attempt:%d error:%s", p.Name, attempt, err.Error())
+			return err
+		}
+		backoff := p.Backoff(attempt)
+		if p.MaxElapsed > 0 && time.Since(start)+backoff > p.MaxElapsed {
+			log.FromContext(ctx).Warnf("[retry] %s give up after attempt:%d elapsed:%s error:%s", p.Name, attempt, time.Since(start), err.Error())
+			return err
+		}
+		if p.Budget != nil && !p.Budget.acquire() {
+			log.FromContext(ctx).Warnf("[retry] %s budget exhausted after attempt:%d error:%s", p.Name, attempt, err.Error())
+			return err
+		}
+		log.FromContext(ctx).Warnf("[retry] %s attempt:%d failed retry after:%s error:%s", p.Name, attempt, backoff, err.Error())
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTest = errors.New("test error")
+
+func fastPolicy() Policy {
+	return Policy{Setting: Setting{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}}
+}
+
+func TestDo(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), fastPolicy(), func(ctx context.Context) error {
+		if calls++; calls < 3 {
+			return errTest
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = Do(context.Background(), fastPolicy(), func(ctx context.Context) error {
+		calls++
+		return errTest
+	})
+	assert.Equal(t, errTest, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestDo_Classifier(t *testing.T) {
+	p := fastPolicy()
+	p.Retryable = func(err error) bool { return err != errTest }
+	calls := 0
+	err := Do(context.Background(), p, func(ctx context.Context) error {
+		calls++
+		return errTest
+	})
+	assert.Equal(t, errTest, err)
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	err = Do(context.Background(), fastPolicy(), func(ctx context.Context) error {
+		calls++
+		return Permanent(errTest)
+	})
+	assert.Equal(t, errTest, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestDo_MaxElapsed(t *testing.T) {
+	p := Policy{Setting: Setting{MaxAttempts: -1, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond, MaxElapsed: 35 * time.Millisecond}}
+	calls := 0
+	start := time.Now()
+	err := Do(context.Background(), p, func(ctx context.Context) error {
+		calls++
+		return errTest
+	})
+	assert.Equal(t, errTest, err)
+	assert.True(t, calls >= 2 && calls <= 4, calls)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+}
+
+func TestDo_ContextDone(t *testing.T) {
+	p := Policy{Setting: Setting{MaxAttempts: -1, InitialBackoff: time.Second}}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := Do(ctx, p, func(ctx context.Context) error {
+		return errTest
+	})
+	assert.Equal(t, errTest, err)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+}
+
+func TestPolicy_Backoff(t *testing.T) {
+	p := Policy{Setting: Setting{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}}
+	assert.Equal(t, 100*time.Millisecond, p.Backoff(1))
+	assert.Equal(t, 400*time.Millisecond, p.Backoff(3))
+	assert.Equal(t, time.Second, p.Backoff(10))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.Backoff(2)
+		assert.True(t, d >= 100*time.Millisecond && d <= 300*time.Millisecond, d)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	p := fastPolicy()
+	p.Budget = NewBudget(0.5, 0)
+	retries := 0
+	for i := 0; i < 10; i++ {
+		_ = Do(context.Background(), p, func(ctx context.Context) error {
+			retries++
+			return errTest
+		})
+	}
+	//10 次请求最多 5 次重试
+	assert.Equal(t, 15, retries)
+	assert.True(t, p.Budget.Exhausted() > 0)
+}
+
+func TestNewPolicy(t *testing.T) {
+	p := NewPolicy("test", NewSetting())
+	assert.Nil(t, p.Budget)
+	s := NewSetting()
+	s.BudgetRatio = 0.1
+	p = NewPolicy("test", s)
+	assert.NotNil(t, p.Budget)
+	assert.Equal(t, "test", p.Name)
+}
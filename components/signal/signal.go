@@ -51,8 +51,8 @@ func (s *Signal) WatchAsync() chan struct{} {
 			var wg sync.WaitGroup
 			for _, f := range s.Callbacks {
 				f := f
+				wg.Add(1)
 				go func() {
-					wg.Add(1)
 					f(sig)
 					wg.Done()
 				}()
@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+//span 导出 otel sdk exporter 自定义 exporter(如 otlp) 可直接传入 SetExporter
+type Exporter = sdktrace.SpanExporter
+
+const (
+	ExporterLog    = "log"
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterJaeger = "jaeger"
+)
+
+//按名称创建 exporter none 返回 nil
+//jaeger endpoint 为 collector 地址 如 http://127.0.0.1:14268/api/traces
+func NewExporter(name string, endpoint string, logger *logrus.Logger) (Exporter, error) {
+	switch name {
+	case ExporterNone:
+		return nil, nil
+	case ExporterLog:
+		return NewLogExporter(logger), nil
+	case ExporterStdout:
+		return stdouttrace.New()
+	case ExporterJaeger:
+		if len(endpoint) == 0 {
+			return nil, errors.New("jaeger exporter endpoint is empty")
+		}
+		return jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(endpoint)))
+	}
+	return nil, errors.New(fmt.Sprintf("unknown tracing exporter: %s", name))
+}
+
+//日志导出 每个 span 一条 info 日志
+type LogExporter struct {
+	logger *logrus.Logger
+}
+
+func NewLogExporter(logger *logrus.Logger) *LogExporter {
+	return &LogExporter{logger: logger}
+}
+
+func (e *LogExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	for _, span := range spans {
+		attributes := make(map[string]string, len(span.Attributes()))
+		for _, kv := range span.Attributes() {
+			attributes[string(kv.Key)] = kv.Value.Emit()
+		}
+		fields := logrus.Fields{
+			"kind":       span.SpanKind().String(),
+			"trace_id":   span.SpanContext().TraceID().String(),
+			"span_id":    span.SpanContext().SpanID().String(),
+			"start":      span.StartTime(),
+			"duration":   span.EndTime().Sub(span.StartTime()).String(),
+			"attributes": attributes,
+		}
+		if service, ok := span.Resource().Set().Value(semconv.ServiceNameKey); ok {
+			fields["service"] = service.AsString()
+		}
+		if span.Parent().IsValid() {
+			fields["parent_id"] = span.Parent().SpanID().String()
+		}
+		if span.Status().Code == codes.Error {
+			fields["error"] = span.Status().Description
+		}
+		e.logger.WithFields(fields).Info("[trace] " + span.Name())
+	}
+	return nil
+}
+
+func (e *LogExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+//当前 trace 标识 用于绑定请求日志 无 trace 时返回空
+func LogFields(ctx context.Context) logrus.Fields {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return logrus.Fields{}
+	}
+	return logrus.Fields{"trace_id": sc.TraceID().String(), "span_id": sc.SpanID().String()}
+}
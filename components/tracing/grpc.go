@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/jeevic/lego/components/grpc/grpcserver"
+)
+
+//grpc unary 服务端 span
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := startServerSpan(ctx, info.FullMethod)
+		defer span.End()
+		resp, err := handler(ctx, req)
+		endRpc(span, err)
+		return resp, err
+	}
+}
+
+//grpc stream 服务端 span
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startServerSpan(stream.Context(), info.FullMethod)
+		defer span.End()
+		err := handler(srv, grpcserver.NewWrappedServerStream(stream, ctx))
+		endRpc(span, err)
+		return err
+	}
+}
+
+func startServerSpan(ctx context.Context, method string) (context.Context, *Span) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = Extract(ctx, MetadataCarrier(md))
+	}
+	ctx, span := Start(ctx, method, SpanKindServer)
+	span.SetAttribute("rpc.method", method)
+	return ctx, span
+}
+
+//grpc 客户端拦截器 用于 grpc.Dial
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(StreamClientInterceptor()),
+	}
+}
+
+//grpc unary 客户端 span 并写入 traceparent metadata
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := startClientSpan(ctx, method)
+		defer span.End()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		endRpc(span, err)
+		return err
+	}
+}
+
+//grpc stream 客户端 span 在流结束时结束
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := startClientSpan(ctx, method)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			endRpc(span, err)
+			span.End()
+			return nil, err
+		}
+		return &tracedClientStream{ClientStream: cs, span: span, serverStreams: desc.ServerStreams}, nil
+	}
+}
+
+func startClientSpan(ctx context.Context, method string) (context.Context, *Span) {
+	ctx, span := Start(ctx, method, SpanKindClient)
+	span.SetAttribute("rpc.method", method)
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	Inject(ctx, MetadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+func endRpc(span *Span, err error) {
+	span.SetAttribute("rpc.grpc.status_code", status.Code(err).String())
+	span.SetError(err)
+}
+
+type tracedClientStream struct {
+	grpc.ClientStream
+	span          *Span
+	serverStreams bool
+	once          sync.Once
+}
+
+func (s *tracedClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == io.EOF {
+		s.end(nil)
+	} else if err != nil {
+		s.end(err)
+	} else if !s.serverStreams {
+		//服务端非流式 收到响应即结束
+		s.end(nil)
+	}
+	return err
+}
+
+func (s *tracedClientStream) end(err error) {
+	s.once.Do(func() {
+		endRpc(s.span, err)
+		s.span.End()
+	})
+}
@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+//gin 服务端 span 读取上游 traceparent
+func HttpMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if len(route) == 0 {
+			route = "unmatched"
+		}
+		ctx := Extract(c.Request.Context(), HeaderCarrier(c.Request.Header))
+		ctx, span := Start(ctx, c.Request.Method+" "+route, SpanKindServer)
+		defer span.End()
+		span.SetAttribute("http.method", c.Request.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", c.Request.URL.Path)
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttribute("http.status_code", strconv.Itoa(status))
+		if len(c.Errors) > 0 {
+			span.SetError(c.Errors.Last())
+		} else if status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(status)))
+		}
+	}
+}
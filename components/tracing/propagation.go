@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+//W3C traceparent 头 version-traceid-spanid-flags
+const TraceparentHeader = "traceparent"
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+//W3C trace context 传递 traceparent tracestate
+var propagator = propagation.TraceContext{}
+
+//传递 traceparent 的载体 http header grpc metadata 消息头
+type Carrier = propagation.TextMapCarrier
+
+//http header
+type HeaderCarrier = propagation.HeaderCarrier
+
+//pulsar properties 等 map 结构
+type MapCarrier = propagation.MapCarrier
+
+//grpc metadata key 为小写
+type MetadataCarrier metadata.MD
+
+func (c MetadataCarrier) Get(key string) string {
+	if vals := metadata.MD(c).Get(key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func (c MetadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c MetadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+//格式化 traceparent
+func FormatTraceparent(sc SpanContext) string {
+	carrier := MapCarrier{}
+	propagator.Inject(trace.ContextWithSpanContext(context.Background(), sc), carrier)
+	return carrier[TraceparentHeader]
+}
+
+//解析 traceparent 未知版本按 00 格式解析前四段
+func ParseTraceparent(s string) (SpanContext, error) {
+	ctx := propagator.Extract(context.Background(), MapCarrier{TraceparentHeader: s})
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+//当前 span 标识写入载体
+func Inject(ctx context.Context, carrier Carrier) {
+	propagator.Inject(ctx, carrier)
+}
+
+//从载体读取上游标识 无效时返回原 ctx
+func Extract(ctx context.Context, carrier Carrier) context.Context {
+	return propagator.Extract(ctx, carrier)
+}
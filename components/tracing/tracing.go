@@ -0,0 +1,241 @@
+package tracing
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//链路追踪 基于 OpenTelemetry W3C trace context 传递
+//@see https://opentelemetry.io/docs/instrumentation/go/
+//
+//usage:
+//	tracing.SetExporter(tracing.NewLogExporter(logger))
+//	//gin
+//	engine.Use(tracing.HttpMiddleware())
+//	//grpc server
+//	grpcserver.WithAppendUnaryInterceptor(tracing.UnaryServerInterceptor())
+//	//业务内部 span
+//	ctx, span := tracing.Start(ctx, "query user", tracing.SpanKindInternal)
+//	defer span.End()
+//	//退出前刷新未导出的 span
+//	_ = tracing.Shutdown(ctx)
+
+const instrumentationName = "github.com/jeevic/lego/components/tracing"
+
+type SpanKind = trace.SpanKind
+
+const (
+	SpanKindInternal = trace.SpanKindInternal
+	SpanKindServer   = trace.SpanKindServer
+	SpanKindClient   = trace.SpanKindClient
+	SpanKindProducer = trace.SpanKindProducer
+	SpanKindConsumer = trace.SpanKindConsumer
+)
+
+//跨进程传递的 span 标识
+type SpanContext = trace.SpanContext
+
+//otel span 封装 nil span 的方法均为空操作
+type Span struct {
+	span trace.Span
+}
+
+//span 标识 nil span 返回空
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.span.SpanContext()
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+//记录错误事件 并将 span 状态设为 Error
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+//结束 span 重复调用只导出一次
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+//原始 otel span 用于设置事件 链接等
+func (s *Span) OtelSpan() trace.Span {
+	if s == nil {
+		return trace.SpanFromContext(context.Background())
+	}
+	return s.span
+}
+
+//全局 tracer 设置
+type provider struct {
+	mutex     sync.RWMutex
+	sdk       *sdktrace.TracerProvider
+	tracer    trace.Tracer
+	processor sdktrace.SpanProcessor
+	sampler   *ratioSampler
+	service   string
+}
+
+var tp = newProvider()
+
+func newProvider() *provider {
+	p := &provider{sampler: newRatioSampler(1)}
+	p.build()
+	return p
+}
+
+//按当前设置创建 sdk provider 服务名写入 resource 创建后不可修改 只能重建
+func (p *provider) build() *sdktrace.TracerProvider {
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithSampler(p.sampler)}
+	if len(p.service) > 0 {
+		opts = append(opts, sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(p.service))))
+	}
+	if p.processor != nil {
+		opts = append(opts, sdktrace.WithSpanProcessor(p.processor))
+	}
+	old := p.sdk
+	p.sdk = sdktrace.NewTracerProvider(opts...)
+	p.tracer = p.sdk.Tracer(instrumentationName)
+	return old
+}
+
+//注册为 otel 全局 provider 业务直接使用 otel api 时共用同一配置
+func (p *provider) register() {
+	otel.SetTracerProvider(p.sdk)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagator, propagation.Baggage{}))
+}
+
+func (p *provider) getTracer() trace.Tracer {
+	defer p.mutex.RUnlock()
+	p.mutex.RLock()
+	return p.tracer
+}
+
+//设置 exporter nil 时不导出 批量异步导出 旧 exporter 刷新后关闭
+func SetExporter(e sdktrace.SpanExporter) {
+	defer tp.mutex.Unlock()
+	tp.mutex.Lock()
+	if tp.processor != nil {
+		tp.sdk.UnregisterSpanProcessor(tp.processor)
+		tp.processor = nil
+	}
+	if e != nil {
+		tp.processor = sdktrace.NewBatchSpanProcessor(e)
+		tp.sdk.RegisterSpanProcessor(tp.processor)
+	}
+	tp.register()
+}
+
+//新 trace 的采样率 0-1 有上游时跟随上游采样标志
+func SetSampleRatio(ratio float64) {
+	tp.sampler.setRatio(ratio)
+	defer tp.mutex.Unlock()
+	tp.mutex.Lock()
+	tp.register()
+}
+
+//服务名称 写入导出数据的 resource 需在创建 span 前设置
+func SetServiceName(name string) {
+	defer tp.mutex.Unlock()
+	tp.mutex.Lock()
+	tp.service = name
+	//旧 provider 不关闭 processor 由新 provider 继续使用
+	tp.build()
+	tp.register()
+}
+
+//立即导出已结束的 span
+func ForceFlush(ctx context.Context) error {
+	defer tp.mutex.RUnlock()
+	tp.mutex.RLock()
+	return tp.sdk.ForceFlush(ctx)
+}
+
+//刷新并关闭 exporter 退出时调用 之后的 span 不再导出
+func Shutdown(ctx context.Context) error {
+	defer tp.mutex.Unlock()
+	tp.mutex.Lock()
+	tp.processor = nil
+	return tp.sdk.Shutdown(ctx)
+}
+
+//可调整采样率的 sampler 按 trace id 采样 同一 trace 在各服务结果一致
+type ratioSampler struct {
+	mutex   sync.RWMutex
+	sampler sdktrace.Sampler
+}
+
+func newRatioSampler(ratio float64) *ratioSampler {
+	s := &ratioSampler{}
+	s.setRatio(ratio)
+	return s
+}
+
+func (s *ratioSampler) setRatio(ratio float64) {
+	sampler := sdktrace.ParentBased(sdktrace.TraceIDRatioBased(math.Max(0, math.Min(1, ratio))))
+	defer s.mutex.Unlock()
+	s.mutex.Lock()
+	s.sampler = sampler
+}
+
+func (s *ratioSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	s.mutex.RLock()
+	sampler := s.sampler
+	s.mutex.RUnlock()
+	return sampler.ShouldSample(p)
+}
+
+func (s *ratioSampler) Description() string {
+	defer s.mutex.RUnlock()
+	s.mutex.RLock()
+	return s.sampler.Description()
+}
+
+//开启 span ctx 中已有 span 或上游标识时作为父 span
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	ctx, span := tp.getTracer().Start(ctx, name, trace.WithSpanKind(kind))
+	return ctx, &Span{span: span}
+}
+
+//获取 ctx 中当前 span 不存在返回 nil
+func SpanFromContext(ctx context.Context) *Span {
+	span := trace.SpanFromContext(ctx)
+	if !span.SpanContext().IsValid() {
+		return nil
+	}
+	return &Span{span: span}
+}
+
+//当前 span 标识 没有本地 span 时返回上游标识
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	return trace.SpanContextFromContext(ctx)
+}
+
+//设置上游 span 标识
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
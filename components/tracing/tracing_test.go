@@ -0,0 +1,183 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newTestExporter(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	SetExporter(exporter)
+	t.Cleanup(func() { SetExporter(nil) })
+	return exporter
+}
+
+//导出的 span 按结束顺序
+func exportedSpans(t *testing.T, exporter *tracetest.InMemoryExporter) tracetest.SpanStubs {
+	assert.Nil(t, ForceFlush(context.Background()))
+	return exporter.GetSpans()
+}
+
+func attr(span tracetest.SpanStub, key string) string {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value.AsString()
+		}
+	}
+	return ""
+}
+
+func TestTraceparent(t *testing.T) {
+	s := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(s)
+	assert.Nil(t, err)
+	assert.True(t, sc.IsSampled())
+	assert.True(t, sc.IsRemote())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	assert.Equal(t, s, FormatTraceparent(sc))
+
+	//未来版本允许附加字段
+	_, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	assert.Nil(t, err)
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+	} {
+		_, err = ParseTraceparent(invalid)
+		assert.Equal(t, ErrInvalidTraceparent, err, invalid)
+	}
+}
+
+func TestStartSampling(t *testing.T) {
+	exporter := newTestExporter(t)
+	SetSampleRatio(0)
+	defer SetSampleRatio(1)
+
+	//新 trace 不采样 但仍传递标识
+	ctx, root := Start(context.Background(), "root", SpanKindInternal)
+	assert.True(t, root.SpanContext().IsValid())
+	assert.False(t, root.SpanContext().IsSampled())
+	root.End()
+	assert.Len(t, exportedSpans(t, exporter), 0)
+
+	//上游已采样时跟随上游
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx = ContextWithRemoteSpanContext(context.Background(), sc)
+	ctx, span := Start(ctx, "child", SpanKindServer)
+	span.SetError(errors.New("fail"))
+	span.End()
+	span.End()
+
+	spans := exportedSpans(t, exporter)
+	assert.Len(t, spans, 1)
+	assert.Equal(t, sc.TraceID(), spans[0].SpanContext.TraceID())
+	assert.Equal(t, sc.SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, otelcodes.Error, spans[0].Status.Code)
+	assert.Equal(t, "fail", spans[0].Status.Description)
+	assert.Equal(t, span.SpanContext(), SpanFromContext(ctx).SpanContext())
+}
+
+func TestServiceName(t *testing.T) {
+	exporter := newTestExporter(t)
+	SetServiceName("user")
+	defer SetServiceName("")
+
+	_, span := Start(context.Background(), "query", SpanKindInternal)
+	span.End()
+
+	spans := exportedSpans(t, exporter)
+	assert.Len(t, spans, 1)
+	service, _ := spans[0].Resource.Set().Value(semconv.ServiceNameKey)
+	assert.Equal(t, "user", service.AsString())
+}
+
+func TestNewExporter(t *testing.T) {
+	e, err := NewExporter(ExporterNone, "", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, e)
+
+	_, err = NewExporter(ExporterJaeger, "", nil)
+	assert.NotNil(t, err)
+	e, err = NewExporter(ExporterJaeger, "http://127.0.0.1:14268/api/traces", nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, e)
+
+	_, err = NewExporter("zipkin", "", nil)
+	assert.NotNil(t, err)
+}
+
+func TestHttpMiddleware(t *testing.T) {
+	exporter := newTestExporter(t)
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(HttpMiddleware())
+	var got SpanContext
+	engine.GET("/user/:id", func(c *gin.Context) {
+		got = SpanContextFromContext(c.Request.Context())
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/user/1", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exportedSpans(t, exporter)
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "GET /user/:id", spans[0].Name)
+	assert.Equal(t, SpanKindServer, spans[0].SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+	assert.Equal(t, "500", attr(spans[0], "http.status_code"))
+	assert.Equal(t, "Internal Server Error", spans[0].Status.Description)
+	assert.Equal(t, spans[0].SpanContext.SpanID(), got.SpanID())
+}
+
+func TestGrpcInterceptors(t *testing.T) {
+	exporter := newTestExporter(t)
+
+	method := "/user.User/Get"
+	server := UnaryServerInterceptor()
+	//模拟网络传输 outgoing metadata 转为 incoming
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		ctx = metadata.NewIncomingContext(context.Background(), md)
+		_, err := server(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		})
+		return err
+	}
+
+	ctx, parent := Start(context.Background(), "caller", SpanKindInternal)
+	err := UnaryClientInterceptor()(ctx, method, nil, nil, nil, invoker)
+	parent.End()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	spans := exportedSpans(t, exporter)
+	assert.Len(t, spans, 3)
+	srv, cli, caller := spans[0], spans[1], spans[2]
+	assert.Equal(t, SpanKindServer, srv.SpanKind)
+	assert.Equal(t, SpanKindClient, cli.SpanKind)
+	assert.Equal(t, caller.SpanContext.TraceID(), srv.SpanContext.TraceID())
+	assert.Equal(t, caller.SpanContext.SpanID(), cli.Parent.SpanID())
+	assert.Equal(t, cli.SpanContext.SpanID(), srv.Parent.SpanID())
+	assert.Equal(t, "NotFound", attr(srv, "rpc.grpc.status_code"))
+}
@@ -1,6 +1,8 @@
 package zookeeper
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -47,6 +49,17 @@ func (zb *ZkBuilder) Restart() error {
 	return zb.Start()
 }
 
+//健康检查 连接已建立会话
+func (zb *ZkBuilder) Ping() error {
+	if zb.Conn == nil {
+		return errors.New("zookeeper conn not init")
+	}
+	if state := zb.Conn.State(); state != zk.StateHasSession {
+		return errors.New(fmt.Sprintf("zookeeper state:%s", state.String()))
+	}
+	return nil
+}
+
 //停止
 func (zb *ZkBuilder) Stop() {
 	zb.Conn.Close()
@@ -2,6 +2,7 @@ package app
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"sync"
 	"time"
@@ -28,6 +29,9 @@ const (
 var DefaultInstance = "app"
 var multiInstanceSign = "multi"
 
+//配置环境变量默认前缀 LEGO_HTTPSERVER_HTTP_PORT
+var DefaultEnvPrefix = "LEGO"
+
 //环境变量
 var envName2Num = map[string]uint8{
 	"develop": DEVELOP,
@@ -71,40 +75,34 @@ type Application struct {
 	Env uint8
 	//配置路径
 	CfgFile string
+	//配置环境变量前缀 为空不读取环境变量
+	EnvPrefix string
+	//配置命令行参数
+	CfgFlags *flag.FlagSet
 	//
 	RequestId string
 	//时区设置
 	TimeLocationCST *time.Location
-	//组件配置
-	Components *Components
+	//配置 - 核心级别
+	config *config.Config
+	//组件注册表
+	Registry *Registry
 
 	mutex *sync.Mutex
 }
 
-//支持的组件
-type Components struct {
-	//配置 - 核心级别
-	config struct {
-		handler *config.Config
-		enable  bool
-	}
-	//http server
-	httpserver struct {
-		handler *httpserver.HttpServer
-		enable  bool
-	}
-	//GrpcServer
-	grpcserver struct {
-		handler *grpcserver.GrpcServer
-		enable  bool
-	}
-}
+//内置组件名称
+const (
+	ComponentHttpServer = httpserver.ComponentName
+	ComponentGrpcServer = grpcserver.ComponentName
+)
 
 func init() {
 	Once.Do(func() {
 		App = &Application{
-			Components: &Components{},
-			mutex:      new(sync.Mutex),
+			EnvPrefix: DefaultEnvPrefix,
+			Registry:  NewRegistry(),
+			mutex:     new(sync.Mutex),
 		}
 	})
 }
@@ -179,6 +177,24 @@ func (a *Application) GetCfgFile() (string, error) {
 	return a.CfgFile, nil
 }
 
+//配置环境变量前缀
+func (a *Application) SetEnvPrefix(prefix string) {
+	a.EnvPrefix = prefix
+}
+
+func (a *Application) GetEnvPrefix() string {
+	return a.EnvPrefix
+}
+
+//配置命令行参数 需已 Parse 只有设置过的参数覆盖配置
+func (a *Application) SetCfgFlags(fs *flag.FlagSet) {
+	a.CfgFlags = fs
+}
+
+func (a *Application) GetCfgFlags() *flag.FlagSet {
+	return a.CfgFlags
+}
+
 func (a *Application) SetRequestId(reqid string) {
 	a.RequestId = reqid
 }
@@ -189,22 +205,19 @@ func (a *Application) GetRequestId() string {
 
 //config
 func (a *Application) SetConfig(cf *config.Config) {
-	a.Components.config = struct {
-		handler *config.Config
-		enable  bool
-	}{handler: cf, enable: true}
+	a.config = cf
 }
 
 func (a *Application) GetConfig() (cf *config.Config, err error) {
-	if a.Components.config.enable == false {
+	if a.config == nil {
 		return nil, errors.New("not init config")
 	}
-	return a.Components.config.handler, nil
+	return a.config, nil
 }
 
 func (a *Application) GetConfiger() *viper.Viper {
 	cfg, _ := a.GetConfig()
-	return cfg.Handler
+	return cfg.Viper()
 }
 
 func (a *Application) GetLog() (*log.Log, error) {
@@ -220,36 +233,53 @@ func (a *Application) GetLogger() *logrus.Logger {
 	return l.Logger
 }
 
+//注册组件
+func (a *Application) RegisterComponent(c Component) error {
+	return a.Registry.Register(c)
+}
+
+//获取组件
+func (a *Application) GetComponent(name string) (Component, error) {
+	return a.Registry.Get(name)
+}
+
 //httpserver
-func (a *Application) SetHttpServer(hs *httpserver.HttpServer) {
-	a.Components.httpserver = struct {
-		handler *httpserver.HttpServer
-		enable  bool
-	}{handler: hs, enable: true}
+//注册为组件 重复注册返回错误
+func (a *Application) SetHttpServer(hs *httpserver.HttpServer) error {
+	return a.RegisterComponent(hs)
 }
 
 func (a *Application) GetHttpServer() (*httpserver.HttpServer, error) {
-	if a.Components.httpserver.enable == false {
+	c, err := a.GetComponent(ComponentHttpServer)
+	if err != nil {
+		return nil, errors.New("not init httpserver")
+	}
+	hs, ok := c.(*httpserver.HttpServer)
+	if !ok {
 		return nil, errors.New("not init httpserver")
 	}
-	return a.Components.httpserver.handler, nil
+	return hs, nil
 }
 
 //grpc server
-func (a *Application) SetGrpcServer(gs *grpcserver.GrpcServer) {
-	a.Components.grpcserver = struct {
-		handler *grpcserver.GrpcServer
-		enable  bool
-	}{handler: gs, enable: true}
+//注册为组件 重复注册返回错误
+func (a *Application) SetGrpcServer(gs *grpcserver.GrpcServer) error {
+	return a.RegisterComponent(gs)
 }
 
 func (a *Application) GetGrpcServer() (*grpcserver.GrpcServer, error) {
-	if a.Components.grpcserver.enable == false {
+	c, err := a.GetComponent(ComponentGrpcServer)
+	if err != nil {
+		return nil, errors.New("not init grpc server")
+	}
+	gs, ok := c.(*grpcserver.GrpcServer)
+	if !ok {
 		return nil, errors.New("not init grpc server")
 	}
-	return a.Components.grpcserver.handler, nil
+	return gs, nil
 }
 
 func (a *Application) Close() {
-	a.Components = &Components{}
+	a.config = nil
+	a.Registry = NewRegistry()
 }
@@ -0,0 +1,246 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jeevic/lego/components/config"
+)
+
+//组件生命周期
+//usage:
+//	type Cache struct{}
+//	func (c *Cache) Name() string                   { return "cache" }
+//	func (c *Cache) DependsOn() []string            { return []string{"redis"} }
+//	func (c *Cache) Init(cfg *config.Config) error  { return nil }
+//	func (c *Cache) Start() error                   { return nil }
+//	func (c *Cache) Stop(ctx context.Context) error { return nil }
+//	func (c *Cache) Health() error                  { return nil }
+//
+//	_ = app.App.RegisterComponent(&Cache{})
+
+// Component 组件生命周期接口
+type Component interface {
+	// Name 组件唯一名称
+	Name() string
+	// Init 根据配置初始化
+	Init(cfg *config.Config) error
+	// Start 启动组件 不能阻塞
+	Start() error
+	// Stop 停止组件 ctx 超时后需尽快返回
+	Stop(ctx context.Context) error
+	// Health 健康检查 nil 表示健康
+	Health() error
+}
+
+// Dependent 声明组件依赖 依赖的组件先于自身启动 晚于自身停止
+type Dependent interface {
+	DependsOn() []string
+}
+
+var ErrComponentNotFound = errors.New("component not found")
+
+// Registry 组件注册表
+type Registry struct {
+	mutex      sync.Mutex
+	components map[string]Component
+	//注册顺序 无依赖关系时按照注册顺序启动
+	names []string
+	//已启动的组件 按启动顺序
+	started []Component
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		components: make(map[string]Component),
+		names:      make([]string, 0),
+		started:    make([]Component, 0),
+	}
+}
+
+// Register 注册组件 名称不能重复
+func (r *Registry) Register(c Component) error {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+
+	name := c.Name()
+	if len(name) == 0 {
+		return errors.New("component name can not be empty")
+	}
+	if _, ok := r.components[name]; ok {
+		return errors.New(fmt.Sprintf("component:%s has exists!", name))
+	}
+	r.components[name] = c
+	r.names = append(r.names, name)
+	return nil
+}
+
+// Get 获取组件
+func (r *Registry) Get(name string) (Component, error) {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+
+	if c, ok := r.components[name]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("component:%s %w", name, ErrComponentNotFound)
+}
+
+// Components 按依赖顺序返回组件
+func (r *Registry) Components() ([]Component, error) {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	return r.resolve()
+}
+
+// 拓扑排序 依赖缺失或者循环依赖返回错误
+func (r *Registry) resolve() ([]Component, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(r.names))
+	ordered := make([]Component, 0, len(r.names))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		c, ok := r.components[name]
+		if !ok {
+			return fmt.Errorf("component:%s required by %s %w", name, path[len(path)-1], ErrComponentNotFound)
+		}
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return errors.New(fmt.Sprintf("component circular dependency: %s -> %s", strings.Join(path, " -> "), name))
+		}
+		state[name] = visiting
+		if d, ok := c.(Dependent); ok {
+			next := make([]string, 0, len(path)+1)
+			next = append(append(next, path...), name)
+			for _, dep := range d.DependsOn() {
+				if err := visit(dep, next); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = visited
+		ordered = append(ordered, c)
+		return nil
+	}
+
+	for _, name := range r.names {
+		if err := visit(name, []string{}); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// InitAll 按依赖顺序初始化全部组件
+func (r *Registry) InitAll(cfg *config.Config) error {
+	components, err := r.Components()
+	if err != nil {
+		return err
+	}
+	for _, c := range components {
+		if err := c.Init(cfg); err != nil {
+			return fmt.Errorf("component:%s init error: %w", c.Name(), err)
+		}
+	}
+	return nil
+}
+
+// StartAll 按依赖顺序启动组件 失败时停止已启动的组件
+// Start Stop 在锁外执行 组件内可以调用 Get
+func (r *Registry) StartAll() error {
+	components, err := r.Components()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range components {
+		if r.isStarted(c) {
+			continue
+		}
+		if err := c.Start(); err != nil {
+			_ = r.StopAll(context.Background())
+			return fmt.Errorf("component:%s start error: %w", c.Name(), err)
+		}
+		r.mutex.Lock()
+		r.started = append(r.started, c)
+		r.mutex.Unlock()
+	}
+	return nil
+}
+
+// StopAll 按启动顺序逆序停止组件 返回第一个错误
+func (r *Registry) StopAll(ctx context.Context) error {
+	return r.stop(ctx, nil)
+}
+
+// Stop 停止指定名称的已启动组件 按启动顺序逆序
+func (r *Registry) Stop(ctx context.Context, names ...string) error {
+	filter := make(map[string]bool, len(names))
+	for _, name := range names {
+		filter[name] = true
+	}
+	return r.stop(ctx, filter)
+}
+
+// filter 为 nil 时停止全部
+func (r *Registry) stop(ctx context.Context, filter map[string]bool) error {
+	r.mutex.Lock()
+	stopping := make([]Component, 0, len(r.started))
+	remain := make([]Component, 0, len(r.started))
+	for _, c := range r.started {
+		if filter == nil || filter[c.Name()] {
+			stopping = append(stopping, c)
+		} else {
+			remain = append(remain, c)
+		}
+	}
+	r.started = remain
+	r.mutex.Unlock()
+
+	var first error
+	for i := len(stopping) - 1; i >= 0; i-- {
+		c := stopping[i]
+		if err := c.Stop(ctx); err != nil && first == nil {
+			first = fmt.Errorf("component:%s stop error: %w", c.Name(), err)
+		}
+	}
+	return first
+}
+
+func (r *Registry) isStarted(c Component) bool {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+
+	for _, s := range r.started {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Health 全部组件健康状态 key 为组件名称
+func (r *Registry) Health() map[string]error {
+	r.mutex.Lock()
+	components := make(map[string]Component, len(r.components))
+	for name, c := range r.components {
+		components[name] = c
+	}
+	r.mutex.Unlock()
+
+	res := make(map[string]error, len(components))
+	for name, c := range components {
+		res[name] = c.Health()
+	}
+	return res
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jeevic/lego/components/config"
+)
+
+type fakeComponent struct {
+	name     string
+	deps     []string
+	startErr error
+	events   *[]string
+}
+
+func (f *fakeComponent) Name() string                  { return f.name }
+func (f *fakeComponent) DependsOn() []string           { return f.deps }
+func (f *fakeComponent) Init(cfg *config.Config) error { return nil }
+func (f *fakeComponent) Health() error                 { return nil }
+
+func (f *fakeComponent) Start() error {
+	if f.startErr != nil {
+		return f.startErr
+	}
+	*f.events = append(*f.events, "start:"+f.name)
+	return nil
+}
+
+func (f *fakeComponent) Stop(ctx context.Context) error {
+	*f.events = append(*f.events, "stop:"+f.name)
+	return nil
+}
+
+func TestRegistry_StartStopOrder(t *testing.T) {
+	events := make([]string, 0)
+	r := NewRegistry()
+	assert.Nil(t, r.Register(&fakeComponent{name: "cache", deps: []string{"redis"}, events: &events}))
+	assert.Nil(t, r.Register(&fakeComponent{name: "redis", events: &events}))
+	assert.Nil(t, r.Register(&fakeComponent{name: "httpserver", deps: []string{"cache"}, events: &events}))
+
+	assert.Nil(t, r.StartAll())
+	assert.Nil(t, r.StopAll(context.Background()))
+	assert.Equal(t, []string{
+		"start:redis", "start:cache", "start:httpserver",
+		"stop:httpserver", "stop:cache", "stop:redis",
+	}, events)
+}
+
+func TestRegistry_Duplicate(t *testing.T) {
+	events := make([]string, 0)
+	r := NewRegistry()
+	assert.Nil(t, r.Register(&fakeComponent{name: "redis", events: &events}))
+	assert.NotNil(t, r.Register(&fakeComponent{name: "redis", events: &events}))
+}
+
+func TestRegistry_MissingDependency(t *testing.T) {
+	events := make([]string, 0)
+	r := NewRegistry()
+	assert.Nil(t, r.Register(&fakeComponent{name: "cache", deps: []string{"redis"}, events: &events}))
+	_, err := r.Components()
+	assert.True(t, errors.Is(err, ErrComponentNotFound))
+}
+
+func TestRegistry_CircularDependency(t *testing.T) {
+	events := make([]string, 0)
+	r := NewRegistry()
+	assert.Nil(t, r.Register(&fakeComponent{name: "a", deps: []string{"b"}, events: &events}))
+	assert.Nil(t, r.Register(&fakeComponent{name: "b", deps: []string{"a"}, events: &events}))
+	assert.NotNil(t, r.StartAll())
+	assert.Equal(t, 0, len(events))
+}
+
+func TestRegistry_StartFailStopsStarted(t *testing.T) {
+	events := make([]string, 0)
+	r := NewRegistry()
+	assert.Nil(t, r.Register(&fakeComponent{name: "redis", events: &events}))
+	assert.Nil(t, r.Register(&fakeComponent{name: "cache", deps: []string{"redis"}, startErr: errors.New("boom"), events: &events}))
+
+	assert.NotNil(t, r.StartAll())
+	assert.Equal(t, []string{"start:redis", "stop:redis"}, events)
+}
+
+//Start Stop 中获取其他组件不能死锁
+type lookupComponent struct {
+	fakeComponent
+	registry *Registry
+}
+
+func (l *lookupComponent) Start() error {
+	_, err := l.registry.Get("redis")
+	return err
+}
+
+func (l *lookupComponent) Stop(ctx context.Context) error {
+	_, err := l.registry.Get("redis")
+	return err
+}
+
+func TestRegistry_GetInStartStop(t *testing.T) {
+	events := make([]string, 0)
+	r := NewRegistry()
+	assert.Nil(t, r.Register(&fakeComponent{name: "redis", events: &events}))
+	assert.Nil(t, r.Register(&lookupComponent{fakeComponent: fakeComponent{name: "cache", deps: []string{"redis"}}, registry: r}))
+
+	done := make(chan struct{})
+	go func() {
+		assert.Nil(t, r.StartAll())
+		assert.Nil(t, r.StopAll(context.Background()))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("registry deadlock")
+	}
+}
+
+func TestRegistry_Stop(t *testing.T) {
+	events := make([]string, 0)
+	r := NewRegistry()
+	assert.Nil(t, r.Register(&fakeComponent{name: "redis", events: &events}))
+	assert.Nil(t, r.Register(&fakeComponent{name: "httpserver", events: &events}))
+
+	assert.Nil(t, r.StartAll())
+	assert.Nil(t, r.Stop(context.Background(), "httpserver"))
+	assert.Nil(t, r.StopAll(context.Background()))
+	assert.Equal(t, []string{"start:redis", "start:httpserver", "stop:httpserver", "stop:redis"}, events)
+}
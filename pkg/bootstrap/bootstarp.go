@@ -1,20 +1,29 @@
 package bootstrap
 
-import "github.com/jeevic/lego/pkg/app"
+import (
+	"os"
+
+	"github.com/jeevic/lego/components/graceful"
+	"github.com/jeevic/lego/components/health"
+	"github.com/jeevic/lego/pkg/app"
+)
 
 var StopChan = make(chan struct{})
 
 func Start() {
-	//启动httpserver
-	hs, _ := app.App.GetHttpServer()
-	if hs != nil {
-		hs.ServerRunAsync()
+	//按依赖顺序启动组件 httpserver grpc server 以及注册的第三方组件
+	if err := app.App.Registry.StartAll(); err != nil {
+		app.App.GetLogger().Errorf("[start] app start components error:%s", err.Error())
+		//平滑重启的子进程启动失败直接退出 父进程继续服务
+		if graceful.IsChild() {
+			os.Exit(1)
+		}
+		return
 	}
-
-	//grpc server
-	gs, _ := app.App.GetGrpcServer()
-	if gs != nil {
-		gs.RunAsync()
+	health.SetServing(true)
+	//通知父进程开始退出
+	if err := graceful.Ready(); err != nil {
+		app.App.GetLogger().Errorf("[start] notify parent ready error:%s", err.Error())
 	}
 }
 
@@ -27,9 +36,31 @@ func Stop(stop bool) {
 
 }
 
+// 平滑重启 fork 新进程并传递 http grpc metrics 监听 fd
+// 新进程启动完成通知就绪后 当前进程处理完存量请求退出 新进程失败时当前进程继续服务
 func Restart() {
-	Stop(false)
-	Start()
+	pid, err := graceful.Fork()
+	if err != nil {
+		app.App.GetLogger().Errorf("[restart] fork new process error:%s, keep serving", err.Error())
+		return
+	}
+	app.App.GetLogger().Infof("[restart] new process pid:%d ready, old process start drain", pid)
+	//新进程已在共用监听上就绪 不切换就绪状态 避免探针在新旧进程间交替失败
+	shutdown(false)
+	StopChan <- struct{}{}
+}
+
+// 重新加载配置 SIGUSR2 触发 通知配置变更订阅者
+func Reload() {
+	cf, err := app.App.GetConfig()
+	if err != nil {
+		return
+	}
+	if err := cf.Reload(); err != nil {
+		app.App.GetLogger().Errorf("[reload] %s", err.Error())
+		return
+	}
+	app.App.GetLogger().Info("[reload] config reload complete!")
 }
 
 func Run() {
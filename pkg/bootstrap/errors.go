@@ -0,0 +1,35 @@
+package bootstrap
+
+import "fmt"
+
+// InitError 初始化失败 标识失败阶段和对应的配置项
+// usage:
+//	if err := bootstrap.Init(); err != nil {
+//		var ie *bootstrap.InitError
+//		if errors.As(err, &ie) {
+//			fmt.Println(ie.Stage, ie.Key)
+//		}
+//		os.Exit(1)
+//	}
+type InitError struct {
+	//初始化阶段 如 config log grpcserver
+	Stage string
+	//出错的配置项 可能为空
+	Key string
+	Err error
+}
+
+func newInitError(stage string, key string, err error) *InitError {
+	return &InitError{Stage: stage, Key: key, Err: err}
+}
+
+func (e *InitError) Error() string {
+	if len(e.Key) > 0 {
+		return fmt.Sprintf("[init] %s error key:%s err:%v", e.Stage, e.Key, e.Err)
+	}
+	return fmt.Sprintf("[init] %s error err:%v", e.Stage, e.Err)
+}
+
+func (e *InitError) Unwrap() error {
+	return e.Err
+}
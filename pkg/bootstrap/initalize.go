@@ -1,51 +1,76 @@
 package bootstrap
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc/credentials"
 
+	"github.com/jeevic/lego/components/breakers"
 	"github.com/jeevic/lego/components/config"
 	"github.com/jeevic/lego/components/grpc/grpcserver"
 	grpc_ratelimiter "github.com/jeevic/lego/components/grpc/grpcserver/grpc-ratelimiter"
 	"github.com/jeevic/lego/components/grpc/grpcserver/interceptor"
+	"github.com/jeevic/lego/components/health"
 	"github.com/jeevic/lego/components/httpserver"
 	"github.com/jeevic/lego/components/httpserver/middleware"
 	"github.com/jeevic/lego/components/httpserver/ratelimiter"
+	kafkaProducer "github.com/jeevic/lego/components/kafka/producer"
 	"github.com/jeevic/lego/components/log"
+	"github.com/jeevic/lego/components/metrics"
 	"github.com/jeevic/lego/components/pprof"
+	"github.com/jeevic/lego/components/ratelimit"
 	sig "github.com/jeevic/lego/components/signal"
 	"github.com/jeevic/lego/components/swagger"
+	"github.com/jeevic/lego/components/tracing"
 	"github.com/jeevic/lego/pkg/app"
 	"github.com/jeevic/lego/util"
 )
 
-var initFunc = []func(){
+var initFunc = []func() error{
 	InitConfig,
 	InitLog,
 	InitApp,
 	InitPid,
+	InitTracing,
 	InitHttpServer,
 	InitGrpcServer,
+	InitMetrics,
 	InitSwagger,
+	InitRedis,
+	InitMongo,
+	InitKafka,
+	InitPulsar,
+	InitZookeeper,
+	InitCrontab,
+	InitBreakers,
 }
 
 // 初始化函数
 func Init() error {
 	t1 := time.Now()
+	//遇到第一个错误停止
 	for _, f := range initFunc {
-		f()
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	//初始化注册的组件
+	cf, _ := app.App.GetConfig()
+	if err := app.App.Registry.InitAll(cf); err != nil {
+		return newInitError("component", "", err)
 	}
 	//注册信号函数
 	sig.WatchSignal(func() {
 		Stop(true)
-	}, nil, nil)
+	}, Restart, Reload)
 
 	cost := time.Since(t1)
 	app.App.GetLogger().Info("app init complete! time timeline:", cost)
@@ -53,10 +78,15 @@ func Init() error {
 }
 
 // 注册初始化函数
-func RegisterInit(f func()) {
+func RegisterInit(f func() error) {
 	initFunc = append(initFunc, f)
 }
 
+// 注册组件 加入统一的生命周期管理
+func RegisterComponent(c app.Component) error {
+	return app.App.RegisterComponent(c)
+}
+
 // 注册http route
 func RegisterHttpRoutes(f func(engine *gin.Engine)) error {
 	hs, _ := app.App.GetHttpServer()
@@ -73,77 +103,120 @@ func RegisterSignalFunc(f sig.CallbackSignal) {
 }
 
 // 初始化配置
-func InitConfig() {
+func InitConfig() error {
 	cfg, err := app.App.GetCfgFile()
 	if err != nil {
-		panic(err.Error())
+		return newInitError("config", "", err)
 	}
 
-	c, err := config.NewConfig(cfg)
+	//分层加载 基础文件 环境文件 环境变量 命令行参数
+	c, err := config.NewConfig(cfg,
+		config.WithEnv(app.App.GetEnvName()),
+		config.WithEnvPrefix(app.App.GetEnvPrefix()),
+		config.WithFlags(app.App.GetCfgFlags()),
+	)
 	if err != nil {
-		panic(fmt.Sprintf("[init] config error:%s", err.Error()))
+		return newInitError("config", "", err)
 	}
 	//这是自动热加载文件
 	c.WatchReConfig()
 	app.App.SetConfig(c)
+	return nil
 }
 
 // 初始化日志 -- 核心加载
 // TODO 是否可以改成懒加载
-func InitLog() {
+func InitLog() error {
 	cfg := app.App.GetConfiger()
-	//多实例
-	if cfg.IsSet("log.type") && app.IsMultiInstance(cfg.GetString("log.type")) {
-		instances := cfg.GetStringMap("log.instance")
-		for instance := range instances {
-			prefix := "log.instance." + instance + "."
-			setting := log.Setting{
-				Path:            cfg.GetString(prefix + "path"),
-				FileName:        cfg.GetString(prefix + "filename"),
-				ErrFileName:     cfg.GetString(prefix + "errfilename"),
-				Level:           cfg.GetString(prefix + "level"),
-				Format:          cfg.GetString(prefix + "format"),
-				Split:           cfg.GetString(prefix + "split"),
-				LifeTime:        cfg.GetDuration(prefix + "lifetime"),
-				Rotation:        cfg.GetDuration(prefix + "rotation"),
-				ReportCaller:    true,
-				ReportHostIp:    true,
-				ReportShortFile: true,
-			}
-			err := log.Register(instance, setting)
-			if err != nil {
-				panic(fmt.Sprintf("[init] log instance: %s error:%s", instance, err.Error()))
-			}
-		}
-	} else {
+	//支持多实例
+	err := eachInstance("log", func(instance string, prefix string) error {
 		setting := log.Setting{
-			Path:            cfg.GetString("log.path"),
-			FileName:        cfg.GetString("log.filename"),
-			ErrFileName:     cfg.GetString("log.errfilename"),
-			Level:           cfg.GetString("log.level"),
-			Format:          cfg.GetString("log.format"),
-			Split:           cfg.GetString("log.split"),
-			LifeTime:        cfg.GetDuration("log.lifetime"),
-			Rotation:        cfg.GetDuration("log.rotation"),
+			Path:            cfg.GetString(prefix + "path"),
+			FileName:        cfg.GetString(prefix + "filename"),
+			ErrFileName:     cfg.GetString(prefix + "errfilename"),
+			Level:           cfg.GetString(prefix + "level"),
+			Format:          cfg.GetString(prefix + "format"),
+			Split:           cfg.GetString(prefix + "split"),
+			LifeTime:        cfg.GetDuration(prefix + "lifetime"),
+			Rotation:        cfg.GetDuration(prefix + "rotation"),
 			ReportCaller:    true,
 			ReportHostIp:    true,
 			ReportShortFile: true,
+			Backend:         cfg.GetString(prefix + "backend"),
+			Console:         cfg.GetBool(prefix + "console"),
+			MaxSize:         cfg.GetInt(prefix + "max_size"),
+			MaxBackups:      cfg.GetInt(prefix + "max_backups"),
+			Compress:        cfg.GetBool(prefix + "compress"),
+			//异步写
+			Async:              cfg.GetBool(prefix + "async"),
+			AsyncBuffer:        cfg.GetInt(prefix + "async_buffer"),
+			AsyncFlushInterval: cfg.GetDuration(prefix + "async_flush_interval"),
+			AsyncBlock:         cfg.GetBool(prefix + "async_block"),
 		}
-		err := log.Register(app.DefaultInstance, setting)
-		if err != nil {
-			panic(fmt.Sprintf("[init] log error:%s", err.Error()))
+		//多实例未单独配置时使用 log.backend
+		if len(setting.Backend) == 0 {
+			setting.Backend = cfg.GetString("log.backend")
 		}
+		if err := log.Register(instance, setting); err != nil {
+			return newInitError("log", strings.TrimSuffix(prefix, "."), err)
+		}
+		if err := initLogSinks(instance, prefix); err != nil {
+			return err
+		}
+		watchLogLevel(instance, prefix)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := app.App.GetLog(); err != nil {
+		return newInitError("log", "log.instance."+app.DefaultInstance, err)
 	}
 	app.App.GetLogger().Info("[init] log component complete !")
+	return nil
+}
+
+//远程日志输出 配置 log.sinks.<name>
+//kafka sink 首次写入时按生产者实例配置建立独立连接 生产者注销后仍可刷新日志
+func initLogSinks(instance string, prefix string) error {
+	cf, _ := app.App.GetConfig()
+	lg, err := log.GetLog(instance)
+	if err != nil {
+		return newInitError("log", strings.TrimSuffix(prefix, "."), err)
+	}
+	for name := range cf.Viper().GetStringMap(prefix + "sinks") {
+		key := prefix + "sinks." + name
+		var setting log.SinkSetting
+		if err := cf.Bind(key, &setting); err != nil {
+			return newInitError("log", key, err)
+		}
+		var sink *log.Sink
+		if setting.Type == log.SinkKafka {
+			sink = log.NewSinkWriter(name, setting, kafkaProducer.NewLogWriter(setting.Producer, setting.Topic))
+		} else if sink, err = log.NewSink(name, setting); err != nil {
+			return newInitError("log", key, err)
+		}
+		lg.AddSink(sink)
+	}
+	return nil
 }
 
 // 初始化app
-func InitApp() {
+func InitApp() error {
 	cfg := app.App.GetConfiger()
 	name := cfg.GetString("app.name")
 	app.App.SetName(name)
 	app.App.GetLogger().Infof("[init] app name: %s !", name)
 
+	//输出非基础文件提供的配置项
+	if cf, err := app.App.GetConfig(); err == nil {
+		for key, layer := range cf.Sources() {
+			if layer != config.LayerBase {
+				app.App.GetLogger().Infof("[init] config key:%s layer:%s", key, layer)
+			}
+		}
+	}
+
 	//设置时区
 	if cfg.IsSet("app.time_zone") {
 		err := app.App.SetTimeLocation(cfg.GetString("app.time_zone"))
@@ -157,51 +230,72 @@ func InitApp() {
 		app.App.SetRequestId(cfg.GetString("app.request_id"))
 	}
 
+	if cfg.IsSet("app.shutdown_drain") {
+		ShutdownDrain = cfg.GetDuration("app.shutdown_drain")
+	}
+
 	app.App.GetLogger().Info("[init] app init complete !")
+	return nil
 }
 
 // pid设置
-func InitPid() {
+func InitPid() error {
 	pid := os.Getpid()
 	pidfile := app.App.GetConfiger().GetString("app.pidfile")
 	if len(pidfile) < 1 {
 		app.App.GetLogger().Infof("[init] not need init pid file")
-		return
+		return nil
 	}
 	//判断当前pid 是否存储
 	file, err := os.OpenFile(pidfile, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
 		app.App.GetLogger().Warnf("[init] create pid file error:%s", err.Error())
-		return
+		return nil
 	}
 	_, _ = file.WriteString(strconv.Itoa(pid))
 	_ = file.Close()
 
 	app.App.GetLogger().Infof("[init] create pid file pid:%d", pid)
+	return nil
 }
 
-func InitSwagger() {
+func InitSwagger() error {
 	cfg := app.App.GetConfiger()
 	enable := cfg.GetBool("swagger.enable")
 	if enable {
 		server, err := app.App.GetHttpServer()
-		if err != nil && server != nil {
-			swagger.InitSwagger(server.Engine)
-			app.App.GetLogger().Infof("[init] swagger component complete!")
+		if err != nil {
+			return newInitError("swagger", "swagger.enable", err)
 		}
+		swagger.InitSwagger(server.Engine)
+		app.App.GetLogger().Infof("[init] swagger component complete!")
 	}
+	return nil
+}
+
+// http server 配置
+type httpServerSetting struct {
+	Host        string   `mapstructure:"http_host" valid:"Required"`
+	Port        int      `mapstructure:"http_port" valid:"Range(0,65535)"`
+	EnableHttps bool     `mapstructure:"enable_https"`
+	Middleware  []string `mapstructure:"middleware"`
+	//注册 /healthz /readyz
+	Health bool `mapstructure:"health" default:"true"`
+	//自适应并发限制 过载返回 503
+	Adaptive ratelimit.AdaptiveSetting `mapstructure:"adaptive"`
 }
 
 // 初始化server
-func InitHttpServer() {
-	cfg := app.App.GetConfiger()
-	if !cfg.IsSet("httpserver.http_host") {
-		return
+func InitHttpServer() error {
+	cf, _ := app.App.GetConfig()
+	if !cf.Viper().IsSet("httpserver.http_host") {
+		return nil
+	}
+	var setting httpServerSetting
+	if err := cf.Bind("httpserver", &setting); err != nil {
+		return newInitError("httpserver", "httpserver", err)
 	}
-	host := cfg.GetString("httpserver.http_host")
-	port := cfg.GetInt("httpserver.http_port")
-	isHttps := cfg.GetBool("httpserver.enable_https")
-	middlewares := cfg.GetStringSlice("httpserver.middleware")
+	middlewares := setting.Middleware
 
 	//日志输出, 测试环境 双写
 	l, _ := app.App.GetLog()
@@ -213,7 +307,13 @@ func InitHttpServer() {
 	gin.DefaultErrorWriter = outWriter
 	gin.DefaultWriter = outWriter
 
-	hs := httpserver.NewHttpServer(host, port, isHttps)
+	hs := httpserver.NewHttpServer(setting.Host, setting.Port, setting.EnableHttps)
+	//链路追踪 最先注册 覆盖其他中间件耗时
+	if ts, err := getTracingSetting(); err != nil {
+		return err
+	} else if ts.Enable {
+		hs.SetMiddleware(tracing.HttpMiddleware())
+	}
 
 	//非测试环境 打开
 	if !app.App.IsDevelop() {
@@ -237,79 +337,106 @@ func InitHttpServer() {
 			}
 		}
 	}
+	//指标统计 在限流之前 被拒绝的请求也计入 未配置独立端口时挂载到 http server
+	if ms, err := getMetricsSetting(); err != nil {
+		return err
+	} else if ms.Enable {
+		path := ms.Path
+		if len(ms.Addr) > 0 {
+			path = ""
+		}
+		metrics.UseHttpMetrics(hs.Engine, path)
+	}
+	//探针路由在限流之前注册 不经过限流中间件 避免过载时被判定不健康
+	if setting.Health {
+		health.UseHttpHealth(hs.Engine)
+	}
+	//过载保护 在限流之前拒绝
+	if setting.Adaptive.Enable {
+		al := ratelimit.NewAdaptiveLimiter(setting.Adaptive)
+		metrics.RegisterAdaptive("http", al)
+		hs.SetMiddleware(ratelimiter.AdaptiveMiddleware(al))
+	}
 	//设置限速模块
+	if err := initHttpRateLimit(); err != nil {
+		return err
+	}
 	hs.SetMiddleware(ratelimiter.RateLimitMiddleware())
-	app.App.SetHttpServer(hs)
+	health.RegisterLiveness(app.ComponentHttpServer, func(ctx context.Context) error {
+		return hs.Health()
+	})
+	if err := app.App.SetHttpServer(hs); err != nil {
+		return err
+	}
 	app.App.GetLogger().Info("[init] http server complete!")
+	return nil
+}
+
+// grpc server 配置
+type grpcServerSetting struct {
+	Host        string   `mapstructure:"grpc_host"`
+	Port        int      `mapstructure:"grpc_port" valid:"Range(0,65535)"`
+	UnixDomain  string   `mapstructure:"grpc_unix_domain"`
+	Interceptor []string `mapstructure:"interceptor"`
+	//注册 grpc.health.v1.Health
+	Health bool `mapstructure:"health" default:"true"`
+	//自适应并发限制 过载返回 ResourceExhausted
+	Adaptive ratelimit.AdaptiveSetting `mapstructure:"adaptive"`
+	//keepalive 时间支持 "30s" 写法 数字按秒
+	Keepalive struct {
+		EnforcementPolicyMinTime             time.Duration `mapstructure:"enforcement_policy_mintime"`
+		EnforcementPolicyPermitWithoutStream bool          `mapstructure:"enforcement_policy_permit_without_stream" default:"true"`
+		MaxConnectionIdle                    time.Duration `mapstructure:"max_connection_idle"`
+		MaxConnectionAge                     time.Duration `mapstructure:"max_connection_age"`
+		MaxConnectionAgeGrace                time.Duration `mapstructure:"max_connection_age_grace"`
+		Time                                 time.Duration `mapstructure:"time"`
+		Timeout                              time.Duration `mapstructure:"timeout"`
+	} `mapstructure:"keepalive"`
+	Credentials struct {
+		ServerCert string `mapstructure:"server_cert"`
+		ServerKey  string `mapstructure:"server_key"`
+	} `mapstructure:"credentials"`
 }
 
 // grpc server
-func InitGrpcServer() {
-	cfg := app.App.GetConfiger()
-	if !cfg.IsSet("grpcserver.grpc_host") {
-		return
+func InitGrpcServer() error {
+	cf, _ := app.App.GetConfig()
+	if !cf.Viper().IsSet("grpcserver.grpc_host") && !cf.Viper().IsSet("grpcserver.grpc_unix_domain") {
+		return nil
 	}
-	if !cfg.IsSet("grpcserver.grpc_host") && !cfg.IsSet("grpcserver.grpc_unix_domain") {
-		return
+	var setting grpcServerSetting
+	if err := cf.Bind("grpcserver", &setting); err != nil {
+		return newInitError("grpcserver", "grpcserver", err)
 	}
 
 	options := make([]grpcserver.Option, 0, 10)
 
 	//keepalive相关
-	if cfg.IsSet("grpcserver.keepalive.enforcement_policy_mintime") {
-		mintime := cfg.GetInt64("grpcserver.keepalive.enforcement_policy_mintime")
-		if mintime > 0 {
-			options = append(options, grpcserver.WithKeepaliveEnforcementPolicyMinTime(time.Duration(mintime)*time.Second))
-		}
+	ka := setting.Keepalive
+	if ka.EnforcementPolicyMinTime > 0 {
+		options = append(options, grpcserver.WithKeepaliveEnforcementPolicyMinTime(ka.EnforcementPolicyMinTime))
 	}
-	if cfg.IsSet("grpcserver.keepalive.enforcement_policy_permit_without_stream") {
-		b := cfg.GetBool("grpcserver.keepalive.enforcement_policy_permit_without_stream")
-		options = append(options, grpcserver.WithKeepaliveEnforcementPolicyPermitWithoutStream(b))
+	options = append(options, grpcserver.WithKeepaliveEnforcementPolicyPermitWithoutStream(ka.EnforcementPolicyPermitWithoutStream))
+	if ka.MaxConnectionIdle > 0 {
+		options = append(options, grpcserver.WithKeepaliveMaxConnectionIdle(ka.MaxConnectionIdle))
 	}
-
-	if cfg.IsSet("grpcserver.keepalive.max_connection_idle") {
-		idle := cfg.GetInt64("grpcserver.keepalive.max_connection_idle")
-		if idle > 0 {
-			options = append(options, grpcserver.WithKeepaliveMaxConnectionIdle(time.Duration(idle)*time.Second))
-		}
+	if ka.MaxConnectionAge > 0 {
+		options = append(options, grpcserver.WithKeepaliveMaxConnectionAge(ka.MaxConnectionAge))
 	}
-
-	if cfg.IsSet("grpcserver.keepalive.max_connection_age") {
-		age := cfg.GetInt64("grpcserver.keepalive.max_connection_age")
-		if age > 0 {
-			options = append(options, grpcserver.WithKeepaliveMaxConnectionAge(time.Duration(age)*time.Second))
-		}
+	if ka.MaxConnectionAgeGrace > 0 {
+		options = append(options, grpcserver.WithKeepaliveMaxConnectionAgeGrace(ka.MaxConnectionAgeGrace))
 	}
-
-	if cfg.IsSet("grpcserver.keepalive.max_connection_age_grace") {
-		age_grace := cfg.GetInt64("grpcserver.keepalive.max_connection_age_grace")
-		if age_grace > 0 {
-			options = append(options, grpcserver.WithKeepaliveMaxConnectionAgeGrace(time.Duration(age_grace)*time.Second))
-		}
+	if ka.Time > 0 {
+		options = append(options, grpcserver.WithKeepaliveTime(ka.Time))
 	}
-
-	if cfg.IsSet("grpcserver.keepalive.time") {
-		time1 := cfg.GetInt64("grpcserver.keepalive.time")
-		if time1 > 0 {
-			options = append(options, grpcserver.WithKeepaliveTime(time.Duration(time1)*time.Second))
-		}
-	}
-
-	if cfg.IsSet("grpcserver.keepalive.timeout") {
-		timeout := cfg.GetInt64("grpcserver.keepalive.timeout")
-		if timeout > 0 {
-			options = append(options, grpcserver.WithKeepaliveTimeout(time.Duration(timeout)*time.Second))
-		}
+	if ka.Timeout > 0 {
+		options = append(options, grpcserver.WithKeepaliveTimeout(ka.Timeout))
 	}
 
-	if cfg.IsSet("grpcserver.credentials") {
-		server_cert := cfg.GetString("grpcserver.credentials.server_cert")
-		server_key := cfg.GetString("grpcserver.credentials.server_key")
-
-		creds, err := credentials.NewServerTLSFromFile(server_cert, server_key)
+	if cred := setting.Credentials; len(cred.ServerCert) > 0 || len(cred.ServerKey) > 0 {
+		creds, err := credentials.NewServerTLSFromFile(cred.ServerCert, cred.ServerKey)
 		if err != nil {
-			app.App.GetLogger().Errorf("grpc credentials err:%v", err)
-			panic(fmt.Sprintf("grpc credentials err:%v", err))
+			return newInitError("grpcserver", "grpcserver.credentials", err)
 		}
 		options = append(options, grpcserver.WithCredentials(creds))
 	}
@@ -317,9 +444,15 @@ func InitGrpcServer() {
 	//增加recovery
 	options = append(options, grpcserver.WithAppendUnaryInterceptor(interceptor.DefaultRecoveryUnaryServerInterceptor()))
 	options = append(options, grpcserver.WithAppendStreamInterceptor(interceptor.DefaultRecoveryStreamServerInterceptor()))
+	//链路追踪
+	if ts, err := getTracingSetting(); err != nil {
+		return err
+	} else if ts.Enable {
+		options = append(options, grpcserver.WithAppendUnaryInterceptor(tracing.UnaryServerInterceptor()))
+		options = append(options, grpcserver.WithAppendStreamInterceptor(tracing.StreamServerInterceptor()))
+	}
 
-	if cfg.IsSet("grpcserver.interceptor") {
-		interceptors := cfg.GetStringSlice("grpcserver.interceptor")
+	if interceptors := setting.Interceptor; len(interceptors) > 0 {
 		//must first register this
 		if b, _ := util.Contain("requestid", interceptors); b {
 			options = append(options, grpcserver.WithAppendUnaryInterceptor(interceptor.RequestIdUnaryInterceptor))
@@ -331,7 +464,24 @@ func InitGrpcServer() {
 			options = append(options, grpcserver.WithAppendStreamInterceptor(interceptor.LogStreamInterceptor))
 		}
 	}
+	//指标统计 在限流之前 ResourceExhausted 也计入
+	if ms, err := getMetricsSetting(); err != nil {
+		return err
+	} else if ms.Enable {
+		options = append(options, grpcserver.WithAppendUnaryInterceptor(metrics.UnaryServerInterceptor()))
+		options = append(options, grpcserver.WithAppendStreamInterceptor(metrics.StreamServerInterceptor()))
+	}
+	//过载保护
+	if setting.Adaptive.Enable {
+		al := ratelimit.NewAdaptiveLimiter(setting.Adaptive)
+		metrics.RegisterAdaptive("grpc", al)
+		options = append(options, grpcserver.WithAppendUnaryInterceptor(grpc_ratelimiter.AdaptiveUnaryServerInterceptor(al)))
+		options = append(options, grpcserver.WithAppendStreamInterceptor(grpc_ratelimiter.AdaptiveStreamServerInterceptor(al)))
+	}
 	//add ratelimiter
+	if err := initGrpcRateLimit(); err != nil {
+		return err
+	}
 	options = append(options, grpcserver.WithAppendUnaryInterceptor(grpc_ratelimiter.RateLimiterUnaryServerInterceptor()))
 	options = append(options, grpcserver.WithAppendStreamInterceptor(grpc_ratelimiter.RateLimiterStreamServerInterceptor()))
 
@@ -339,19 +489,119 @@ func InitGrpcServer() {
 	// options = append(options, grpcserver.WithInitialConnWindowSize(1024*1024*1024))
 
 	var target string
-	if cfg.IsSet("grpcserver.grpc_host") {
-		host := cfg.GetString("grpcserver.grpc_host")
-		port := cfg.GetInt("grpcserver.grpc_port")
-		target = fmt.Sprintf("%s:%d", host, port)
+	if len(setting.Host) > 0 {
+		target = fmt.Sprintf("%s:%d", setting.Host, setting.Port)
 	} else {
-		target = cfg.GetString("grpcserver.grpc_unix_domain")
+		target = setting.UnixDomain
 		options = append(options, grpcserver.WithUnixSocket(true))
 	}
 
 	gs, err := grpcserver.NewGrpcServer(target, options...)
 	if err != nil {
-		panic(err)
+		return newInitError("grpcserver", "grpcserver", err)
+	}
+	if setting.Health {
+		health.UseGrpcHealth(gs.Server)
+	}
+	health.RegisterLiveness(app.ComponentGrpcServer, func(ctx context.Context) error {
+		return gs.Health()
+	})
+	if err := app.App.SetGrpcServer(gs); err != nil {
+		return err
 	}
-	app.App.SetGrpcServer(gs)
 	app.App.GetLogger().Info("[init] grpc server complete!")
+	return nil
+}
+
+// 指标配置
+type metricsSetting struct {
+	Enable bool   `mapstructure:"enable"`
+	Path   string `mapstructure:"path" default:"/metrics"`
+	//独立端口 如 ":9100" 为空时挂载到 http server
+	Addr string `mapstructure:"addr"`
+	//熔断管理接口路径 如 /admin/breakers 只挂载在 addr 独立端口 为空不注册
+	BreakerAdmin string `mapstructure:"breaker_admin"`
+}
+
+func getMetricsSetting() (metricsSetting, error) {
+	var setting metricsSetting
+	cf, _ := app.App.GetConfig()
+	if !cf.Viper().IsSet("metrics") {
+		return setting, nil
+	}
+	if err := cf.Bind("metrics", &setting); err != nil {
+		return setting, newInitError("metrics", "metrics", err)
+	}
+	return setting, nil
+}
+
+// 指标 配置独立端口时注册指标服务组件
+func InitMetrics() error {
+	setting, err := getMetricsSetting()
+	if err != nil {
+		return err
+	}
+	if !setting.Enable {
+		return nil
+	}
+	//可以强制打开熔断 不挂载到业务端口
+	if len(setting.BreakerAdmin) > 0 && len(setting.Addr) == 0 {
+		return newInitError("metrics", "metrics.breaker_admin", errors.New("breaker_admin requires metrics.addr"))
+	}
+	if len(setting.Addr) > 0 {
+		as := metrics.NewAdminServer(setting.Addr, setting.Path)
+		if len(setting.BreakerAdmin) > 0 {
+			h := breakers.AdminHandler(setting.BreakerAdmin)
+			as.Handle(setting.BreakerAdmin, h)
+			as.Handle(strings.TrimSuffix(setting.BreakerAdmin, "/")+"/", h)
+		}
+		if err := app.App.RegisterComponent(as); err != nil {
+			return newInitError("metrics", "metrics", err)
+		}
+	}
+	app.App.GetLogger().Info("[init] metrics complete!")
+	return nil
+}
+
+// 链路追踪配置
+type tracingSetting struct {
+	Enable bool `mapstructure:"enable"`
+	//log 写入 app 日志 stdout 标准输出 jaeger 上报 collector none 只传递 traceparent 不导出
+	Exporter string `mapstructure:"exporter" default:"log" valid:"Match(/^(log|none|stdout|jaeger)$/)"`
+	//jaeger collector 地址 如 http://127.0.0.1:14268/api/traces
+	Endpoint    string  `mapstructure:"endpoint"`
+	SampleRatio float64 `mapstructure:"sample_ratio" default:"1"`
+}
+
+func getTracingSetting() (tracingSetting, error) {
+	var setting tracingSetting
+	cf, _ := app.App.GetConfig()
+	if !cf.Viper().IsSet("tracing") {
+		return setting, nil
+	}
+	if err := cf.Bind("tracing", &setting); err != nil {
+		return setting, newInitError("tracing", "tracing", err)
+	}
+	return setting, nil
+}
+
+// 链路追踪 设置采样率 exporter 自定义 exporter 在 Init 后调用 tracing.SetExporter
+func InitTracing() error {
+	setting, err := getTracingSetting()
+	if err != nil {
+		return err
+	}
+	if !setting.Enable {
+		return nil
+	}
+	exporter, err := tracing.NewExporter(setting.Exporter, setting.Endpoint, app.App.GetLogger())
+	if err != nil {
+		return newInitError("tracing", "tracing", err)
+	}
+	tracing.SetServiceName(app.App.GetName())
+	tracing.SetSampleRatio(setting.SampleRatio)
+	tracing.SetExporter(exporter)
+	RegisterShutdown(ShutdownTracing)
+	app.App.GetLogger().Info("[init] tracing complete!")
+	return nil
 }
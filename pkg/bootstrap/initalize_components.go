@@ -0,0 +1,352 @@
+package bootstrap
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/spf13/viper"
+
+	"github.com/jeevic/lego/components/crontab"
+	"github.com/jeevic/lego/components/health"
+	kafkaConsumer "github.com/jeevic/lego/components/kafka/consumer"
+	kafkaProducer "github.com/jeevic/lego/components/kafka/producer"
+	"github.com/jeevic/lego/components/mongo"
+	pulsarConsumer "github.com/jeevic/lego/components/pulsar/consumer"
+	pulsarProducer "github.com/jeevic/lego/components/pulsar/producer"
+	"github.com/jeevic/lego/components/redis"
+	"github.com/jeevic/lego/components/retry"
+	"github.com/jeevic/lego/components/zookeeper"
+	"github.com/jeevic/lego/pkg/app"
+)
+
+// pulsar 订阅模式
+var pulsarSubscriptionType = map[string]pulsar.SubscriptionType{
+	"exclusive":  pulsar.Exclusive,
+	"shared":     pulsar.Shared,
+	"failover":   pulsar.Failover,
+	"key_shared": pulsar.KeyShared,
+}
+
+// 遍历组件配置实例
+// type = "multi" 时遍历 section.instance.* 否则为单实例 使用默认实例名
+// 遇到错误立即返回
+func eachInstance(section string, f func(instance string, prefix string) error) error {
+	cfg := app.App.GetConfiger()
+	if cfg.IsSet(section+".type") && app.IsMultiInstance(cfg.GetString(section+".type")) {
+		instances := cfg.GetStringMap(section + ".instance")
+		for instance := range instances {
+			if err := f(instance, section+".instance."+instance+"."); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return f(app.DefaultInstance, section+".")
+}
+
+// 读取地址列表 兼容 "a,b,c" 与 ["a", "b", "c"] 两种写法
+func getHosts(cfg *viper.Viper, key string) []string {
+	if s, ok := cfg.Get(key).(string); ok {
+		hosts := make([]string, 0)
+		for _, h := range strings.Split(s, ",") {
+			if h = strings.TrimSpace(h); len(h) > 0 {
+				hosts = append(hosts, h)
+			}
+		}
+		return hosts
+	}
+	return cfg.GetStringSlice(key)
+}
+
+// 读取重试配置 见 retry.Setting 未配置返回 nil
+func getRetryPolicy(name string, key string) (*retry.Policy, error) {
+	cf, _ := app.App.GetConfig()
+	if !cf.Viper().IsSet(key) {
+		return nil, nil
+	}
+	var s retry.Setting
+	if err := cf.Bind(key, &s); err != nil {
+		return nil, err
+	}
+	p := retry.NewPolicy(name, s)
+	return &p, nil
+}
+
+// 初始化redis
+func InitRedis() error {
+	cfg := app.App.GetConfiger()
+	if !cfg.IsSet("redis") {
+		return nil
+	}
+	return eachInstance("redis", func(instance string, prefix string) error {
+		setting := &redis.Setting{
+			MasterName:  cfg.GetString(prefix + "master_name"),
+			Hosts:       getHosts(cfg, prefix+"hosts"),
+			Password:    cfg.GetString(prefix + "password"),
+			MaxPoolSize: cfg.GetInt(prefix + "max_pool_size"),
+			MinPoolSize: cfg.GetInt(prefix + "min_pool_size"),
+			MaxIdleTime: cfg.GetInt(prefix + "max_idle_time"),
+			Db:          cfg.GetInt(prefix + "db"),
+			MaxRetries:  cfg.GetInt(prefix + "max_retries"),
+		}
+		//主从模式 未配置hosts 使用master地址
+		if len(setting.Hosts) == 0 && cfg.IsSet(prefix+"master") {
+			setting.Hosts = []string{cfg.GetString(prefix + "master")}
+		}
+		if err := redis.Register(instance, setting); err != nil {
+			return newInitError("redis", strings.TrimSuffix(prefix, "."), err)
+		}
+		RegisterShutdown(ShutdownRedis(instance))
+		health.Register("redis."+instance, func(ctx context.Context) error {
+			r, err := redis.GetRedis(instance)
+			if err != nil {
+				return err
+			}
+			return r.Ping(ctx)
+		})
+		app.App.GetLogger().Infof("[init] redis instance: %s complete!", instance)
+		return nil
+	})
+}
+
+// 初始化mongo
+func InitMongo() error {
+	cfg := app.App.GetConfiger()
+	if !cfg.IsSet("mongo") {
+		return nil
+	}
+	return eachInstance("mongo", func(instance string, prefix string) error {
+		setting := mongo.Setting{
+			Uri:            cfg.GetString(prefix + "uri"),
+			Hosts:          strings.Join(getHosts(cfg, prefix+"hosts"), ","),
+			ReplSet:        cfg.GetString(prefix + "replset"),
+			Username:       cfg.GetString(prefix + "username"),
+			Password:       cfg.GetString(prefix + "password"),
+			MaxPoolSize:    cfg.GetUint64(prefix + "max_pool_size"),
+			MinPoolSize:    cfg.GetUint64(prefix + "min_pool_size"),
+			MaxIdleTime:    cfg.GetInt(prefix + "max_idle_time"),
+			ReadPreference: cfg.GetString(prefix + "read_preference"),
+		}
+		if err := mongo.Register(instance, setting); err != nil {
+			return newInitError("mongo", strings.TrimSuffix(prefix, "."), err)
+		}
+		RegisterShutdown(ShutdownMongo(instance))
+		health.Register("mongo."+instance, func(ctx context.Context) error {
+			m, err := mongo.GetMongo(instance)
+			if err != nil {
+				return err
+			}
+			return m.Ping(ctx)
+		})
+		app.App.GetLogger().Infof("[init] mongo instance: %s complete!", instance)
+		return nil
+	})
+}
+
+// 初始化kafka 生产者 消费者
+func InitKafka() error {
+	cfg := app.App.GetConfiger()
+	if cfg.IsSet("kafka.producer") {
+		err := eachInstance("kafka.producer", func(instance string, prefix string) error {
+			setting := kafkaProducer.NewSetting()
+			setting.Hosts = getHosts(cfg, prefix+"host")
+			setting.Topic = cfg.GetString(prefix + "topic")
+			if cfg.IsSet(prefix + "timeout") {
+				setting.Timeout = cfg.GetInt(prefix + "timeout")
+			}
+			if cfg.IsSet(prefix + "return_success") {
+				setting.ReturnSuccess = cfg.GetBool(prefix + "return_success")
+			}
+			if cfg.IsSet(prefix + "return_error") {
+				setting.ReturnError = cfg.GetBool(prefix + "return_error")
+			}
+			if cfg.IsSet(prefix + "required_acks") {
+				setting.RequiredAcks = cfg.GetInt(prefix + "required_acks")
+			}
+			if cfg.IsSet(prefix + "max_retry") {
+				setting.MaxRetry = cfg.GetInt(prefix + "max_retry")
+			}
+			p, err := getRetryPolicy("kafka.producer."+instance, prefix+"retry")
+			if err != nil {
+				return newInitError("kafka.producer", prefix+"retry", err)
+			}
+			setting.Retry = p
+			if err := kafkaProducer.Register(instance, setting); err != nil {
+				return newInitError("kafka.producer", strings.TrimSuffix(prefix, "."), err)
+			}
+			RegisterShutdown(ShutdownKafkaProducer(instance))
+			health.Register("kafka.producer."+instance, func(ctx context.Context) error {
+				p, err := kafkaProducer.GetProducer(instance)
+				if err != nil {
+					return err
+				}
+				return p.Ping()
+			})
+			app.App.GetLogger().Infof("[init] kafka producer instance: %s complete!", instance)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.IsSet("kafka.consumer") {
+		err := eachInstance("kafka.consumer", func(instance string, prefix string) error {
+			setting := kafkaConsumer.NewSetting()
+			setting.Hosts = getHosts(cfg, prefix+"host")
+			setting.Topic = cfg.GetString(prefix + "topic")
+			setting.GroupId = cfg.GetString(prefix + "group_id")
+			if cfg.IsSet(prefix + "offset") {
+				setting.Offset = cfg.GetInt64(prefix + "offset")
+			}
+			if cfg.IsSet(prefix + "auto_commit") {
+				setting.AutoCommit = cfg.GetBool(prefix + "auto_commit")
+			}
+			if cfg.IsSet(prefix + "return_error") {
+				setting.ReturnError = cfg.GetBool(prefix + "return_error")
+			}
+			if cfg.IsSet(prefix + "max_retry") {
+				setting.MaxRetry = cfg.GetInt(prefix + "max_retry")
+			}
+			if err := kafkaConsumer.Register(instance, setting); err != nil {
+				return newInitError("kafka.consumer", strings.TrimSuffix(prefix, "."), err)
+			}
+			RegisterShutdown(ShutdownKafkaConsumer(instance))
+			health.Register("kafka.consumer."+instance, func(ctx context.Context) error {
+				c, err := kafkaConsumer.GetConsumer(instance)
+				if err != nil {
+					return err
+				}
+				return c.Ping()
+			})
+			app.App.GetLogger().Infof("[init] kafka consumer instance: %s complete!", instance)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 初始化pulsar 生产者 消费者
+func InitPulsar() error {
+	cfg := app.App.GetConfiger()
+	if cfg.IsSet("pulsar.producer") {
+		err := eachInstance("pulsar.producer", func(instance string, prefix string) error {
+			setting := pulsarProducer.NewSetting()
+			setting.Hosts = cfg.GetString(prefix + "hosts")
+			setting.Topic = cfg.GetString(prefix + "topic")
+			setting.Token = cfg.GetString(prefix + "token")
+			if t := cfg.GetInt64(prefix + "operation_timeout"); t > 0 {
+				setting.OperationTimeout = time.Duration(t) * time.Second
+			}
+			if t := cfg.GetInt64(prefix + "connection_timeout"); t > 0 {
+				setting.ConnectionTimeout = time.Duration(t) * time.Second
+			}
+			p, err := getRetryPolicy("pulsar.producer."+instance, prefix+"retry")
+			if err != nil {
+				return newInitError("pulsar.producer", prefix+"retry", err)
+			}
+			setting.Retry = p
+			if err := pulsarProducer.Register(instance, setting); err != nil {
+				return newInitError("pulsar.producer", strings.TrimSuffix(prefix, "."), err)
+			}
+			RegisterShutdown(ShutdownPulsarProducer(instance))
+			health.Register("pulsar.producer."+instance, func(ctx context.Context) error {
+				p, err := pulsarProducer.GetProducer(instance)
+				if err != nil {
+					return err
+				}
+				return p.Ping()
+			})
+			app.App.GetLogger().Infof("[init] pulsar producer instance: %s complete!", instance)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.IsSet("pulsar.consumer") {
+		err := eachInstance("pulsar.consumer", func(instance string, prefix string) error {
+			setting := pulsarConsumer.NewSetting()
+			setting.Hosts = cfg.GetString(prefix + "hosts")
+			setting.Topic = cfg.GetString(prefix + "topic")
+			setting.Subscription = cfg.GetString(prefix + "subscription")
+			setting.Token = cfg.GetString(prefix + "token")
+			if t := cfg.GetInt64(prefix + "operation_timeout"); t > 0 {
+				setting.OperationTimeout = time.Duration(t) * time.Second
+			}
+			if t := cfg.GetInt64(prefix + "connection_timeout"); t > 0 {
+				setting.ConnectionTimeout = time.Duration(t) * time.Second
+			}
+			if st, ok := pulsarSubscriptionType[cfg.GetString(prefix+"type")]; ok {
+				setting.Type = st
+			}
+			if size := cfg.GetInt(prefix + "chan_size"); size > 0 {
+				setting.ChanSize = size
+			}
+			if err := pulsarConsumer.Register(instance, setting); err != nil {
+				return newInitError("pulsar.consumer", strings.TrimSuffix(prefix, "."), err)
+			}
+			RegisterShutdown(ShutdownPulsarConsumer(instance))
+			health.Register("pulsar.consumer."+instance, func(ctx context.Context) error {
+				c, err := pulsarConsumer.GetConsumer(instance)
+				if err != nil {
+					return err
+				}
+				return c.Ping()
+			})
+			app.App.GetLogger().Infof("[init] pulsar consumer instance: %s complete!", instance)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 初始化zookeeper
+func InitZookeeper() error {
+	cfg := app.App.GetConfiger()
+	if !cfg.IsSet("zookeeper") {
+		return nil
+	}
+	return eachInstance("zookeeper", func(instance string, prefix string) error {
+		setting := zookeeper.Setting{
+			Hosts:          getHosts(cfg, prefix+"hosts"),
+			SessionTimeout: time.Duration(cfg.GetInt64(prefix+"session_timeout")) * time.Second,
+		}
+		if err := zookeeper.Register(instance, setting); err != nil {
+			return newInitError("zookeeper", strings.TrimSuffix(prefix, "."), err)
+		}
+		RegisterShutdown(ShutdownZookeeper(instance))
+		health.Register("zookeeper."+instance, func(ctx context.Context) error {
+			zb, err := zookeeper.GetZkBuilder(instance)
+			if err != nil {
+				return err
+			}
+			return zb.Ping()
+		})
+		app.App.GetLogger().Infof("[init] zookeeper instance: %s complete!", instance)
+		return nil
+	})
+}
+
+// 初始化定时任务
+func InitCrontab() error {
+	cfg := app.App.GetConfiger()
+	if !cfg.GetBool("crontab.enable") {
+		return nil
+	}
+	if loc := app.App.GetTimeLocation(); loc != nil {
+		crontab.ChangeLocation(loc)
+	}
+	RegisterShutdown(ShutdownCrontab)
+	app.App.GetLogger().Info("[init] crontab component complete!")
+	return nil
+}
@@ -0,0 +1,179 @@
+package bootstrap
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jeevic/lego/components/breakers"
+	"github.com/jeevic/lego/components/config"
+	"github.com/jeevic/lego/components/health"
+	"github.com/jeevic/lego/components/httpserver/ratelimiter"
+	"github.com/jeevic/lego/components/log"
+	"github.com/jeevic/lego/components/metrics"
+	"github.com/jeevic/lego/components/ratelimit"
+	"github.com/jeevic/lego/pkg/app"
+)
+
+func initTestConfig(t *testing.T, data string) {
+	c, err := config.NewConfigData("toml", []byte(data))
+	assert.Nil(t, err)
+	app.App.SetConfig(c)
+}
+
+func TestInit_ConfigMissing(t *testing.T) {
+	defer app.App.Close()
+	app.App.SetCfgFile("")
+
+	err := Init()
+	var ie *InitError
+	assert.True(t, errors.As(err, &ie), "init error need InitError")
+	assert.Equal(t, "config", ie.Stage)
+}
+
+func TestInitGrpcServer_CredentialsError(t *testing.T) {
+	defer app.App.Close()
+	initTestConfig(t, `
+[grpcserver]
+grpc_host = "127.0.0.1"
+grpc_port = 0
+[grpcserver.credentials]
+server_cert = "./not-exists.crt"
+server_key = "./not-exists.key"
+`)
+
+	err := InitGrpcServer()
+	var ie *InitError
+	assert.True(t, errors.As(err, &ie), "init error need InitError")
+	assert.Equal(t, "grpcserver", ie.Stage)
+	assert.Equal(t, "grpcserver.credentials", ie.Key)
+}
+
+func TestReload_RateLimitAndBreakers(t *testing.T) {
+	defer app.App.Close()
+	defer log.Reset()
+	assert.Nil(t, log.Register(app.DefaultInstance, log.Setting{}))
+	initTestConfig(t, `
+[httpserver.ratelimit]
+whole = 0
+[[httpserver.ratelimit.rules]]
+path = "/api/v1/user"
+capacity = 100
+[breakers.user]
+timeout = "100ms"
+k = 1.5
+window = "5s"
+buckets = 50
+protection = 0
+[[breakers.rules]]
+name = "10.0.0.1:9000/pkg.Svc/GetUser"
+timeout = "50ms"
+window = "5s"
+`)
+	assert.Nil(t, initHttpRateLimit())
+	assert.Nil(t, InitBreakers())
+	assert.Equal(t, []ratelimit.Policy{{Name: "/api/v1/user", Path: "/api/v1/user", Limit: 100, Period: time.Second, Burst: 100, Store: "local", Algorithm: "token_bucket"}}, ratelimiter.RateLimiter.Policies())
+	_, ok := breakers.Get("user")
+	assert.True(t, ok)
+	//名称包含 . 和大写 按 name 原样匹配
+	_, ok = breakers.Get("10.0.0.1:9000/pkg.Svc/GetUser")
+	assert.True(t, ok)
+
+	//已创建的熔断器 window 变化不生效 记录警告
+	hook := logtest.NewLocal(app.App.GetLogger())
+	cf, _ := app.App.GetConfig()
+	cf.Viper().Set("breakers.rules", []map[string]interface{}{{"name": "10.0.0.1:9000/pkg.Svc/GetUser", "timeout": "50ms", "window": "20s"}})
+	Reload()
+	warned := false
+	for _, e := range hook.AllEntries() {
+		warned = warned || e.Level == logrus.WarnLevel && strings.Contains(e.Message, "pkg.Svc/GetUser")
+	}
+	assert.True(t, warned, "window change on existing breaker should warn")
+
+	cf.Viper().Set("httpserver.ratelimit.rules", []map[string]interface{}{{"path": "/api/v1/user", "capacity": 10}})
+	cf.Viper().Set("httpserver.ratelimit.whole", 1000)
+	cf.Viper().Set("httpserver.ratelimit.policies", []map[string]interface{}{{"name": "ip", "key_by": []string{"ip"}, "limit": 5, "period": "1m"}})
+	Reload()
+	assert.Equal(t, []ratelimit.Policy{
+		{Name: ratelimiter.LegoWholeAppSign, Limit: 1000, Period: time.Second, Burst: 1000, Store: "local", Algorithm: "token_bucket"},
+		{Name: "/api/v1/user", Path: "/api/v1/user", Limit: 10, Period: time.Second, Burst: 10, Store: "local", Algorithm: "token_bucket"},
+		{Name: "ip", KeyBy: []string{"ip"}, Limit: 5, Period: time.Minute, Burst: 5, Store: "local", Algorithm: "token_bucket"},
+	}, ratelimiter.RateLimiter.Policies())
+}
+
+func TestInitGrpcServer_BindError(t *testing.T) {
+	defer app.App.Close()
+	initTestConfig(t, `
+[grpcserver]
+grpc_host = "127.0.0.1"
+grpc_port = 0
+[grpcserver.keepalive]
+time = "ten seconds"
+`)
+
+	err := InitGrpcServer()
+	var be *config.BindError
+	assert.True(t, errors.As(err, &be), "need BindError")
+	assert.Equal(t, []string{"grpcserver.keepalive.time"}, be.Keys())
+}
+
+func TestInitMetrics_BreakerAdminRequiresAddr(t *testing.T) {
+	defer app.App.Close()
+	initTestConfig(t, `
+[metrics]
+enable = true
+breaker_admin = "/admin/breakers"
+`)
+
+	err := InitMetrics()
+	var ie *InitError
+	assert.True(t, errors.As(err, &ie), "init error need InitError")
+	assert.Equal(t, "metrics", ie.Stage)
+	assert.Equal(t, "metrics.breaker_admin", ie.Key)
+}
+
+func TestInitHttpServer_MiddlewareOrder(t *testing.T) {
+	defer app.App.Close()
+	defer log.Reset()
+	assert.Nil(t, log.Register(app.DefaultInstance, log.Setting{}))
+	initTestConfig(t, `
+[httpserver]
+http_host = "127.0.0.1"
+http_port = 0
+[httpserver.ratelimit]
+whole = 1
+[metrics]
+enable = true
+`)
+	assert.Nil(t, InitHttpServer())
+	hs, _ := app.App.GetHttpServer()
+	hs.Engine.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	//被限流的请求也计入指标
+	before := testutil.ToFloat64(metrics.HttpRequests.WithLabelValues("/ping", "GET", "403"))
+	for i := 0; i < 3; i++ {
+		hs.Engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ping", nil))
+	}
+	assert.Equal(t, before+2, testutil.ToFloat64(metrics.HttpRequests.WithLabelValues("/ping", "GET", "403")))
+
+	//探针不受限流影响 未启动监听 去掉 http server 检查
+	defer health.Reset()
+	health.Unregister(app.ComponentHttpServer)
+	health.SetServing(true)
+	for _, path := range []string{health.LivenessPath, health.ReadinessPath} {
+		w := httptest.NewRecorder()
+		hs.Engine.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+	}
+}
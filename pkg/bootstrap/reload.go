@@ -0,0 +1,220 @@
+package bootstrap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jeevic/lego/components/breakers"
+	grpc_ratelimiter "github.com/jeevic/lego/components/grpc/grpcserver/grpc-ratelimiter"
+	"github.com/jeevic/lego/components/httpserver/ratelimiter"
+	"github.com/jeevic/lego/components/log"
+	"github.com/jeevic/lego/components/ratelimit"
+	"github.com/jeevic/lego/pkg/app"
+)
+
+// 配置热加载 文件写入或 SIGUSR2 时生效
+// 支持 日志级别 http grpc 限流容量 熔断器 timeout k 熔断器 window buckets protection 只在创建时生效
+//
+//	[httpserver.ratelimit]
+//	whole = 1000
+//	[[httpserver.ratelimit.rules]]
+//	path = "/api/v1/user"
+//	capacity = 100
+//	[[httpserver.ratelimit.policies]]
+//	name = "tenant"
+//	path = "/api/*"
+//	key_by = ["route", "header:X-Tenant"]
+//	limit = 50
+//	period = "1s"
+//
+//	[breakers.user]
+//	timeout = "100ms"
+//	k = 1.5
+//	window = "5s"
+//	buckets = 50
+//	protection = 5
+
+// 限流配置 配置 ratelimit 后以配置为准 代码中 AddRateLimit 的限流会被覆盖
+// whole rules 为每秒容量的简写 policies 见 ratelimit.Policy
+type rateLimitSetting struct {
+	Whole int64 `mapstructure:"whole"`
+	Rules []struct {
+		Path     string `mapstructure:"path"`
+		Capacity int64  `mapstructure:"capacity"`
+	} `mapstructure:"rules"`
+	Policies []ratelimit.Policy `mapstructure:"policies"`
+}
+
+// 读取限流配置 whole rules 转换为策略
+func getRateLimit(key string, pathPolicies func(int64, map[string]int64) []ratelimit.Policy) ([]ratelimit.Policy, error) {
+	var s rateLimitSetting
+	cf, _ := app.App.GetConfig()
+	if err := cf.UnmarshalKey(key, &s); err != nil {
+		return nil, err
+	}
+	paths := make(map[string]int64, len(s.Rules))
+	for _, r := range s.Rules {
+		if len(r.Path) > 0 {
+			paths[r.Path] = r.Capacity
+		}
+	}
+	return append(pathPolicies(s.Whole, paths), s.Policies...), nil
+}
+
+// 加载限流策略 并订阅变更
+func watchRateLimit(stage string, key string, engine *ratelimit.Engine, pathPolicies func(int64, map[string]int64) []ratelimit.Policy) error {
+	cf, _ := app.App.GetConfig()
+	if !cf.IsSet(key) {
+		return nil
+	}
+	policies, err := getRateLimit(key, pathPolicies)
+	if err == nil {
+		err = engine.SetPolicies(policies)
+	}
+	if err != nil {
+		return newInitError(stage, key, err)
+	}
+	cf.OnChange(key, func(old, new interface{}) {
+		policies, err := getRateLimit(key, pathPolicies)
+		if err == nil {
+			err = engine.SetPolicies(policies)
+		}
+		if err != nil {
+			app.App.GetLogger().Errorf("[reload] %s error:%s", key, err.Error())
+			return
+		}
+		app.App.GetLogger().Infof("[reload] %s policies:%d", key, len(policies))
+	})
+	return nil
+}
+
+// 订阅日志实例级别变更
+func watchLogLevel(instance string, prefix string) {
+	cf, err := app.App.GetConfig()
+	if err != nil {
+		return
+	}
+	key := prefix + "level"
+	cf.OnChange(key, func(old, new interface{}) {
+		l, err := log.GetLog(instance)
+		if err != nil {
+			return
+		}
+		l.SetLevel(cf.Viper().GetString(key))
+		app.App.GetLogger().Infof("[reload] log instance:%s level:%v => %v", instance, old, new)
+	})
+}
+
+// 加载 http 限流配置 并订阅变更
+func initHttpRateLimit() error {
+	return watchRateLimit("httpserver", "httpserver.ratelimit", ratelimiter.RateLimiter.Engine, ratelimiter.PathPolicies)
+}
+
+// 加载 grpc 限流配置 并订阅变更 path 为 grpc FullMethod
+func initGrpcRateLimit() error {
+	return watchRateLimit("grpcserver", "grpcserver.ratelimit", grpc_ratelimiter.RateLimiter.Engine, grpc_ratelimiter.PathPolicies)
+}
+
+// 初始化熔断器配置 并订阅变更
+func InitBreakers() error {
+	cf, _ := app.App.GetConfig()
+	if !cf.IsSet("breakers") {
+		return nil
+	}
+	setBreakers()
+	cf.OnChange("breakers", func(old, new interface{}) {
+		setBreakers()
+		app.App.GetLogger().Info("[reload] breakers setting complete!")
+	})
+	app.App.GetLogger().Info("[init] breakers component complete!")
+	return nil
+}
+
+// 熔断器配置 未配置时使用默认值
+// window buckets protection 只在创建时生效
+type breakerSetting struct {
+	//[[breakers.rules]] 中的熔断器名称 原样匹配 可以包含 . / 和大写
+	Name       string        `mapstructure:"name"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+	K          *float64      `mapstructure:"k"`
+	Window     time.Duration `mapstructure:"window"`
+	Buckets    int           `mapstructure:"buckets"`
+	Protection *int64        `mapstructure:"protection"`
+}
+
+// 只在创建时生效的参数是否一致
+func (s breakerSetting) sameCreation(o breakerSetting) bool {
+	if s.Window != o.Window || s.Buckets != o.Buckets {
+		return false
+	}
+	if s.Protection == nil || o.Protection == nil {
+		return s.Protection == o.Protection
+	}
+	return *s.Protection == *o.Protection
+}
+
+var (
+	breakerMutex sync.Mutex
+	//由配置创建的熔断器 创建时的配置
+	breakerCreated = make(map[string]breakerSetting)
+)
+
+// 按配置创建或更新熔断器 配置先于代码创建 以配置为准
+// [breakers.<name>] 的名称按 viper key 处理 不能包含 . 且转为小写
+// 名称包含 . 或大写时(如 grpc 拦截器的 10.0.0.1:9000/pkg.Svc/Method) 使用 [[breakers.rules]]
+func setBreakers() {
+	cfg, _ := app.App.GetConfig()
+	var settings []breakerSetting
+	for _, name := range cfg.SubKeys("breakers", breakerSetting{}) {
+		if name == "rules" {
+			continue
+		}
+		var s breakerSetting
+		if err := cfg.UnmarshalKey("breakers."+name, &s); err != nil {
+			app.App.GetLogger().Errorf("[breakers] breaker:%s setting error:%s", name, err.Error())
+			continue
+		}
+		s.Name = name
+		settings = append(settings, s)
+	}
+	var rules []breakerSetting
+	if err := cfg.UnmarshalKey("breakers.rules", &rules); err != nil {
+		app.App.GetLogger().Errorf("[breakers] breakers.rules setting error:%s", err.Error())
+	}
+	for i, s := range rules {
+		if len(s.Name) == 0 {
+			app.App.GetLogger().Errorf("[breakers] breakers.rules[%d] name is empty", i)
+			continue
+		}
+		settings = append(settings, s)
+	}
+
+	defer breakerMutex.Unlock()
+	breakerMutex.Lock()
+	for _, s := range settings {
+		setBreaker(s)
+	}
+}
+
+func setBreaker(s breakerSetting) {
+	var k float64
+	if s.K != nil {
+		k = *s.K
+	}
+	_, exists := breakers.Get(s.Name)
+	b := breakers.NewBreaker().WithTimeout(s.Timeout).WithK(k).WithWindow(s.Window).WithBuckets(s.Buckets)
+	if s.Protection != nil {
+		b.WithProtection(*s.Protection)
+	}
+	b.GetOrBuild(s.Name)
+	created, ok := breakerCreated[s.Name]
+	if !exists {
+		breakerCreated[s.Name] = s
+	} else if (ok && !s.sameCreation(created)) || (!ok && !s.sameCreation(breakerSetting{})) {
+		app.App.GetLogger().Warnf("[breakers] breaker:%s already exists window buckets protection change ignored until restart", s.Name)
+	}
+	breakers.SetTimeout(s.Name, s.Timeout)
+	if s.K != nil {
+		breakers.SetK(s.Name, *s.K)
+	}
+}
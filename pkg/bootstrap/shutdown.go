@@ -1,25 +1,59 @@
 package bootstrap
 
 import (
+	"context"
 	"time"
 
+	"github.com/jeevic/lego/components/crontab"
+	"github.com/jeevic/lego/components/health"
+	kafkaConsumer "github.com/jeevic/lego/components/kafka/consumer"
+	kafkaProducer "github.com/jeevic/lego/components/kafka/producer"
+	"github.com/jeevic/lego/components/log"
+	"github.com/jeevic/lego/components/mongo"
+	pulsarConsumer "github.com/jeevic/lego/components/pulsar/consumer"
+	pulsarProducer "github.com/jeevic/lego/components/pulsar/producer"
+	"github.com/jeevic/lego/components/redis"
+	"github.com/jeevic/lego/components/tracing"
+	"github.com/jeevic/lego/components/zookeeper"
 	"github.com/jeevic/lego/pkg/app"
 )
 
+//组件停止超时时间
+var ShutdownTimeout = 5 * time.Second
+
+//就绪检查切换为不可用后 等待负载均衡摘除流量的时间 配置 app.shutdown_drain 平滑重启时不等待
+var ShutdownDrain time.Duration
+
 var shutdownFunc = []func(){
-	ShutdownHttpServer,
-	ShutdownGrpcServer,
-	ShutdownApp,
+	ShutdownComponents,
 }
 
 func Shutdown() {
+	shutdown(true)
+}
+
+//drain 为 false 时不切换就绪状态也不等待摘除 用于平滑重启 新进程共用监听继续接收流量
+//停止组件时仍等待执行中的请求结束
+func shutdown(drain bool) {
 	t1 := time.Now()
+	//先切换就绪状态 负载均衡摘除后再停止服务
+	if drain {
+		health.SetServing(false)
+		if ShutdownDrain > 0 {
+			app.App.GetLogger().Infof("[shutdown] readiness not serving, wait drain %s", ShutdownDrain)
+			time.Sleep(ShutdownDrain)
+		}
+	}
 	for _, f := range shutdownFunc {
 		f()
 	}
+	//app 最后关闭
+	ShutdownApp()
 	cost := time.Since(t1)
 	time.Sleep(5 * time.Second)
 	app.App.GetLogger().Info("[shutdown] app all shutdown complete! time timeline:", cost)
+	//最后写入异步日志
+	_ = log.CloseAll()
 
 }
 
@@ -27,23 +61,111 @@ func RegisterShutdown(f func()) {
 	shutdownFunc = append(shutdownFunc, f)
 }
 
-func ShutdownHttpServer() {
-	hs, _ := app.App.GetHttpServer()
-	if hs != nil {
-		hs.GracefulShutdown()
-		app.App.GetLogger().Infof("[shutdown] shutdown httpserver  complete!")
+// 按启动顺序逆序停止组件
+func ShutdownComponents() {
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := app.App.Registry.StopAll(ctx); err != nil {
+		app.App.GetLogger().Errorf("[shutdown] shutdown components error:%s", err.Error())
+		return
 	}
+	app.App.GetLogger().Infof("[shutdown] shutdown components complete!")
 }
 
+// Deprecated: 由 ShutdownComponents 按依赖顺序停止 保留兼容
+func ShutdownHttpServer() {
+	shutdownComponent(app.ComponentHttpServer)
+}
+
+// Deprecated: 由 ShutdownComponents 按依赖顺序停止 保留兼容
 func ShutdownGrpcServer() {
-	gs, _ := app.App.GetGrpcServer()
-	if gs != nil {
-		gs.GracefulShutdown()
-		app.App.GetLogger().Infof("[shutdown] shutdown grpc server  complete!")
+	shutdownComponent(app.ComponentGrpcServer)
+}
+
+func shutdownComponent(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := app.App.Registry.Stop(ctx, name); err != nil {
+		app.App.GetLogger().Errorf("[shutdown] shutdown %s error:%s", name, err.Error())
+		return
 	}
+	app.App.GetLogger().Infof("[shutdown] shutdown %s complete!", name)
 }
 
 func ShutdownApp() {
 	app.App.Close()
 	app.App.GetLogger().Infof("[shutdown] shutdown app complete!")
 }
+
+func ShutdownRedis(instance string) func() {
+	return func() {
+		if err := redis.Unregister(instance); err == nil {
+			app.App.GetLogger().Infof("[shutdown] shutdown redis instance: %s complete!", instance)
+		}
+	}
+}
+
+func ShutdownMongo(instance string) func() {
+	return func() {
+		if err := mongo.Unregister(instance); err == nil {
+			app.App.GetLogger().Infof("[shutdown] shutdown mongo instance: %s complete!", instance)
+		}
+	}
+}
+
+func ShutdownKafkaProducer(instance string) func() {
+	return func() {
+		if err := kafkaProducer.Unregister(instance); err == nil {
+			app.App.GetLogger().Infof("[shutdown] shutdown kafka producer instance: %s complete!", instance)
+		}
+	}
+}
+
+func ShutdownKafkaConsumer(instance string) func() {
+	return func() {
+		if err := kafkaConsumer.Unregister(instance); err == nil {
+			app.App.GetLogger().Infof("[shutdown] shutdown kafka consumer instance: %s complete!", instance)
+		}
+	}
+}
+
+func ShutdownPulsarProducer(instance string) func() {
+	return func() {
+		if err := pulsarProducer.Unregister(instance); err == nil {
+			app.App.GetLogger().Infof("[shutdown] shutdown pulsar producer instance: %s complete!", instance)
+		}
+	}
+}
+
+func ShutdownPulsarConsumer(instance string) func() {
+	return func() {
+		if err := pulsarConsumer.Unregister(instance); err == nil {
+			app.App.GetLogger().Infof("[shutdown] shutdown pulsar consumer instance: %s complete!", instance)
+		}
+	}
+}
+
+func ShutdownZookeeper(instance string) func() {
+	return func() {
+		if err := zookeeper.Unregister(instance); err == nil {
+			app.App.GetLogger().Infof("[shutdown] shutdown zookeeper instance: %s complete!", instance)
+		}
+	}
+}
+
+//刷新未导出的 span
+func ShutdownTracing() {
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := tracing.Shutdown(ctx); err != nil {
+		app.App.GetLogger().Errorf("[shutdown] shutdown tracing error:%s", err.Error())
+		return
+	}
+	app.App.GetLogger().Infof("[shutdown] shutdown tracing complete!")
+}
+
+func ShutdownCrontab() {
+	crontab.Clear()
+	crontab.Stop()
+	app.App.GetLogger().Infof("[shutdown] shutdown crontab complete!")
+}